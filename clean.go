@@ -0,0 +1,219 @@
+package recaltools
+
+import (
+	"context"
+	"fmt"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/antchfx/xmlquery"
+	"github.com/antchfx/xpath"
+	"github.com/jymannob/recaltools/i18n"
+	"github.com/jymannob/recaltools/logger"
+	"github.com/jymannob/recaltools/vfs"
+	"github.com/jymannob/recaltools/xml"
+)
+
+// Cleaner deletes scraping data from gamelists so a full rescrape can start from scratch.
+// User data (favorite, playcount, lastplayed) is backed up first and can be restored after the rescrape.
+type Cleaner struct {
+	RomsDir       []string
+	Rules         []CleanRule // what to delete on which systems, every scraped element on every system if empty
+	Rename        bool        // rename gamelist.xml to a dated name instead of stripping scraped elements, rules may only select systems
+	FormatJson    bool
+	NormalizeUTF8 bool
+	Options
+}
+
+// ScrapedFields are the `game` elements filled by the scraper
+var ScrapedFields = []string{
+	"desc", "image", "video", "thumbnail", "marquee", "genre", "genreid",
+	"developer", "publisher", "releasedate", "hash", "rating", "players", "region",
+}
+
+// CleanRule selects the elements to delete, on which systems and for which games
+type CleanRule struct {
+	Systems []string `json:"systems,omitempty"` // system directory name globs (`snes`, `mega*`), all systems if empty
+	Fields  []string `json:"fields,omitempty"`  // elements to delete, ScrapedFields if empty
+	Filter  string   `json:"filter,omitempty"`  // XPath predicate on `game` nodes (`not(genre) or genre=''`, `@source!='Recalbox'`), all games if empty
+}
+
+// Validate checks system globs and filter syntax
+func (r CleanRule) Validate() error {
+	for _, pattern := range r.Systems {
+		if _, err := filepath.Match(pattern, ""); err != nil {
+			return i18n.NewError(i18n.CleanRuleInvalid, err, pattern)
+		}
+	}
+	if _, err := xpath.Compile(r.xpath()); err != nil {
+		return i18n.NewError(i18n.CleanRuleInvalid, err, r.Filter)
+	}
+	return nil
+}
+
+// MatchSystem reports whether the rule applies to the system directory name
+func (r CleanRule) MatchSystem(system string) bool {
+	return len(r.Systems) == 0 || matchGlobs(r.Systems, system)
+}
+
+func (r CleanRule) fields() []string {
+	if len(r.Fields) == 0 {
+		return ScrapedFields
+	}
+	return r.Fields
+}
+
+// xpath selects the `game` nodes matching the filter
+func (r CleanRule) xpath() string {
+	if r.Filter == "" {
+		return "//game"
+	}
+	return fmt.Sprintf("//game[%s]", r.Filter)
+}
+
+// rules returns the cleaner rules, a rule deleting every scraped element on every system if none
+func (c *Cleaner) rules() []CleanRule {
+	if len(c.Rules) == 0 {
+		return []CleanRule{{}}
+	}
+	return c.Rules
+}
+
+// systemRules returns the rules applying to the system of the gamelist
+func (c *Cleaner) systemRules(gamelist string) []CleanRule {
+	system := filepath.Base(filepath.Dir(gamelist))
+
+	var rules []CleanRule
+	for _, rule := range c.rules() {
+		if rule.MatchSystem(system) {
+			rules = append(rules, rule)
+		}
+	}
+	return rules
+}
+
+func (c *Cleaner) Clean() error {
+	return c.CleanContext(context.Background())
+}
+
+// CleanContext is Clean stopping to start new gamelists once ctx is done
+func (c *Cleaner) CleanContext(ctx context.Context) error {
+
+	for _, rule := range c.rules() {
+		if err := rule.Validate(); err != nil {
+			return err
+		}
+		// whole gamelists are renamed, not some elements of some games
+		if c.Rename && (len(rule.Fields) > 0 || rule.Filter != "") {
+			return i18n.NewError(i18n.CleanRenameRules, nil)
+		}
+	}
+	if c.Rename && c.Filter.FiltersGames() {
+		return i18n.NewError(i18n.CleanRenameRules, nil)
+	}
+
+	// backup user data before deleting anything
+	fb := FavBackup{
+		RomsDir:    c.RomsDir,
+		FormatJson: c.FormatJson,
+		Options:    c.backupOptions(),
+	}
+	if err := fb.BackupContext(ctx); err != nil {
+		return err
+	}
+
+	gamelists, err := c.scanner().Scan(c.RomsDir)
+	if err != nil {
+		return err
+	}
+
+	var selected []string
+	for _, gamelist := range gamelists {
+		if len(c.systemRules(gamelist)) > 0 {
+			selected = append(selected, gamelist)
+		}
+	}
+
+	now := time.Now()
+	clean := c.cleanSystem
+	if c.Rename {
+		clean = func(gamelist string) (int, error) { return c.renameGamelist(gamelist, now) }
+	}
+	if err := forEach(ctx, c.Jobs, selected, observed(c.observer(), selected, clean)); err != nil {
+		return err
+	}
+
+	c.log().Info(i18n.T(i18n.CleanDone))
+	return nil
+}
+
+// renameGamelist renames gamelist.xml to gamelist-YYYYMMDD-HHMMSS.xml
+func (c *Cleaner) renameGamelist(gamelist string, now time.Time) (int, error) {
+
+	renamed := datedName(gamelist, now)
+	c.log().Debug(i18n.T(i18n.CleanRename, gamelist, renamed), logger.System(gamelist))
+
+	if err := c.fs().Rename(gamelist, renamed); err != nil {
+		return 0, i18n.NewError(i18n.FileMove, err, gamelist, renamed)
+	}
+	c.observer().FileWritten(gamelist, renamed)
+	return 0, nil
+}
+
+// cleanSystem strips the elements selected by the system rules from the `game` nodes of the gamelist
+func (c *Cleaner) cleanSystem(gamelist string) (int, error) {
+
+	doc, enc, err := vfs.ReadXml(c.fs(), gamelist)
+	if err != nil {
+		return 0, err
+	}
+
+	removed := 0
+	var cleaned []*xmlquery.Node
+	for _, rule := range c.systemRules(gamelist) {
+		nodes, err := xmlquery.QueryAll(doc, rule.xpath())
+		if err != nil {
+			return 0, err
+		}
+		for _, node := range nodes {
+			if !c.Filter.MatchNode(node) {
+				continue
+			}
+			if n := xml.RemoveChildNodes(node, rule.fields()...); n > 0 {
+				removed += n
+				cleaned = append(cleaned, node)
+			}
+		}
+	}
+
+	if removed == 0 {
+		return 0, nil
+	}
+
+	c.log().Debug(i18n.T(i18n.CleanGamelist, gamelist, removed), logger.System(gamelist))
+
+	if c.NormalizeUTF8 {
+		enc = xml.UTF8
+	}
+	if err := vfs.WriteXml(c.fs(), gamelist, doc, enc); err != nil {
+		return 0, err
+	}
+
+	// a game cleaned by several rules is notified once
+	notified := make(map[*xmlquery.Node]bool)
+	for _, node := range cleaned {
+		if !notified[node] {
+			notified[node] = true
+			c.observer().GameUpdated(gamelist, childText(node, "path"))
+		}
+	}
+	c.observer().FileWritten(gamelist, gamelist)
+	return len(notified), nil
+}
+
+// datedName returns the path with the date inserted before its extension
+func datedName(path string, now time.Time) string {
+	ext := filepath.Ext(path)
+	return fmt.Sprintf("%s-%s%s", strings.TrimSuffix(path, ext), now.Format("20060102-150405"), ext)
+}
@@ -0,0 +1,159 @@
+package recaltools
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/antchfx/xmlquery"
+	"github.com/jymannob/recaltools/i18n"
+	"github.com/jymannob/recaltools/xml"
+)
+
+// Functional testing
+func TestCleaner_Clean(t *testing.T) {
+	romsDir := copyTestdata(t, "nes", "megadrive")
+
+	c := &Cleaner{RomsDir: []string{romsDir}, Options: Options{Verbose: true}}
+	if err := c.Clean(); err != nil {
+		t.Fatalf("Cleaner.Clean() error = %v", err)
+	}
+
+	for _, system := range []string{"nes", "megadrive"} {
+		if _, err := os.Stat(filepath.Join(romsDir, system, fileBackupName)); err != nil {
+			t.Errorf("Cleaner.Clean() backup not written : %v", err)
+		}
+
+		doc, err := xml.OpenXml(filepath.Join(romsDir, system, "gamelist.xml"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, field := range ScrapedFields {
+			if nodes := xmlquery.Find(doc, "//game/"+field); len(nodes) > 0 {
+				t.Errorf("Cleaner.Clean() %s : %d `%s` left", system, len(nodes), field)
+			}
+		}
+		if nodes := xmlquery.Find(doc, "//game/favorite"); len(nodes) == 0 {
+			t.Errorf("Cleaner.Clean() %s : user data deleted", system)
+		}
+	}
+}
+
+// Functional testing
+func TestCleaner_CleanRename(t *testing.T) {
+	romsDir := copyTestdata(t, "nes")
+
+	c := &Cleaner{RomsDir: []string{romsDir}, Rename: true}
+	if err := c.Clean(); err != nil {
+		t.Fatalf("Cleaner.Clean() error = %v", err)
+	}
+
+	if _, err := os.Stat(filepath.Join(romsDir, "nes", "gamelist.xml")); !os.IsNotExist(err) {
+		t.Errorf("Cleaner.Clean() gamelist.xml not renamed")
+	}
+	renamed, _ := filepath.Glob(filepath.Join(romsDir, "nes", "gamelist-*.xml"))
+	if len(renamed) != 1 {
+		t.Errorf("Cleaner.Clean() renamed gamelists = %v, want 1", renamed)
+	}
+}
+
+func TestCleaner_CleanRename_rules(t *testing.T) {
+	romsDir := copyTestdata(t, "nes")
+
+	for _, c := range []*Cleaner{
+		{RomsDir: []string{romsDir}, Rename: true, Rules: []CleanRule{{Fields: []string{"video"}}}},
+		{RomsDir: []string{romsDir}, Rename: true, Rules: []CleanRule{{Filter: "genre=''"}}},
+		{RomsDir: []string{romsDir}, Rename: true, Options: Options{Filter: Filter{FavoriteOnly: true}}},
+	} {
+		if err := c.Clean(); !errors.Is(err, &i18n.Error{Key: i18n.CleanRenameRules}) {
+			t.Errorf("Cleaner.Clean() error = %v, want CleanRenameRules", err)
+		}
+	}
+	if _, err := os.Stat(filepath.Join(romsDir, "nes", "gamelist.xml")); err != nil {
+		t.Errorf("Cleaner.Clean() renamed gamelist.xml despite its rules : %v", err)
+	}
+}
+
+func Test_datedName(t *testing.T) {
+	now := time.Date(2022, 5, 29, 18, 37, 48, 0, time.UTC)
+	if got, want := datedName("/roms/nes/gamelist.xml", now), "/roms/nes/gamelist-20220529-183748.xml"; got != want {
+		t.Errorf("datedName() = %v, want %v", got, want)
+	}
+}
+
+// Functional testing
+func TestCleaner_CleanRules(t *testing.T) {
+	romsDir := copyTestdata(t, "nes", "megadrive")
+	megadrive, _ := os.ReadFile(filepath.Join(romsDir, "megadrive", "gamelist.xml"))
+
+	c := &Cleaner{
+		RomsDir: []string{romsDir},
+		Rules: []CleanRule{
+			{Systems: []string{"ne?"}, Fields: []string{"image"}, Filter: "genre='Puzzle-Game'"},
+		},
+	}
+	if err := c.Clean(); err != nil {
+		t.Fatalf("Cleaner.Clean() error = %v", err)
+	}
+
+	doc, err := xml.OpenXml(filepath.Join(romsDir, "nes", "gamelist.xml"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if nodes := xmlquery.Find(doc, "//game[genre='Puzzle-Game']/image"); len(nodes) != 0 {
+		t.Errorf("Cleaner.Clean() filtered games images = %d, want 0", len(nodes))
+	}
+	if nodes := xmlquery.Find(doc, "//game[genre='Puzzle-Game']/desc"); len(nodes) == 0 {
+		t.Errorf("Cleaner.Clean() filtered games desc deleted")
+	}
+	if nodes := xmlquery.Find(doc, "//game[genre!='Puzzle-Game']/image"); len(nodes) == 0 {
+		t.Errorf("Cleaner.Clean() other games images deleted")
+	}
+
+	if got, _ := os.ReadFile(filepath.Join(romsDir, "megadrive", "gamelist.xml")); string(got) != string(megadrive) {
+		t.Errorf("Cleaner.Clean() megadrive gamelist modified")
+	}
+}
+
+func TestCleanRule_MatchSystem(t *testing.T) {
+	tests := []struct {
+		name   string
+		rule   CleanRule
+		system string
+		want   bool
+	}{
+		{"All systems", CleanRule{}, "nes", true},
+		{"Exact name", CleanRule{Systems: []string{"snes", "nes"}}, "nes", true},
+		{"Glob", CleanRule{Systems: []string{"mega*"}}, "megadrive", true},
+		{"No match", CleanRule{Systems: []string{"mega*"}}, "nes", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.rule.MatchSystem(tt.system); got != tt.want {
+				t.Errorf("CleanRule.MatchSystem() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestCleanRule_Validate(t *testing.T) {
+	tests := []struct {
+		name    string
+		rule    CleanRule
+		wantErr bool
+	}{
+		{"Empty rule", CleanRule{}, false},
+		{"Valid rule", CleanRule{Systems: []string{"mega*"}, Filter: "not(genre) or genre=''"}, false},
+		{"Bad glob", CleanRule{Systems: []string{"[mega"}}, true},
+		{"Bad filter", CleanRule{Filter: "genre=='"}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := tt.rule.Validate(); (err != nil) != tt.wantErr {
+				t.Errorf("CleanRule.Validate() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
@@ -3,10 +3,12 @@ package main
 import (
 	"flag"
 	"fmt"
-	"log"
+	"os"
 	"path/filepath"
 
 	"github.com/jymannob/recaltools"
+	"github.com/jymannob/recaltools/i18n"
+	"github.com/jymannob/recaltools/internal/cli"
 )
 
 var (
@@ -23,7 +25,21 @@ func main() {
 	flag.BoolVar(&favBkp.FormatJson, "f", false, "Format Json output")
 	restoreBkp := flag.Bool("R", false, "Restore backup to gamelist.xml")
 	flag.BoolVar(&favBkp.Verbose, "verbose", false, "Print debug logs")
+	flag.BoolVar(&favBkp.Stamp, "stamp", false, "Set timestamp attribute of restored games to the restore time")
+	flag.BoolVar(&favBkp.NormalizeUTF8, "normalize-utf8", false, "Write gamelists in UTF-8 instead of their original encoding")
+	flag.BoolVar(&favBkp.FollowSymlinks, "follow-symlinks", false, "Walk symlinked directories, a directory reached twice is processed once")
+	flag.IntVar(&favBkp.Jobs, "jobs", 0, "Gamelists processed at once default:number of CPUs")
+	var guard recaltools.ESGuard
+	flag.BoolVar(&guard.Force, "force", false, "Restore even if EmulationStation is running")
+	flag.StringVar(&guard.StopCmd, "es-stop", "", "Shell command stopping EmulationStation before restoring")
+	flag.StringVar(&guard.StartCmd, "es-start", "", "Shell command starting EmulationStation once restored")
+	esSystems := flag.String("es-systems", "", "es_systems.cfg giving the ROM directory of the systems whose gamelists are in -es-gamelists")
+	esGamelists := flag.String("es-gamelists", "", "Directory of the <system>/gamelist.xml of the EmulationStation home layout, scanned without -d, needs -es-systems default:~/.emulationstation/gamelists")
 	directories := flag.String("d", "/recalbox/share/roms:/recalbox/share/externals", "Roms directory")
+	logLevel := flag.String("log-level", "", "Logs level (error, warn, info, debug, trace) default:info, debug with -verbose")
+	logFormat := flag.String("log-format", "text", "Logs format (text, json)")
+	logFile := flag.String("log-file", "", "Append logs to this file instead of stderr")
+	lang := flag.String("lang", "", "Messages language (en, fr) default:from LANG")
 	v := flag.Bool("v", false, "Print version")
 	h := flag.Bool("h", false, "Print this help")
 
@@ -31,6 +47,10 @@ func main() {
 
 	favBkp.RomsDir = filepath.SplitList(*directories)
 
+	if *lang != "" {
+		i18n.SetLang(i18n.ParseLang(*lang))
+	}
+
 	if *v {
 		fmt.Printf("%s by Jymannob\n\nBuild : %s\nVersion : %s\nDate : %s\n", toolName, buildCommit, buildVersion, buildDate)
 		return
@@ -40,18 +60,41 @@ func main() {
 		return
 	}
 
-	if *restoreBkp {
+	logs, err := cli.NewLogger(*logLevel, *logFormat, *logFile, favBkp.Verbose)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(cli.ExitFailure)
+	}
+	favBkp.Logger = logs
 
-		err := favBkp.Restore()
-		if err != nil {
-			log.Println(err)
-		}
-	} else {
+	favBkp.Layout, err = cli.NewLayout(*esSystems, *esGamelists)
+	if err != nil {
+		logs.Error(err.Error())
+		os.Exit(cli.ExitFailure)
+	}
+	// the home layout gamelists are scanned unless other directories are given
+	dirsSet := false
+	flag.Visit(func(f *flag.Flag) { dirsSet = dirsSet || f.Name == "d" })
+	if !dirsSet {
+		favBkp.RomsDir = cli.DefaultRomsDir(favBkp.Layout, favBkp.RomsDir...)
+	}
+	guard.Logger = logs
+
+	// finish running gamelists on SIGINT or SIGTERM, exit on the second one
+	ctx := cli.InterruptContext(logs)
 
-		err := favBkp.Backup()
-		if err != nil {
-			log.Println(err)
-		}
+	if *restoreBkp {
+		err = guard.Run(ctx, func() error { return favBkp.RestoreContext(ctx) })
+	} else {
+		err = favBkp.BackupContext(ctx)
+	}
+	if err != nil {
+		logs.Error(err.Error())
+		os.Exit(cli.ExitCode(err))
 	}
 
+	// a run receiving a signal is interrupted, even if every gamelist it started has been written
+	if ctx.Err() != nil {
+		os.Exit(cli.ExitInterrupted)
+	}
 }
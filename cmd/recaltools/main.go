@@ -2,13 +2,23 @@ package main
 
 import (
 	"fmt"
-	"log"
 	"os"
+	"path/filepath"
+	"strings"
+	"time"
 
 	"github.com/alexflint/go-arg"
 	"github.com/jymannob/recaltools"
+	"github.com/jymannob/recaltools/i18n"
+	"github.com/jymannob/recaltools/internal/cli"
+	"github.com/jymannob/recaltools/logger"
+	"github.com/jymannob/recaltools/trash"
+	"github.com/jymannob/recaltools/utils"
 )
 
+// logs is the logger of the run, set from the log flags
+var logs = logger.Std(logger.LevelInfo)
+
 var (
 	buildVersion string = "UNKNOWN"
 	buildCommit  string = "UNKNOWN"
@@ -21,58 +31,620 @@ type BackupCmd struct {
 	RomsDir    []string `arg:"positional" help:"path/to/roms/dir default:/recalbox/share/roms"`
 }
 type RestoreCmd struct {
+	Stamp   bool     `arg:"--stamp" help:"Set timestamp attribute of restored games to the restore time"`
+	RomsDir []string `arg:"positional" help:"path/to/roms/dir default:/recalbox/share/roms"`
+}
+
+type NormalizeCmd struct {
+	SortBy  string   `arg:"--sort" default:"name" help:"Sort entries by name or path"`
+	Check   bool     `arg:"--check" help:"Do not write, exit with code 1 if a gamelist is not normalized"`
+	RomsDir []string `arg:"positional" help:"path/to/roms/dir default:/recalbox/share/roms"`
+}
+
+type CleanCmd struct {
+	Rename     bool     `arg:"--rename" help:"Rename gamelist.xml to a dated name instead of deleting scraped elements"`
+	Fields     []string `arg:"--field,separate" help:"Element to delete (repeatable) default:all scraped elements"`
+	Filter     string   `arg:"--filter" help:"XPath predicate selecting games to clean, ex: \"@source!='Recalbox'\""`
+	Rules      string   `arg:"--rules" help:"Json file of clean rules [{systems, fields, filter}], replaces --field and --filter"`
+	FormatJson bool     `arg:"-f" help:"Format Json output of the backup"`
+	RomsDir    []string `arg:"positional" help:"path/to/roms/dir default:/recalbox/share/roms"`
+}
+
+type PruneCmd struct {
+	KeepUserData bool     `arg:"--keep-user-data" help:"Only prune entries without favorite, playcount or lastplayed"`
+	DryRun       bool     `arg:"--dry-run" help:"Only list entries without rom"`
+	FormatJson   bool     `arg:"-f" help:"Format Json output of the backup"`
+	RomsDir      []string `arg:"positional" help:"path/to/roms/dir default:/recalbox/share/roms"`
+}
+
+type OrphansCmd struct {
+	Quarantine bool     `arg:"--quarantine" help:"Move orphaned media to the media-quarantine folder of their system"`
+	Restore    bool     `arg:"--restore" help:"Move quarantined media back to their system"`
+	Empty      bool     `arg:"--empty" help:"Move quarantined media to the trash"`
+	MediaDirs  []string `arg:"--media-dir,separate" help:"Media sub folder of the system directory (repeatable) default:media"`
+	RomsDir    []string `arg:"positional" help:"path/to/roms/dir default:/recalbox/share/roms"`
+}
+
+type MissingCmd struct {
+	Relink    bool     `arg:"--relink" help:"Rewrite missing media paths to a file named after the rom found in the media folders"`
+	MediaDirs []string `arg:"--media-dir,separate" help:"Media folder relative to the system directory (repeatable) default:media"`
+	RomsDir   []string `arg:"positional" help:"path/to/roms/dir default:/recalbox/share/roms"`
+}
+
+type UsageCmd struct {
+	SortBy    string   `arg:"--sort" default:"name" help:"Sort systems by name, or by roms, media, saves or total size"`
+	Format    string   `arg:"--format" default:"text" help:"Output format : text, json or csv"`
+	Output    string   `arg:"--output, -o" help:"Write the report to this file instead of the standard output"`
+	SavesDir  string   `arg:"--saves-dir" help:"Folder holding a saves folder per system default:saves next to the roms dir"`
+	MediaDirs []string `arg:"--media-dir,separate" help:"Media folder relative to the system directory (repeatable) default:media"`
+	RomsDir   []string `arg:"positional" help:"path/to/roms/dir default:/recalbox/share/roms"`
+}
+
+type HideCmd struct {
+	Patterns   []string `arg:"--pattern,separate" help:"Rom file name glob to hide, case insensitive (repeatable) default:BIOS, saves, text files and companion files"`
+	Companions bool     `arg:"--companions" help:"Also hide files referenced by a .cue, .gdi, .m3u or .ccd rom when --pattern is set"`
+	Rules      string   `arg:"--rules" help:"Json file of hide rules [{systems, patterns, companions}], replaces --pattern and --companions"`
+	DryRun     bool     `arg:"--dry-run" help:"Do not write, only list games to hide"`
+	FormatJson bool     `arg:"-f" help:"Format Json output of the backup"`
+	RomsDir    []string `arg:"positional" help:"path/to/roms/dir default:/recalbox/share/roms"`
+}
+
+type RenameCmd struct {
+	Pattern    string   `arg:"--pattern" help:"Regular expression replaced in rom names without extension, ex: \"\\s*\\(tsone\\)\""`
+	Replace    string   `arg:"--replace" help:"Replacement of --pattern, $1 expands to the first submatch"`
+	Map        string   `arg:"--map" help:"Json file of new file names by rom path relative to the system directory {\"./old.nes\": \"new.nes\"}"`
+	DryRun     bool     `arg:"--dry-run" help:"Do not rename, only list renames"`
+	FormatJson bool     `arg:"-f" help:"Format Json output of the backup"`
+	RomsDir    []string `arg:"positional" help:"path/to/roms/dir default:/recalbox/share/roms"`
+}
+
+type DiscsCmd struct {
+	DryRun     bool     `arg:"--dry-run" help:"Do not write, only list playlists to create"`
+	FormatJson bool     `arg:"-f" help:"Format Json output of the backup"`
+	RomsDir    []string `arg:"positional" help:"path/to/roms/dir default:/recalbox/share/roms"`
+}
+
+type TrashListCmd struct {
 	RomsDir []string `arg:"positional" help:"path/to/roms/dir default:/recalbox/share/roms"`
 }
 
+type TrashRestoreCmd struct {
+	Files   []string `arg:"--file,separate" help:"Trash id or original path to restore (repeatable) default:all trashed files"`
+	RomsDir []string `arg:"positional" help:"path/to/roms/dir default:/recalbox/share/roms"`
+}
+
+type TrashEmptyCmd struct {
+	OlderThan string   `arg:"--older-than" help:"Only delete files trashed for longer than this age, ex: 30d, 12h default:all trashed files"`
+	RomsDir   []string `arg:"positional" help:"path/to/roms/dir default:/recalbox/share/roms"`
+}
+
+type TrashCmd struct {
+	List    *TrashListCmd    `arg:"subcommand:list"`
+	Restore *TrashRestoreCmd `arg:"subcommand:restore"`
+	Empty   *TrashEmptyCmd   `arg:"subcommand:empty"`
+}
+
 type args struct {
-	BackupCmd  *BackupCmd  `arg:"subcommand:backup"`
-	RestoreCmd *RestoreCmd `arg:"subcommand:restore"`
-	Verbose    bool        `arg:"--verbose, -v" default:"false" help:"Print debug logs"`
-	Version    bool        `args:"--version" default:"false" help:"Print program Version"`
+	BackupCmd      *BackupCmd    `arg:"subcommand:backup"`
+	RestoreCmd     *RestoreCmd   `arg:"subcommand:restore"`
+	NormalizeCmd   *NormalizeCmd `arg:"subcommand:normalize"`
+	CleanCmd       *CleanCmd     `arg:"subcommand:clean"`
+	PruneCmd       *PruneCmd     `arg:"subcommand:prune"`
+	OrphansCmd     *OrphansCmd   `arg:"subcommand:orphans"`
+	MissingCmd     *MissingCmd   `arg:"subcommand:missing"`
+	TrashCmd       *TrashCmd     `arg:"subcommand:trash"`
+	UsageCmd       *UsageCmd     `arg:"subcommand:usage"`
+	HideCmd        *HideCmd      `arg:"subcommand:hide"`
+	RenameCmd      *RenameCmd    `arg:"subcommand:rename"`
+	DiscsCmd       *DiscsCmd     `arg:"subcommand:discs"`
+	Verbose        bool          `arg:"--verbose, -v" default:"false" help:"Print debug logs"`
+	NormalizeUTF8  bool          `arg:"--normalize-utf8" default:"false" help:"Write gamelists in UTF-8 instead of their original encoding"`
+	LogLevel       string        `arg:"--log-level" help:"Logs level (error, warn, info, debug, trace) default:info, debug with --verbose"`
+	LogFormat      string        `arg:"--log-format" default:"text" help:"Logs format (text, json)"`
+	LogFile        string        `arg:"--log-file" help:"Append logs to this file instead of stderr"`
+	Lang           string        `arg:"--lang" help:"Messages language (en, fr) default:from LANG"`
+	Jobs           int           `arg:"--jobs, -j" help:"Gamelists processed at once default:number of CPUs"`
+	Report         string        `arg:"--report" help:"Write a JSON report of the run to this file"`
+	FollowSymlinks bool          `arg:"--follow-symlinks" default:"false" help:"Walk symlinked directories, a directory reached twice is processed once"`
+	Systems        []string      `arg:"--system,separate" help:"System directory name glob to process (repeatable) default:all systems"`
+	ExcludeSystems []string      `arg:"--exclude-system,separate" help:"System directory name glob to skip (repeatable)"`
+	Games          []string      `arg:"--game,separate" help:"Rom path or file name glob of the games to process, case insensitive (repeatable) default:all games"`
+	Favorite       bool          `arg:"--favorite" default:"false" help:"Only process favorite games"`
+	PlayedSince    string        `arg:"--played-since" help:"Only process games played since this date, ex: 2022-03-04"`
+	Force          bool          `arg:"--force" default:"false" help:"Write gamelists even if EmulationStation is running"`
+	ESStop         string        `arg:"--es-stop" help:"Shell command stopping EmulationStation before writing gamelists, ex: \"/etc/init.d/S31emulationstation stop\""`
+	ESSystems      string        `arg:"--es-systems" help:"backup and restore only, es_systems.cfg giving the ROM directory of the systems whose gamelists are in --es-gamelists"`
+	ESGamelists    string        `arg:"--es-gamelists" help:"backup and restore only, directory of the <system>/gamelist.xml of the EmulationStation home layout, scanned if no directory is given, needs --es-systems default:~/.emulationstation/gamelists"`
+	ESStart        string        `arg:"--es-start" help:"Shell command starting EmulationStation once gamelists are written, ex: \"/etc/init.d/S31emulationstation start\""`
+	Version        bool          `args:"--version" default:"false" help:"Print program Version"`
 }
 
 func main() {
 
 	var args args
-	arg.MustParse(&args)
+	parser := arg.MustParse(&args)
 
 	if args.Version {
 		printVersion()
 	}
 
+	if args.Lang != "" {
+		i18n.SetLang(i18n.ParseLang(args.Lang))
+	}
+
+	// the report is started first, so a command which can not run still writes it
+	observer := recaltools.Observers()
+	if args.Report != "" {
+		reporter = recaltools.NewReporter(strings.Join(parser.SubcommandNames(), " "))
+		reportFile = args.Report
+		observer = reporter
+	}
+
+	runLogs, err := cli.NewLogger(args.LogLevel, args.LogFormat, args.LogFile, args.Verbose)
+	if err != nil {
+		fatal(err)
+	}
+	logs = runLogs
+
+	filter, err := newFilter(args)
+	if err != nil {
+		fatal(err)
+	}
+
+	layout, err := newLayout(args)
+	if err != nil {
+		fatal(err)
+	}
+
+	// settings shared by every command
+	options := recaltools.Options{
+		Verbose:        args.Verbose,
+		Logger:         logs,
+		Observer:       observer,
+		Filter:         filter,
+		Jobs:           args.Jobs,
+		FollowSymlinks: args.FollowSymlinks,
+	}
+
+	ctx := cli.InterruptContext(logs)
+	code := cli.ExitSuccess
+
+	guard := recaltools.ESGuard{Force: args.Force, StopCmd: args.ESStop, StartCmd: args.ESStart, Logger: logs}
+	// guarded runs fn, a command writing gamelists unless dryRun, once EmulationStation cannot overwrite them
+	guarded := func(dryRun bool, fn func() error) error {
+		if dryRun {
+			return fn()
+		}
+		return guard.Run(ctx, fn)
+	}
+
 	switch {
 	case args.BackupCmd != nil:
 
 		if len(args.BackupCmd.RomsDir) < 1 {
-			args.BackupCmd.RomsDir = append(args.BackupCmd.RomsDir, "/recalbox/share/roms")
+			args.BackupCmd.RomsDir = cli.DefaultRomsDir(layout, "/recalbox/share/roms")
 		}
 
 		favBkp := recaltools.FavBackup{
 			RomsDir:    args.BackupCmd.RomsDir,
 			FormatJson: args.BackupCmd.FormatJson,
-			Verbose:    args.Verbose,
+			Layout:     layout,
+			Options:    options,
 		}
-		err := favBkp.Backup()
+		progress := newProgressBar(args.LogFile == "" && logs.Enabled(logger.LevelDebug))
+		favBkp.Observer = recaltools.Observers(observer, progress.observer())
+		err := favBkp.BackupContext(ctx)
+		progress.end()
 		if err != nil {
-			log.Println(err)
+			code = failed(err)
 		}
 	case args.RestoreCmd != nil:
 
 		if len(args.RestoreCmd.RomsDir) < 1 {
-			args.RestoreCmd.RomsDir = append(args.RestoreCmd.RomsDir, "/recalbox/share/roms")
+			args.RestoreCmd.RomsDir = cli.DefaultRomsDir(layout, "/recalbox/share/roms")
 		}
 
 		favBkp := recaltools.FavBackup{
-			RomsDir:    args.RestoreCmd.RomsDir,
-			FormatJson: false,
-			Verbose:    args.Verbose,
+			RomsDir:       args.RestoreCmd.RomsDir,
+			FormatJson:    false,
+			NormalizeUTF8: args.NormalizeUTF8,
+			Stamp:         args.RestoreCmd.Stamp,
+			Layout:        layout,
+			Options:       options,
+		}
+		progress := newProgressBar(args.LogFile == "" && logs.Enabled(logger.LevelDebug))
+		favBkp.Observer = recaltools.Observers(observer, progress.observer())
+		err := guarded(false, func() error { return favBkp.RestoreContext(ctx) })
+		progress.end()
+		if err != nil {
+			code = failed(err)
+		}
+	case args.NormalizeCmd != nil:
+
+		if len(args.NormalizeCmd.RomsDir) < 1 {
+			args.NormalizeCmd.RomsDir = append(args.NormalizeCmd.RomsDir, "/recalbox/share/roms")
+		}
+
+		normalizer := recaltools.Normalizer{
+			RomsDir:       args.NormalizeCmd.RomsDir,
+			SortBy:        args.NormalizeCmd.SortBy,
+			Check:         args.NormalizeCmd.Check,
+			NormalizeUTF8: args.NormalizeUTF8,
+			Options:       options,
+		}
+		err := guarded(args.NormalizeCmd.Check, func() error { return normalizer.NormalizeContext(ctx) })
+		if err != nil {
+			code = failed(err)
+		}
+
+		for _, gamelist := range normalizer.Unnormalized {
+			fmt.Println(i18n.T(i18n.NormalizeNotValid, gamelist))
+		}
+		if len(normalizer.Unnormalized) > 0 && code == cli.ExitSuccess {
+			code = cli.ExitFailure
+		}
+	case args.CleanCmd != nil:
+
+		if len(args.CleanCmd.RomsDir) < 1 {
+			args.CleanCmd.RomsDir = append(args.CleanCmd.RomsDir, "/recalbox/share/roms")
+		}
+
+		rules := []recaltools.CleanRule{{
+			Fields: args.CleanCmd.Fields,
+			Filter: args.CleanCmd.Filter,
+		}}
+		if args.CleanCmd.Rules != "" {
+			rules = nil
+			if err := utils.ReadJsonFile(args.CleanCmd.Rules, &rules); err != nil {
+				fatal(err)
+			}
+		}
+
+		cleaner := recaltools.Cleaner{
+			RomsDir:       args.CleanCmd.RomsDir,
+			Rules:         rules,
+			Rename:        args.CleanCmd.Rename,
+			FormatJson:    args.CleanCmd.FormatJson,
+			NormalizeUTF8: args.NormalizeUTF8,
+			Options:       options,
+		}
+		err := guarded(false, func() error { return cleaner.CleanContext(ctx) })
+		if err != nil {
+			code = failed(err)
+		}
+	case args.PruneCmd != nil:
+
+		if len(args.PruneCmd.RomsDir) < 1 {
+			args.PruneCmd.RomsDir = append(args.PruneCmd.RomsDir, "/recalbox/share/roms")
+		}
+
+		pruner := recaltools.Pruner{
+			RomsDir:       args.PruneCmd.RomsDir,
+			KeepUserData:  args.PruneCmd.KeepUserData,
+			DryRun:        args.PruneCmd.DryRun,
+			FormatJson:    args.PruneCmd.FormatJson,
+			NormalizeUTF8: args.NormalizeUTF8,
+			Options:       options,
+		}
+		err := guarded(args.PruneCmd.DryRun, func() error { return pruner.PruneContext(ctx) })
+		if err != nil {
+			code = failed(err)
+		}
+
+		if args.PruneCmd.DryRun {
+			for _, rom := range pruner.Pruned {
+				fmt.Println(i18n.T(i18n.PruneRom, rom))
+			}
+		}
+	case args.OrphansCmd != nil:
+
+		if len(args.OrphansCmd.RomsDir) < 1 {
+			args.OrphansCmd.RomsDir = append(args.OrphansCmd.RomsDir, "/recalbox/share/roms")
+		}
+
+		mediaCleaner := recaltools.MediaCleaner{
+			RomsDir:    args.OrphansCmd.RomsDir,
+			MediaDirs:  args.OrphansCmd.MediaDirs,
+			Quarantine: args.OrphansCmd.Quarantine,
+			Options:    options,
+		}
+
+		var err error
+		switch {
+		case args.OrphansCmd.Restore:
+			err = mediaCleaner.RestoreQuarantineContext(ctx)
+		case args.OrphansCmd.Empty:
+			err = mediaCleaner.EmptyQuarantineContext(ctx)
+		default:
+			err = mediaCleaner.FindOrphansContext(ctx)
+			for _, orphan := range mediaCleaner.Orphans {
+				fmt.Println(i18n.T(i18n.OrphansFile, orphan.Path, utils.HumanSize(orphan.Size)))
+			}
+		}
+		if err != nil {
+			code = failed(err)
+		}
+	case args.MissingCmd != nil:
+
+		if len(args.MissingCmd.RomsDir) < 1 {
+			args.MissingCmd.RomsDir = append(args.MissingCmd.RomsDir, "/recalbox/share/roms")
+		}
+
+		mediaLinker := recaltools.MediaLinker{
+			RomsDir:       args.MissingCmd.RomsDir,
+			MediaDirs:     args.MissingCmd.MediaDirs,
+			Relink:        args.MissingCmd.Relink,
+			NormalizeUTF8: args.NormalizeUTF8,
+			Options:       options,
+		}
+		err := guarded(!args.MissingCmd.Relink, func() error { return mediaLinker.FindMissingContext(ctx) })
+		if err != nil {
+			code = failed(err)
+		}
+
+		for _, missing := range mediaLinker.Missing {
+			if missing.Relinked == "" {
+				fmt.Println(i18n.T(i18n.MissingFile, missing.Path, missing.Field, missing.RomPath))
+			}
+		}
+	case args.HideCmd != nil:
+
+		var rules []recaltools.HideRule
+		switch {
+		case args.HideCmd.Rules != "":
+			if err := utils.ReadJsonFile(args.HideCmd.Rules, &rules); err != nil {
+				fatal(err)
+			}
+		case len(args.HideCmd.Patterns) > 0 || args.HideCmd.Companions:
+			rules = []recaltools.HideRule{{
+				Patterns:   args.HideCmd.Patterns,
+				Companions: args.HideCmd.Companions,
+			}}
+		}
+
+		hider := recaltools.Hider{
+			RomsDir:       defaultRomsDir(args.HideCmd.RomsDir),
+			Rules:         rules,
+			DryRun:        args.HideCmd.DryRun,
+			FormatJson:    args.HideCmd.FormatJson,
+			NormalizeUTF8: args.NormalizeUTF8,
+			Options:       options,
+		}
+		err := guarded(args.HideCmd.DryRun, func() error { return hider.HideContext(ctx) })
+		if args.HideCmd.DryRun {
+			for _, rom := range hider.Hidden {
+				fmt.Println(rom)
+			}
 		}
-		err := favBkp.Restore()
 		if err != nil {
-			log.Println(err)
+			code = failed(err)
+		}
+	case args.RenameCmd != nil:
+
+		var names map[string]string
+		if args.RenameCmd.Map != "" {
+			if err := utils.ReadJsonFile(args.RenameCmd.Map, &names); err != nil {
+				fatal(err)
+			}
+		}
+
+		renamer := recaltools.Renamer{
+			RomsDir:       defaultRomsDir(args.RenameCmd.RomsDir),
+			Names:         names,
+			Pattern:       args.RenameCmd.Pattern,
+			Replace:       args.RenameCmd.Replace,
+			DryRun:        args.RenameCmd.DryRun,
+			FormatJson:    args.RenameCmd.FormatJson,
+			NormalizeUTF8: args.NormalizeUTF8,
+			Options:       options,
+		}
+		err := guarded(args.RenameCmd.DryRun, func() error { return renamer.RenameContext(ctx) })
+		if args.RenameCmd.DryRun {
+			for _, rom := range renamer.Renamed {
+				fmt.Println(i18n.T(i18n.RenameRom, rom.From, rom.To))
+			}
+		}
+		if err != nil {
+			code = failed(err)
+		}
+	case args.DiscsCmd != nil:
+
+		discGrouper := recaltools.DiscGrouper{
+			RomsDir:       defaultRomsDir(args.DiscsCmd.RomsDir),
+			DryRun:        args.DiscsCmd.DryRun,
+			FormatJson:    args.DiscsCmd.FormatJson,
+			NormalizeUTF8: args.NormalizeUTF8,
+			Options:       options,
+		}
+		err := guarded(args.DiscsCmd.DryRun, func() error { return discGrouper.GroupContext(ctx) })
+		if args.DiscsCmd.DryRun {
+			for _, playlist := range discGrouper.Playlists {
+				fmt.Println(i18n.T(i18n.DiscsPlaylist, filepath.Join(filepath.Dir(playlist.Gamelist), playlist.Path), len(playlist.Discs)))
+			}
+		}
+		if err != nil {
+			code = failed(err)
+		}
+	case args.UsageCmd != nil:
+
+		switch args.UsageCmd.Format {
+		case "text", "json", "csv":
+		default:
+			fatal(i18n.NewError(i18n.UsageFormatInvalid, nil, args.UsageCmd.Format))
 		}
+
+		usageReporter := recaltools.UsageReporter{
+			RomsDir:   defaultRomsDir(args.UsageCmd.RomsDir),
+			MediaDirs: args.UsageCmd.MediaDirs,
+			SavesDir:  args.UsageCmd.SavesDir,
+			SortBy:    args.UsageCmd.SortBy,
+			Options:   options,
+		}
+		if err := usageReporter.UsageContext(ctx); err != nil {
+			code = failed(err)
+		}
+
+		out := os.Stdout
+		if args.UsageCmd.Output != "" {
+			f, err := os.Create(args.UsageCmd.Output)
+			if err != nil {
+				fatal(i18n.NewError(i18n.FileWrite, err, args.UsageCmd.Output))
+			}
+			defer f.Close()
+			out = f
+		}
+
+		var err error
+		switch args.UsageCmd.Format {
+		case "json":
+			err = usageReporter.WriteJson(out, true)
+		case "csv":
+			err = usageReporter.WriteCsv(out)
+		default:
+			fmt.Fprintln(out, i18n.T(i18n.UsageFormat, "system", "roms", "media", "saves", "total"))
+			for _, usage := range append(usageReporter.Systems, usageReporter.Total()) {
+				fmt.Fprintln(out, i18n.T(i18n.UsageFormat, usage.System, utils.HumanSize(usage.Roms), utils.HumanSize(usage.Media), utils.HumanSize(usage.Saves), utils.HumanSize(usage.Total)))
+			}
+		}
+		if err != nil {
+			code = failed(err)
+		}
+	case args.TrashCmd != nil:
+
+		switch {
+		case args.TrashCmd.Restore != nil:
+			for _, romsdir := range defaultRomsDir(args.TrashCmd.Restore.RomsDir) {
+				if ctx.Err() != nil {
+					break
+				}
+				restored, err := trash.ForRomsDir(romsdir).RestoreContext(ctx, args.TrashCmd.Restore.Files...)
+				for _, entry := range restored {
+					logs.Info(i18n.T(i18n.TrashRestored, entry.Path))
+				}
+				if err != nil {
+					code = failed(err)
+				}
+			}
+		case args.TrashCmd.Empty != nil:
+			var olderThan time.Duration
+			if args.TrashCmd.Empty.OlderThan != "" {
+				var err error
+				if olderThan, err = trash.ParseAge(args.TrashCmd.Empty.OlderThan); err != nil {
+					fatal(err)
+				}
+			}
+			for _, romsdir := range defaultRomsDir(args.TrashCmd.Empty.RomsDir) {
+				if ctx.Err() != nil {
+					break
+				}
+				deleted, err := trash.ForRomsDir(romsdir).EmptyContext(ctx, olderThan)
+				for _, entry := range deleted {
+					logs.Debug(i18n.T(i18n.TrashDeleted, entry.Path))
+				}
+				if err != nil {
+					code = failed(err)
+				}
+			}
+		default:
+			var romsDir []string
+			if args.TrashCmd.List != nil {
+				romsDir = args.TrashCmd.List.RomsDir
+			}
+			var count int
+			var size int64
+			for _, romsdir := range defaultRomsDir(romsDir) {
+				entries, err := trash.ForRomsDir(romsdir).List()
+				if err != nil {
+					code = failed(err)
+					continue
+				}
+				for _, entry := range entries {
+					fmt.Println(i18n.T(i18n.TrashEntry, entry.Date.Format("2006-01-02 15:04:05"), entry.ID, entry.Path, utils.HumanSize(entry.Size)))
+					count++
+					size += entry.Size
+				}
+			}
+			logs.Info(i18n.T(i18n.TrashDone, count, utils.HumanSize(size)))
+		}
+	}
+
+	// a run receiving a signal is interrupted, in its report too
+	if err := writeReport(cli.Interrupted(ctx, runErr)); err != nil {
+		code = failed(err)
 	}
+	if ctx.Err() != nil {
+		code = cli.ExitInterrupted
+	}
+	os.Exit(code)
+}
+
+// runErr is the error of the command, for the report
+var runErr error
+
+// reporter builds the report written to reportFile, nil without --report
+var (
+	reporter   *recaltools.Reporter
+	reportFile string
+)
 
+// writeReport writes the report of the run ended with err, if --report is set
+func writeReport(err error) error {
+	if reporter == nil {
+		return nil
+	}
+	return utils.WriteJsonFile(reportFile, reporter.Report(err), true)
+}
+
+// failed logs err, keeps it for the report and returns the matching exit code
+func failed(err error) int {
+	logs.Error(err.Error())
+	if runErr == nil {
+		runErr = err
+	}
+	return cli.ExitCode(err)
+}
+
+// newFilter returns the systems and games filter set by the filter flags
+func newFilter(args args) (recaltools.Filter, error) {
+	filter := recaltools.Filter{
+		Systems:        args.Systems,
+		ExcludeSystems: args.ExcludeSystems,
+		Games:          args.Games,
+		FavoriteOnly:   args.Favorite,
+	}
+	if args.PlayedSince != "" {
+		var err error
+		if filter.PlayedSince, err = recaltools.ParseDate(args.PlayedSince); err != nil {
+			return filter, err
+		}
+	}
+	return filter, filter.Validate()
+}
+
+// newLayout returns the gamelists layout set by the layout flags, nil for the ROM directory layout.
+// Only backup and restore follow a layout, other commands refuse the layout flags.
+func newLayout(args args) (recaltools.Layout, error) {
+	if (args.ESSystems != "" || args.ESGamelists != "") && args.BackupCmd == nil && args.RestoreCmd == nil {
+		return nil, i18n.NewError(i18n.LayoutBackupRestore, nil)
+	}
+	return cli.NewLayout(args.ESSystems, args.ESGamelists)
+}
+
+// fatal logs err, writes the report of the failed run and exits
+func fatal(err error) {
+	logs.Error(err.Error())
+	if err := writeReport(err); err != nil {
+		logs.Error(err.Error())
+	}
+	os.Exit(cli.ExitFailure)
+}
+
+// defaultRomsDir returns the Recalbox roms directory if none is given
+func defaultRomsDir(romsDir []string) []string {
+	if len(romsDir) < 1 {
+		return []string{"/recalbox/share/roms"}
+	}
+	return romsDir
 }
 
 // printVersion prints the tool name, build commit, build version, and build date
@@ -0,0 +1,93 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	"github.com/jymannob/recaltools"
+	"github.com/jymannob/recaltools/i18n"
+)
+
+const progressWidth = 30
+
+// progressBar draws the gamelists done out of the gamelists found on a single line
+type progressBar struct {
+	recaltools.NopObserver
+	out    io.Writer
+	mu     sync.Mutex
+	total  int
+	done   int
+	failed int
+	games  int
+}
+
+// newProgressBar returns a progress bar when stdout is a terminal and debug logs are not written to stderr, nil otherwise
+func newProgressBar(debugOnStderr bool) *progressBar {
+	info, err := os.Stdout.Stat()
+	if debugOnStderr || err != nil || info.Mode()&os.ModeCharDevice == 0 {
+		return nil
+	}
+	return &progressBar{out: os.Stdout}
+}
+
+// observer returns the progress bar as an Observer, nil if there is none
+func (p *progressBar) observer() recaltools.Observer {
+	if p == nil {
+		return nil
+	}
+	return p
+}
+
+// end ends the line of an interrupted run
+func (p *progressBar) end() {
+	if p == nil {
+		return
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.done > 0 && p.done < p.total {
+		fmt.Fprintln(p.out)
+	}
+}
+
+func (p *progressBar) SystemDiscovered(gamelist string) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.total++
+}
+
+func (p *progressBar) SystemFinished(gamelist string, games int) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.done++
+	p.games += games
+	p.draw(gamelist)
+}
+
+func (p *progressBar) Error(gamelist string, err error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.done++
+	p.failed++
+	p.draw(gamelist)
+}
+
+// draw rewrites the line, and ends it once every gamelist is done
+func (p *progressBar) draw(gamelist string) {
+	filled := progressWidth
+	if p.total > 0 {
+		filled = progressWidth * p.done / p.total
+	}
+	system := filepath.Base(filepath.Dir(gamelist))
+
+	bar := strings.Repeat("#", filled) + strings.Repeat("-", progressWidth-filled)
+
+	fmt.Fprint(p.out, "\r\033[K"+i18n.T(i18n.Progress, bar, p.done, p.total, system, p.games, p.failed))
+	if p.done == p.total {
+		fmt.Fprintln(p.out)
+	}
+}
@@ -0,0 +1,277 @@
+package recaltools
+
+import (
+	"context"
+	"fmt"
+	"path"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/antchfx/xmlquery"
+	"github.com/jymannob/recaltools/i18n"
+	"github.com/jymannob/recaltools/logger"
+	"github.com/jymannob/recaltools/vfs"
+	"github.com/jymannob/recaltools/xml"
+)
+
+// DiscGrouper groups the discs of multi-disc games in a .m3u playlist. The playlist gets a `game` entry
+// merging the discs data and the discs entries are hidden. Only system filters apply.
+type DiscGrouper struct {
+	RomsDir       []string
+	DryRun        bool // do not write, only list playlists to create
+	FormatJson    bool
+	NormalizeUTF8 bool
+	Playlists     []DiscPlaylist
+	Options
+	mu sync.Mutex
+}
+
+// DiscPlaylist is a .m3u playlist of the discs of a game, paths as written in the gamelist
+type DiscPlaylist struct {
+	Gamelist string   `json:"gamelist"`
+	Path     string   `json:"path"`
+	Discs    []string `json:"discs"`
+}
+
+// disc is a `game` entry of a multi-disc game
+type disc struct {
+	node   *xmlquery.Node
+	path   string
+	number int
+}
+
+// discTags match the disc number of a rom name : `(Disc 1)`, `[CD2]`, `(Disk 2 of 3)`, `(Disc B)`, `- Disc 1`
+var discTags = []*regexp.Regexp{
+	regexp.MustCompile(`(?i)\s*[\(\[]\s*(?:disc|disk|cd)\s*([0-9]+|[a-z])(?:\s*of\s*[0-9]+)?\s*[\)\]]`),
+	regexp.MustCompile(`(?i)[\s_]*-?[\s_]*(?:disc|disk)[\s_]*([0-9]+)$`),
+}
+
+// discNumber returns the name without its disc tag and the disc number, 0 if the name has no disc tag
+func discNumber(name string) (string, int) {
+	for _, tag := range discTags {
+		match := tag.FindStringSubmatchIndex(name)
+		if match == nil {
+			continue
+		}
+		number := name[match[2]:match[3]]
+		n, err := strconv.Atoi(number)
+		if err != nil {
+			n = int(strings.ToLower(number)[0]-'a') + 1
+		}
+		title := strings.Join(strings.Fields(name[:match[0]]+" "+name[match[1]:]), " ")
+		return title, n
+	}
+	return name, 0
+}
+
+// Group creates a playlist for each multi-disc game, then backs up the gamelists to record hidden discs
+func (d *DiscGrouper) Group() error {
+	return d.GroupContext(context.Background())
+}
+
+// GroupContext is Group stopping to start new gamelists once ctx is done
+func (d *DiscGrouper) GroupContext(ctx context.Context) error {
+
+	gamelists, err := d.scanner().Scan(d.RomsDir)
+	if err != nil {
+		return err
+	}
+
+	err = forEach(ctx, d.Jobs, gamelists, observed(d.observer(), gamelists, d.groupSystem))
+	sort.Slice(d.Playlists, func(i, j int) bool {
+		if d.Playlists[i].Gamelist != d.Playlists[j].Gamelist {
+			return d.Playlists[i].Gamelist < d.Playlists[j].Gamelist
+		}
+		return d.Playlists[i].Path < d.Playlists[j].Path
+	})
+	if err != nil {
+		return err
+	}
+
+	d.log().Info(i18n.T(i18n.DiscsDone, len(d.Playlists)))
+	if d.DryRun || len(d.Playlists) == 0 {
+		return nil
+	}
+
+	fb := FavBackup{
+		RomsDir:    d.RomsDir,
+		FormatJson: d.FormatJson,
+		Options:    d.backupOptions(),
+	}
+	return fb.BackupContext(ctx)
+}
+
+func (d *DiscGrouper) groupSystem(gamelist string) (int, error) {
+
+	systemPath := filepath.Dir(gamelist)
+
+	doc, enc, err := vfs.ReadXml(d.fs(), gamelist)
+	if err != nil {
+		return 0, err
+	}
+
+	nodes := xmlquery.Find(doc, "//game")
+	companions := companionFiles(d.fs(), systemPath, nodes, d.log())
+	idx := xml.NewIndex(doc)
+
+	// group discs by folder and title
+	groups := make(map[string][]disc)
+	for _, node := range nodes {
+		romPath := childText(node, "path")
+		if romPath == "" || strings.EqualFold(path.Ext(romPath), ".m3u") || companions[resolvePath(systemPath, romPath)] {
+			continue
+		}
+		title, number := discNumber(strings.TrimSuffix(path.Base(romPath), path.Ext(romPath)))
+		if number == 0 {
+			continue
+		}
+		key := path.Join(path.Dir(romPath), strings.ToLower(title))
+		groups[key] = append(groups[key], disc{node: node, path: romPath, number: number})
+	}
+
+	keys := make([]string, 0, len(groups))
+	for key := range groups {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	var playlists []DiscPlaylist
+	var written []string
+	for _, key := range keys {
+		discs := groups[key]
+		if len(discs) < 2 {
+			continue
+		}
+		sort.SliceStable(discs, func(i, j int) bool { return discs[i].number < discs[j].number })
+
+		title, _ := discNumber(strings.TrimSuffix(path.Base(discs[0].path), path.Ext(discs[0].path)))
+		playlist := DiscPlaylist{Gamelist: gamelist, Path: replaceBase(discs[0].path, title+".m3u")}
+		for _, disc := range discs {
+			playlist.Discs = append(playlist.Discs, disc.path)
+		}
+		if idx.ByPath(playlist.Path) != nil {
+			continue // already grouped
+		}
+
+		d.log().Debug(i18n.T(i18n.DiscsPlaylist, playlist.Path, len(discs)), logger.System(gamelist))
+		playlists = append(playlists, playlist)
+		if d.DryRun {
+			continue
+		}
+
+		m3u := resolvePath(systemPath, playlist.Path)
+		if _, err := d.fs().Stat(m3u); err != nil {
+			if err := writePlaylist(d.fs(), m3u, playlist.Discs); err != nil {
+				d.log().Warn(err.Error(), logger.System(gamelist))
+				continue
+			}
+			written = append(written, m3u)
+		}
+
+		entry := mergeDiscs(playlist.Path, discs)
+		xmlquery.AddChild(discs[0].node.Parent, entry)
+		idx.Add(entry)
+		for _, disc := range discs {
+			xml.ReplaceChildNode(disc.node, xml.NewNode("hidden", "true"))
+		}
+	}
+
+	if len(playlists) == 0 {
+		return 0, nil
+	}
+	if d.DryRun {
+		d.addPlaylists(playlists)
+		return 0, nil
+	}
+
+	if d.NormalizeUTF8 {
+		enc = xml.UTF8
+	}
+	if err := vfs.WriteXml(d.fs(), gamelist, doc, enc); err != nil {
+		for _, m3u := range written {
+			d.fs().Remove(m3u)
+		}
+		return 0, err
+	}
+	for _, m3u := range written {
+		d.observer().FileWritten(gamelist, m3u)
+	}
+	d.observer().FileWritten(gamelist, gamelist)
+	// games are grouped once written
+	for _, playlist := range playlists {
+		d.observer().GameUpdated(gamelist, playlist.Path)
+	}
+
+	d.addPlaylists(playlists)
+	return len(playlists), nil
+}
+
+func (d *DiscGrouper) addPlaylists(playlists []DiscPlaylist) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.Playlists = append(d.Playlists, playlists...)
+}
+
+// writePlaylist writes a .m3u listing the discs relative to its folder
+func writePlaylist(fsys vfs.FS, m3u string, discs []string) error {
+	var content strings.Builder
+	for _, disc := range discs {
+		fmt.Fprintln(&content, path.Base(disc))
+	}
+	return vfs.WriteFile(fsys, m3u, []byte(content.String()))
+}
+
+// discFields are the `game` elements describing the disc file, not the game, they are not merged
+var discFields = map[string]bool{"path": true, "hidden": true, "hash": true, "md5": true, "crc32": true}
+
+// mergeDiscs returns the `game` entry of the playlist : scraped fields of the first disc having them,
+// favorite if a disc is, summed playcount and latest lastplayed
+func mergeDiscs(playlistPath string, discs []disc) *xmlquery.Node {
+	entry := &xmlquery.Node{Type: xmlquery.ElementNode, Data: "game"}
+	xmlquery.AddChild(entry, xml.NewNode("path", playlistPath))
+
+	playcount := 0
+	for _, disc := range discs {
+		for _, attr := range disc.node.Attr {
+			if entry.SelectAttr(attr.Name.Local) == "" {
+				xmlquery.AddAttr(entry, attr.Name.Local, attr.Value)
+			}
+		}
+
+		for field := disc.node.FirstChild; field != nil; field = field.NextSibling {
+			if field.Type != xmlquery.ElementNode || discFields[field.Data] {
+				continue
+			}
+			value := strings.TrimSpace(field.InnerText())
+			current := entry.SelectElement(field.Data)
+
+			switch {
+			case field.Data == "playcount":
+				n, _ := strconv.Atoi(value)
+				playcount += n
+			case field.Data == "name":
+				if current == nil {
+					name, _ := discNumber(value)
+					xmlquery.AddChild(entry, xml.NewNode("name", name))
+				}
+			case current == nil:
+				if value != "" {
+					xmlquery.AddChild(entry, xml.NewNode(field.Data, value))
+				}
+			case userFields[field.Data]:
+				if userValueWins(field.Data, value, strings.TrimSpace(current.InnerText())) {
+					xml.SetText(current, value)
+				}
+			}
+		}
+	}
+
+	if playcount > 0 {
+		xmlquery.AddChild(entry, xml.NewNode("playcount", strconv.Itoa(playcount)))
+	}
+	return entry
+}
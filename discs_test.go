@@ -0,0 +1,176 @@
+package recaltools
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/jymannob/recaltools/utils"
+	"github.com/jymannob/recaltools/xml"
+)
+
+func Test_discNumber(t *testing.T) {
+	tests := []struct {
+		name   string
+		title  string
+		number int
+	}{
+		{"Final Fantasy VII (USA) (Disc 1)", "Final Fantasy VII (USA)", 1},
+		{"Metal Gear Solid (Europe) (Disc 2 of 2) (En,Fr)", "Metal Gear Solid (Europe) (En,Fr)", 2},
+		{"Riven [CD3]", "Riven", 3},
+		{"Policenauts (Disk B)", "Policenauts", 2},
+		{"Myst - Disc 2", "Myst", 2},
+		{"Discworld (Europe)", "Discworld (Europe)", 0},
+		{"Compact (Track 1)", "Compact (Track 1)", 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			title, number := discNumber(tt.name)
+			if title != tt.title || number != tt.number {
+				t.Errorf("discNumber() = %q, %d, want %q, %d", title, number, tt.title, tt.number)
+			}
+		})
+	}
+}
+
+// Functional testing
+func TestDiscGrouper(t *testing.T) {
+	romsDir := t.TempDir()
+	systemPath := filepath.Join(romsDir, "psx")
+
+	for _, file := range []string{
+		"FF7 (USA) (Disc 1).chd",
+		"FF7 (USA) (Disc 2).chd",
+		"FF7 (USA) (Disc 3).chd",
+		"Riven (Disc 1).cue",
+		"Riven (Disc 1) (Track 1).bin",
+		"Single (Disc 1).chd",
+	} {
+		content := ""
+		if file == "Riven (Disc 1).cue" {
+			content = "FILE \"Riven (Disc 1) (Track 1).bin\" BINARY\n"
+		}
+		os.MkdirAll(systemPath, 0775)
+		if err := os.WriteFile(filepath.Join(systemPath, file), []byte(content), 0664); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	gamelist := `<?xml version="1.0"?>
+<gameList>
+  <game source="ScreenScraper">
+    <path>./FF7 (USA) (Disc 2).chd</path>
+    <name>Final Fantasy VII (Disc 2)</name>
+    <playcount>3</playcount>
+    <lastplayed>20220101T120000</lastplayed>
+  </game>
+  <game source="ScreenScraper">
+    <path>./FF7 (USA) (Disc 1).chd</path>
+    <name>Final Fantasy VII (Disc 1)</name>
+    <hash>1A2B3C4D</hash>
+    <desc>A story</desc>
+    <image>./media/images/ff7.png</image>
+    <playcount>2</playcount>
+    <lastplayed>20210101T120000</lastplayed>
+  </game>
+  <game>
+    <path>./FF7 (USA) (Disc 3).chd</path>
+    <name>Final Fantasy VII (Disc 3)</name>
+    <genre>RPG</genre>
+    <favorite>true</favorite>
+  </game>
+  <game><path>./Riven (Disc 1).cue</path><name>Riven</name></game>
+  <game><path>./Riven (Disc 1) (Track 1).bin</path><name>Riven track</name></game>
+  <game><path>./Single (Disc 1).chd</path><name>Single</name></game>
+</gameList>
+`
+	if err := os.WriteFile(filepath.Join(systemPath, "gamelist.xml"), []byte(gamelist), 0664); err != nil {
+		t.Fatal(err)
+	}
+
+	want := []DiscPlaylist{{
+		Gamelist: filepath.Join(systemPath, "gamelist.xml"),
+		Path:     "./FF7 (USA).m3u",
+		Discs:    []string{"./FF7 (USA) (Disc 1).chd", "./FF7 (USA) (Disc 2).chd", "./FF7 (USA) (Disc 3).chd"},
+	}}
+
+	// dry run
+	d := &DiscGrouper{RomsDir: []string{romsDir}, DryRun: true}
+	if err := d.Group(); err != nil {
+		t.Fatalf("DiscGrouper.Group() error = %v", err)
+	}
+	if !reflect.DeepEqual(d.Playlists, want) {
+		t.Errorf("DiscGrouper.Playlists = %+v, want %+v", d.Playlists, want)
+	}
+	assertExist(t, "dry run", filepath.Join(systemPath, "FF7 (USA).m3u"), false)
+
+	d = &DiscGrouper{RomsDir: []string{romsDir}}
+	if err := d.Group(); err != nil {
+		t.Fatalf("DiscGrouper.Group() error = %v", err)
+	}
+	if !reflect.DeepEqual(d.Playlists, want) {
+		t.Errorf("DiscGrouper.Playlists = %+v, want %+v", d.Playlists, want)
+	}
+
+	data, err := os.ReadFile(filepath.Join(systemPath, "FF7 (USA).m3u"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := string(data); got != "FF7 (USA) (Disc 1).chd\nFF7 (USA) (Disc 2).chd\nFF7 (USA) (Disc 3).chd\n" {
+		t.Errorf("playlist = %q", got)
+	}
+
+	doc, err := xml.OpenXml(filepath.Join(systemPath, "gamelist.xml"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	idx := xml.NewIndex(doc)
+	entry := idx.ByPath("./FF7 (USA).m3u")
+	if entry == nil {
+		t.Fatalf("playlist entry not added")
+	}
+	for field, value := range map[string]string{
+		"name":       "Final Fantasy VII",
+		"desc":       "A story",
+		"image":      "./media/images/ff7.png",
+		"genre":      "RPG",
+		"favorite":   "true",
+		"playcount":  "5",
+		"lastplayed": "20220101T120000",
+		"hidden":     "",
+		"hash":       "",
+	} {
+		if got := childText(entry, field); got != value {
+			t.Errorf("playlist %s = %q, want %q", field, got, value)
+		}
+	}
+	if got := entry.SelectAttr("source"); got != "ScreenScraper" {
+		t.Errorf("playlist source = %q, want ScreenScraper", got)
+	}
+	for _, disc := range want[0].Discs {
+		if got := childText(idx.ByPath(disc), "hidden"); got != "true" {
+			t.Errorf("%s hidden = %q, want true", disc, got)
+		}
+	}
+	if got := childText(idx.ByPath("./Single (Disc 1).chd"), "hidden"); got != "" {
+		t.Errorf("single disc hidden = %q", got)
+	}
+
+	var backup SystemBackup
+	if err := utils.ReadJsonFile(filepath.Join(systemPath, fileBackupName), &backup); err != nil {
+		t.Fatal(err)
+	}
+	if g := backup.Games["./FF7 (USA) (Disc 3).chd"]; g == nil || !g.Hidden {
+		t.Errorf("backup of hidden disc = %+v", g)
+	}
+
+	// already grouped
+	d = &DiscGrouper{RomsDir: []string{romsDir}}
+	if err := d.Group(); err != nil {
+		t.Fatalf("DiscGrouper.Group() error = %v", err)
+	}
+	if len(d.Playlists) != 0 {
+		t.Errorf("DiscGrouper.Playlists = %+v, want none", d.Playlists)
+	}
+}
@@ -0,0 +1,186 @@
+package recaltools
+
+import (
+	"context"
+	"io/fs"
+	"os"
+	"os/exec"
+	"path"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/jymannob/recaltools/i18n"
+	"github.com/jymannob/recaltools/logger"
+)
+
+// ESProcessName is the name of the EmulationStation process
+const ESProcessName = "emulationstation"
+
+// ProcessFinder finds a running process by name
+type ProcessFinder interface {
+	Find(name string) (pid int, err error) // pid is 0 if the process is not running
+}
+
+// Proc finds processes in a proc filesystem
+type Proc struct {
+	FS fs.FS // proc filesystem, /proc if nil
+}
+
+// Find returns the pid of the first process whose executable is named name, 0 if none
+func (p Proc) Find(name string) (int, error) {
+	procFS := p.FS
+	if procFS == nil {
+		procFS = os.DirFS("/proc")
+	}
+
+	entries, err := fs.ReadDir(procFS, ".")
+	if err != nil {
+		return 0, i18n.NewError(i18n.FileRead, err, "/proc")
+	}
+
+	for _, entry := range entries {
+		pid, err := strconv.Atoi(entry.Name())
+		if err != nil || !entry.IsDir() {
+			continue
+		}
+		// processes may exit while they are read
+		if processName(procFS, entry.Name()) == name {
+			return pid, nil
+		}
+	}
+	return 0, nil
+}
+
+// processName returns the executable name of the process pid, "" if it cannot be read
+func processName(procFS fs.FS, pid string) string {
+	// comm is truncated to 15 characters, the command line is not
+	if cmdline, err := fs.ReadFile(procFS, path.Join(pid, "cmdline")); err == nil && len(cmdline) > 0 {
+		argv0 := strings.SplitN(string(cmdline), "\x00", 2)[0]
+		return path.Base(argv0)
+	}
+	comm, err := fs.ReadFile(procFS, path.Join(pid, "comm"))
+	if err != nil {
+		return ""
+	}
+	return strings.TrimSpace(string(comm))
+}
+
+// ESGuard keeps EmulationStation from overwriting the gamelists being written,
+// it rewrites them from memory when it exits.
+type ESGuard struct {
+	Processes   ProcessFinder // finds EmulationStation, Proc if nil
+	Force       bool          // write even if EmulationStation is running
+	StopCmd     string        // shell command stopping EmulationStation before writing, refuse to write if empty
+	StartCmd    string        // shell command starting EmulationStation again once written
+	StopTimeout time.Duration // wait for EmulationStation to exit after StopCmd, DefaultStopTimeout if 0
+	Logger      logger.Logger // text logs on stderr if nil
+}
+
+// DefaultStopTimeout is the time EmulationStation is waited for after StopCmd when StopTimeout is not set
+var DefaultStopTimeout = 30 * time.Second
+
+// interval between two checks of EmulationStation exit
+var esPollInterval = 200 * time.Millisecond
+
+func (g *ESGuard) processes() ProcessFinder {
+	if g.Processes == nil {
+		return Proc{}
+	}
+	return g.Processes
+}
+
+func (g *ESGuard) log() logger.Logger {
+	return defaultLogger(g.Logger, false)
+}
+
+// Run calls write once EmulationStation is not running. A running EmulationStation is stopped with StopCmd
+// and started again with StartCmd once stopped, if StopCmd is not set write is not called unless Force.
+// When the processes can not be listed, write is only called if Force.
+func (g *ESGuard) Run(ctx context.Context, write func() error) (err error) {
+
+	pid, err := g.processes().Find(ESProcessName)
+	if err != nil {
+		if !g.Force {
+			return i18n.NewError(i18n.ESUnknown, err)
+		}
+		g.log().Warn(i18n.NewError(i18n.ESUnknownForced, err).Error())
+		return write()
+	}
+	if pid == 0 {
+		return write()
+	}
+
+	if g.StopCmd == "" {
+		if !g.Force {
+			return i18n.NewError(i18n.ESRunning, nil, pid)
+		}
+		g.log().Warn(i18n.T(i18n.ESForced, pid))
+		return write()
+	}
+
+	g.log().Info(i18n.T(i18n.ESStop, pid))
+	if err := g.shell(ctx, g.StopCmd); err != nil {
+		return i18n.NewError(i18n.ESStopFailed, err, g.StopCmd)
+	}
+	if g.StartCmd != "" {
+		// start it again on every path once stopped, even if the run has been interrupted
+		defer func() { err = g.start(err) }()
+	}
+
+	if pid, err = g.waitExit(ctx); err != nil {
+		return err
+	}
+	if pid != 0 {
+		if !g.Force {
+			return i18n.NewError(i18n.ESRunning, nil, pid)
+		}
+		g.log().Warn(i18n.T(i18n.ESForced, pid))
+	}
+
+	return write()
+}
+
+// start runs StartCmd after a run ended with err, its failure is returned unless the run failed
+func (g *ESGuard) start(err error) error {
+	g.log().Info(i18n.T(i18n.ESStart))
+	if startErr := g.shell(context.Background(), g.StartCmd); startErr != nil {
+		startErr = i18n.NewError(i18n.ESStartFailed, startErr, g.StartCmd)
+		if err != nil {
+			g.log().Error(startErr.Error())
+			return err
+		}
+		return startErr
+	}
+	return err
+}
+
+// waitExit waits for EmulationStation to exit, it returns its pid if it is still running after StopTimeout
+func (g *ESGuard) waitExit(ctx context.Context) (int, error) {
+	timeout := g.StopTimeout
+	if timeout == 0 {
+		timeout = DefaultStopTimeout
+	}
+	deadline := time.Now().Add(timeout)
+
+	for {
+		pid, err := g.processes().Find(ESProcessName)
+		if err != nil || pid == 0 || time.Now().After(deadline) {
+			return pid, err
+		}
+		select {
+		case <-ctx.Done():
+			return pid, ctx.Err()
+		case <-time.After(esPollInterval):
+		}
+	}
+}
+
+// shell runs the command with sh, its output is logged at debug level
+func (g *ESGuard) shell(ctx context.Context, command string) error {
+	out, err := exec.CommandContext(ctx, "sh", "-c", command).CombinedOutput()
+	if len(out) > 0 {
+		g.log().Debug(strings.TrimSpace(string(out)))
+	}
+	return err
+}
@@ -0,0 +1,160 @@
+package recaltools
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+	"time"
+
+	"github.com/jymannob/recaltools/i18n"
+	"github.com/jymannob/recaltools/vfs"
+)
+
+func TestProc_Find(t *testing.T) {
+	proc := vfs.NewMem()
+	for name, data := range map[string]string{
+		"1/cmdline":  "/sbin/init\x00",
+		"1/comm":     "init\n",
+		"42/cmdline": "/usr/bin/emulationstation\x00--windowed\x00",
+		"42/comm":    "emulationstatio\n",
+		"43/comm":    "kworker/0:1\n",
+		"self/comm":  "recaltools\n",
+		"version":    "Linux",
+	} {
+		if err := proc.WriteFile(name, []byte(data)); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	for name, want := range map[string]int{ESProcessName: 42, "kworker/0:1": 43, "recaltools": 0, "retroarch": 0} {
+		pid, err := Proc{FS: proc}.Find(name)
+		if err != nil || pid != want {
+			t.Errorf("Proc.Find(%s) = %d, %v, want %d", name, pid, err, want)
+		}
+	}
+
+	if pid, err := (Proc{}).Find("recaltools-test-missing"); runtime.GOOS == "linux" && (pid != 0 || err != nil) {
+		t.Errorf("Proc.Find() on /proc = %d, %v, want 0", pid, err)
+	}
+}
+
+// fakeES is an EmulationStation running until the stopped file exists
+type fakeES struct {
+	stopped string
+}
+
+func (f fakeES) Find(name string) (int, error) {
+	if _, err := os.Stat(f.stopped); err == nil {
+		return 0, nil
+	}
+	return 42, nil
+}
+
+func TestESGuard_Run(t *testing.T) {
+	esPollInterval = time.Millisecond
+
+	tests := []struct {
+		name        string
+		running     bool
+		guard       ESGuard
+		wantWritten bool
+		wantErr     i18n.Key
+		wantStarted bool
+	}{
+		{"Not running", false, ESGuard{}, true, "", false},
+		{"Running", true, ESGuard{}, false, i18n.ESRunning, false},
+		{"Forced", true, ESGuard{Force: true}, true, "", false},
+		{"Stopped and started", true, ESGuard{StopCmd: "touch $DIR/stopped", StartCmd: "touch $DIR/started"}, true, "", true},
+		{"Still running", true, ESGuard{StopCmd: "true", StartCmd: "touch $DIR/started", StopTimeout: 10 * time.Millisecond}, false, i18n.ESRunning, true},
+		{"Stop failed", true, ESGuard{StopCmd: "false", StartCmd: "touch $DIR/started"}, false, i18n.ESStopFailed, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := t.TempDir()
+			os.Setenv("DIR", dir)
+			defer os.Unsetenv("DIR")
+			if !tt.running {
+				if err := os.WriteFile(filepath.Join(dir, "stopped"), nil, 0644); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			guard := tt.guard
+			guard.Processes = fakeES{stopped: filepath.Join(dir, "stopped")}
+			written := false
+			err := guard.Run(context.Background(), func() error {
+				if pid, _ := guard.Processes.Find(ESProcessName); pid != 0 && !tt.guard.Force {
+					t.Errorf("ESGuard.Run() writes while EmulationStation is running")
+				}
+				written = true
+				return nil
+			})
+
+			if (tt.wantErr == "") != (err == nil) || (tt.wantErr != "" && !errors.Is(err, &i18n.Error{Key: tt.wantErr})) {
+				t.Fatalf("ESGuard.Run() error = %v, want %v", err, tt.wantErr)
+			}
+			if written != tt.wantWritten {
+				t.Errorf("ESGuard.Run() written = %v, want %v", written, tt.wantWritten)
+			}
+			assertExist(t, "start", filepath.Join(dir, "started"), tt.wantStarted)
+		})
+	}
+}
+
+// findFunc is a ProcessFinder calling itself
+type findFunc func(name string) (int, error)
+
+func (f findFunc) Find(name string) (int, error) {
+	return f(name)
+}
+
+func TestESGuard_Run_unknown(t *testing.T) {
+	noProc := findFunc(func(name string) (int, error) { return 0, os.ErrNotExist })
+
+	for _, force := range []bool{false, true} {
+		written := false
+		guard := ESGuard{Processes: noProc, Force: force}
+		err := guard.Run(context.Background(), func() error {
+			written = true
+			return nil
+		})
+		if force && (err != nil || !written) {
+			t.Errorf("ESGuard.Run() forced without /proc = %v, written %v, want written", err, written)
+		}
+		if !force && (!errors.Is(err, &i18n.Error{Key: i18n.ESUnknown}) || written) {
+			t.Errorf("ESGuard.Run() without /proc = %v, written %v, want %s", err, written, i18n.ESUnknown)
+		}
+	}
+}
+
+func TestESGuard_Run_cancelled(t *testing.T) {
+	dir := t.TempDir()
+	os.Setenv("DIR", dir)
+	defer os.Unsetenv("DIR")
+
+	// the run is interrupted while EmulationStation is exiting
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	guard := ESGuard{
+		Processes: findFunc(func(name string) (int, error) {
+			if _, err := os.Stat(filepath.Join(dir, "stopped")); err == nil {
+				cancel()
+			}
+			return 42, nil
+		}),
+		StopCmd:  "touch $DIR/stopped",
+		StartCmd: "touch $DIR/started",
+	}
+	err := guard.Run(ctx, func() error {
+		t.Errorf("ESGuard.Run() writes while EmulationStation is running")
+		return nil
+	})
+
+	if !errors.Is(err, context.Canceled) {
+		t.Errorf("ESGuard.Run() error = %v, want %v", err, context.Canceled)
+	}
+	assertExist(t, "start", filepath.Join(dir, "started"), true)
+}
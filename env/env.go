@@ -4,23 +4,24 @@
 package env
 
 import (
-	"fmt"
 	"os"
 	"strconv"
+
+	"github.com/jymannob/recaltools/i18n"
 )
 
 // DirFromEnvironment récupère le path d'un répertoire depuis une variable d'environnement passé en paramètre.
 func DirFromEnvironment(envName string) (string, error) {
 	dir, ok := os.LookupEnv(envName)
 	if !ok || dir == "" {
-		return "", fmt.Errorf("la variable `%s` est manquante", envName)
+		return "", i18n.NewError(i18n.EnvMissing, nil, envName)
 	}
 	dirInfo, err := os.Stat(dir)
 	if err != nil {
-		return "", err
+		return "", i18n.NewError(i18n.EnvNotDir, err, dir)
 	}
 	if !dirInfo.IsDir() {
-		return "", fmt.Errorf("`%s` n'est pas un répertoire valide", dir)
+		return "", i18n.NewError(i18n.EnvNotDir, nil, dir)
 	}
 	return dir, nil
 }
@@ -30,7 +31,7 @@ func RequiredStringFromEnvironment(envName string) (string, error) {
 	if env, ok := os.LookupEnv(envName); ok && env != "" {
 		return env, nil
 	}
-	return "", fmt.Errorf("la variable `%s` est manquante", envName)
+	return "", i18n.NewError(i18n.EnvMissing, nil, envName)
 }
 
 // StringFromEnvironment récupère la valeur d'une variable d'environement ou si non définie la valeur par defaut
@@ -0,0 +1,51 @@
+package recaltools
+
+import (
+	"strings"
+
+	"github.com/jymannob/recaltools/i18n"
+)
+
+// SystemError is the failure of a gamelist, or of a system directory
+type SystemError struct {
+	Path string
+	Err  error
+}
+
+func (e *SystemError) Error() string {
+	return i18n.T(i18n.SystemFailed, e.Path, e.Err)
+}
+
+func (e *SystemError) Unwrap() error {
+	return e.Err
+}
+
+// RunError lists the gamelists which failed during a run, and why the run was interrupted
+type RunError struct {
+	Failures []*SystemError
+	Total    int   // gamelists processed, failed or not
+	Err      error // context error if the run has been interrupted
+}
+
+func (e *RunError) Error() string {
+	var lines []string
+	if e.Err != nil {
+		lines = append(lines, i18n.T(i18n.RunInterrupted, e.Err))
+	}
+	if len(e.Failures) > 0 {
+		lines = append(lines, i18n.T(i18n.RunFailed, len(e.Failures), e.Total))
+		for _, failure := range e.Failures {
+			lines = append(lines, "  - "+failure.Error())
+		}
+	}
+	return strings.Join(lines, "\n")
+}
+
+func (e *RunError) Unwrap() error {
+	return e.Err
+}
+
+// Partial reports whether some gamelists have been processed successfully
+func (e *RunError) Partial() bool {
+	return len(e.Failures) < e.Total
+}
@@ -0,0 +1,91 @@
+package recaltools
+
+import (
+	"path"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/antchfx/xmlquery"
+	"github.com/jymannob/recaltools/i18n"
+)
+
+// Filter selects the systems and games a command processes, the zero Filter selects all of them.
+// Systems are filtered by the Scanner, games by the commands changing games.
+type Filter struct {
+	Systems        []string  // system directory name globs (`snes`, `mega*`), all systems if empty
+	ExcludeSystems []string  // system directory name globs skipped, even if in Systems
+	Games          []string  // rom path globs, case insensitive, matched against the path relative to the system directory or the file name
+	FavoriteOnly   bool      // only favorite games
+	PlayedSince    time.Time // only games last played at or after this time, all games if zero
+}
+
+// ParseDate parses a played since date, `2022-03-04`, `20220304T050607` like `lastplayed` elements, or any timestamp normalize reads
+func ParseDate(s string) (time.Time, error) {
+	date, ok := parseTimestamp(s)
+	if !ok {
+		return time.Time{}, i18n.NewError(i18n.FilterDate, nil, s)
+	}
+	return date, nil
+}
+
+// Validate checks system and game globs
+func (f Filter) Validate() error {
+	for _, pattern := range append(append(append([]string{}, f.Systems...), f.ExcludeSystems...), f.Games...) {
+		if _, err := filepath.Match(pattern, ""); err != nil {
+			return i18n.NewError(i18n.FilterInvalid, err, pattern)
+		}
+	}
+	return nil
+}
+
+// MatchSystem reports whether the system directory name is selected
+func (f Filter) MatchSystem(system string) bool {
+	if len(f.Systems) > 0 && !matchGlobs(f.Systems, system) {
+		return false
+	}
+	return !matchGlobs(f.ExcludeSystems, system)
+}
+
+// MatchGame reports whether the game is selected
+func (f Filter) MatchGame(g *Game) bool {
+	if f.FavoriteOnly && !g.Favorite {
+		return false
+	}
+
+	if !f.PlayedSince.IsZero() {
+		played, ok := parseTimestamp(g.Lastplayed)
+		if !ok || played.Before(f.PlayedSince) {
+			return false
+		}
+	}
+
+	if len(f.Games) > 0 {
+		romPath := strings.ToLower(path.Clean(filepath.ToSlash(g.RomPath)))
+		for _, pattern := range f.Games {
+			pattern = strings.ToLower(filepath.ToSlash(pattern))
+			if ok, _ := path.Match(pattern, romPath); ok {
+				return true
+			}
+			if ok, _ := path.Match(pattern, path.Base(romPath)); ok {
+				return true
+			}
+		}
+		return false
+	}
+
+	return true
+}
+
+// FiltersGames reports whether some games may not be selected
+func (f Filter) FiltersGames() bool {
+	return f.FavoriteOnly || !f.PlayedSince.IsZero() || len(f.Games) > 0
+}
+
+// MatchNode reports whether the `game` node is selected
+func (f Filter) MatchNode(node *xmlquery.Node) bool {
+	if !f.FiltersGames() {
+		return true
+	}
+	return f.MatchGame(newGame(node))
+}
@@ -0,0 +1,135 @@
+package recaltools
+
+import (
+	"errors"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/jymannob/recaltools/i18n"
+	"github.com/jymannob/recaltools/vfs"
+)
+
+func TestFilter_MatchSystem(t *testing.T) {
+	filter := Filter{Systems: []string{"snes", "mega*"}, ExcludeSystems: []string{"megacd"}}
+
+	for system, want := range map[string]bool{"snes": true, "megadrive": true, "megacd": false, "nes": false} {
+		if got := filter.MatchSystem(system); got != want {
+			t.Errorf("Filter.MatchSystem(%s) = %v, want %v", system, got, want)
+		}
+	}
+	if !(Filter{ExcludeSystems: []string{"nes"}}).MatchSystem("snes") {
+		t.Errorf("Filter.MatchSystem() excluding only nes does not select snes")
+	}
+}
+
+func TestFilter_MatchGame(t *testing.T) {
+	since, err := ParseDate("2022-01-01")
+	if err != nil {
+		t.Fatal(err)
+	}
+	favorite := &Game{RomPath: "./Homebrew/Kubo 3.nes", Favorite: true, Lastplayed: "20220529T183748"}
+	played := &Game{RomPath: "./Zelda.nes", Lastplayed: "20201119T171810"}
+	never := &Game{RomPath: "./Metroid.nes"}
+
+	tests := []struct {
+		name   string
+		filter Filter
+		want   []bool // favorite, played, never
+	}{
+		{"All", Filter{}, []bool{true, true, true}},
+		{"Favorite", Filter{FavoriteOnly: true}, []bool{true, false, false}},
+		{"Played since", Filter{PlayedSince: since}, []bool{true, false, false}},
+		{"Played since 2020", Filter{PlayedSince: since.AddDate(-2, 0, 0)}, []bool{true, true, false}},
+		{"Relative path", Filter{Games: []string{"homebrew/*"}}, []bool{true, false, false}},
+		{"File name", Filter{Games: []string{"zelda*", "*metroid*"}}, []bool{false, true, true}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			for i, g := range []*Game{favorite, played, never} {
+				if got := tt.filter.MatchGame(g); got != tt.want[i] {
+					t.Errorf("Filter.MatchGame(%s) = %v, want %v", g.RomPath, got, tt.want[i])
+				}
+			}
+		})
+	}
+}
+
+func TestFilter_Validate(t *testing.T) {
+	if err := (Filter{Games: []string{"[nes"}}).Validate(); !errors.Is(err, &i18n.Error{Key: i18n.FilterInvalid}) {
+		t.Errorf("Filter.Validate() error = %v, want FilterInvalid", err)
+	}
+	if _, err := ParseDate("yesterday"); !errors.Is(err, &i18n.Error{Key: i18n.FilterDate}) {
+		t.Errorf("ParseDate() error = %v, want FilterDate", err)
+	}
+	if date, err := ParseDate("20220304T050607"); err != nil || !date.Equal(time.Date(2022, 3, 4, 5, 6, 7, 0, time.UTC)) {
+		t.Errorf("ParseDate() = %v, %v", date, err)
+	}
+}
+
+func TestFavBackup_filter(t *testing.T) {
+	mem := vfs.NewMem()
+	gamelist := `<gameList>` +
+		`<game><path>./Kubo 3.nes</path><favorite>true</favorite><lastplayed>20220529T183748</lastplayed></game>` +
+		`<game><path>./Zelda.nes</path><playcount>2</playcount><lastplayed>20201119T171810</lastplayed></game>` +
+		`</gameList>`
+	for _, system := range []string{"nes", "snes"} {
+		if err := mem.WriteFile(filepath.Join("roms", system, "gamelist.xml"), []byte(gamelist)); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// back up the favorites of nes only, the other games of the existing backup are kept
+	if err := vfs.WriteJson(mem, filepath.Join("roms", "nes", fileBackupName), SystemBackup{Games: map[string]*Game{
+		"./Kubo 3.nes": {RomPath: "./Kubo 3.nes"},
+		"./Zelda.nes":  {RomPath: "./Zelda.nes", Playcount: "1", Lastplayed: "20191119T171810"},
+	}}, false); err != nil {
+		t.Fatal(err)
+	}
+	fb := &FavBackup{RomsDir: []string{"roms"}, Options: Options{FS: mem, Filter: Filter{Systems: []string{"nes"}, FavoriteOnly: true}}}
+	if err := fb.Backup(); err != nil {
+		t.Fatalf("FavBackup.Backup() error = %v", err)
+	}
+	if len(fb.Gamelists) != 1 {
+		t.Errorf("FavBackup.Backup() gamelists = %v, want nes only", fb.Gamelists)
+	}
+	var backup SystemBackup
+	if err := vfs.ReadJson(mem, filepath.Join("roms", "nes", fileBackupName), &backup); err != nil {
+		t.Fatal(err)
+	}
+	if len(backup.Games) != 2 || backup.Games["./Kubo 3.nes"] == nil || !backup.Games["./Kubo 3.nes"].Favorite {
+		t.Errorf("FavBackup.Backup() games = %v, want Kubo 3 backed up", backup.Games)
+	}
+	if zelda := backup.Games["./Zelda.nes"]; zelda == nil || zelda.Playcount != "1" || zelda.Lastplayed != "20191119T171810" {
+		t.Errorf("FavBackup.Backup() Zelda = %+v, want the existing backup kept", zelda)
+	}
+	if _, err := mem.Stat(filepath.Join("roms", "snes", fileBackupName)); err == nil {
+		t.Errorf("FavBackup.Backup() backed up the excluded snes")
+	}
+
+	// restore the games of nes played since 2022 in an emptied gamelist
+	if err := vfs.WriteJson(mem, filepath.Join("roms", "nes", fileBackupName), SystemBackup{Games: map[string]*Game{
+		"./Kubo 3.nes": {RomPath: "./Kubo 3.nes", Favorite: true, Lastplayed: "20220529T183748"},
+		"./Zelda.nes":  {RomPath: "./Zelda.nes", Playcount: "2", Lastplayed: "20201119T171810"},
+	}}, false); err != nil {
+		t.Fatal(err)
+	}
+	empty := `<gameList><game><path>./Kubo 3.nes</path></game><game><path>./Zelda.nes</path></game></gameList>`
+	if err := mem.WriteFile(filepath.Join("roms", "nes", "gamelist.xml"), []byte(empty)); err != nil {
+		t.Fatal(err)
+	}
+
+	since, _ := ParseDate("2022-01-01")
+	fb = &FavBackup{RomsDir: []string{"roms"}, Options: Options{FS: mem, Filter: Filter{ExcludeSystems: []string{"snes"}, PlayedSince: since}}}
+	if err := fb.Restore(); err != nil {
+		t.Fatalf("FavBackup.Restore() error = %v", err)
+	}
+	restored, err := mem.ReadFile(filepath.Join("roms", "nes", "gamelist.xml"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(restored), "<favorite>true</favorite>") || strings.Contains(string(restored), "<playcount>2</playcount>") {
+		t.Errorf("FavBackup.Restore() = %s, want Kubo 3 restored only", restored)
+	}
+}
@@ -0,0 +1,59 @@
+package recaltools
+
+import (
+	"io/fs"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// copyTestdata copies the systems of testdata/roms into a temporary roms directory and returns it,
+// so tests never write to testdata
+func copyTestdata(t testing.TB, systems ...string) string {
+	romsDir := t.TempDir()
+
+	for _, system := range systems {
+		src := filepath.Join("testdata", "roms", system)
+		err := filepath.WalkDir(src, func(path string, d fs.DirEntry, err error) error {
+			if err != nil {
+				return err
+			}
+			rel, _ := filepath.Rel(src, path)
+			dst := filepath.Join(romsDir, system, rel)
+			if d.IsDir() {
+				return os.MkdirAll(dst, 0775)
+			}
+			data, err := os.ReadFile(path)
+			if err != nil {
+				return err
+			}
+			return os.WriteFile(dst, data, 0664)
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	return romsDir
+}
+
+// writeFiles writes the files, by path relative to dir, creating their directories
+func writeFiles(t testing.TB, dir string, files map[string]string) {
+	for name, content := range files {
+		path := filepath.Join(dir, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0775); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(content), 0664); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func assertExist(t *testing.T, step, path string, want bool) {
+	t.Helper()
+	_, err := os.Stat(path)
+	if got := err == nil; got != want {
+		t.Errorf("%s : %s exists = %v, want %v", step, path, got, want)
+	}
+}
@@ -1,26 +1,37 @@
 package recaltools
 
 import (
+	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
-	"io/fs"
-	"log"
 	"path/filepath"
 	"strconv"
-	"sync"
+	"time"
 
 	"github.com/antchfx/xmlquery"
-	"github.com/jymannob/recaltools/utils"
+	"github.com/jymannob/recaltools/i18n"
+	"github.com/jymannob/recaltools/logger"
+	"github.com/jymannob/recaltools/vfs"
 	"github.com/jymannob/recaltools/xml"
 )
 
 type FavBackup struct {
-	RomsDir    []string
-	Gamelists  []string
-	FormatJson bool
-	Verbose    bool
-	RestoreBkp bool // unused in reclatools version
-	wg         sync.WaitGroup
+	RomsDir       []string
+	Gamelists     []string // gamelists found by the last run
+	FormatJson    bool
+	RestoreBkp    bool   // unused in reclatools version
+	NormalizeUTF8 bool   // write gamelists in utf-8 instead of their original encoding
+	Stamp         bool   // set `timestamp` attribute of restored games to the restore time
+	Layout        Layout // ROM directory of each gamelist, RomDirLayout if nil
+	Options
+}
+
+func (fb *FavBackup) layout() Layout {
+	if fb.Layout == nil {
+		return RomDirLayout{}
+	}
+	return fb.Layout
 }
 
 type SystemBackup struct {
@@ -28,19 +39,41 @@ type SystemBackup struct {
 }
 
 type Game struct {
-	RomPath    string `json:"path"`
-	Favorite   bool   `json:"favorite,omitempty"`
-	Playcount  string `json:"playcount,omitempty"`
-	Lastplayed string `json:"lastplayed,omitempty"`
+	RomPath    string            `json:"path"`
+	Hash       string            `json:"hash,omitempty"`
+	Favorite   bool              `json:"favorite,omitempty"`
+	Playcount  string            `json:"playcount,omitempty"`
+	Lastplayed string            `json:"lastplayed,omitempty"`
+	Hidden     bool              `json:"hidden,omitempty"`
+	Attributes map[string]string `json:"attributes,omitempty"` // `game` node attributes (source, timestamp)
 }
 
 var fileBackupName string = "gamelist-backup.json"
 
 func (s *SystemBackup) AddGame(node *xmlquery.Node) {
+	g := newGame(node)
+	s.Games[g.RomPath] = g
+}
+
+// newGame returns the user data of a `game` node
+func newGame(node *xmlquery.Node) *Game {
+
+	//create Game and add path from Xml (present in backed up games)
+	var g Game
+	if path := node.SelectElement("path"); path != nil {
+		g.RomPath = path.InnerText()
+	}
 
-	//create Game and add path from Xml (always present)
-	g := Game{
-		RomPath: node.SelectElement("path").InnerText(),
+	for _, attr := range node.Attr {
+		if g.Attributes == nil {
+			g.Attributes = make(map[string]string)
+		}
+		g.Attributes[attr.Name.Local] = attr.Value
+	}
+
+	hash := node.SelectElement("hash")
+	if hash != nil {
+		g.Hash = hash.InnerText()
 	}
 
 	favorite := node.SelectElement("favorite")
@@ -61,146 +94,180 @@ func (s *SystemBackup) AddGame(node *xmlquery.Node) {
 		g.Lastplayed = lastplayed.InnerText()
 	}
 
-	s.Games[g.RomPath] = &g
-}
-
-func (fb *FavBackup) PopulateGamelists(path string, di fs.DirEntry, err error) error {
-
-	if filepath.Base(path) == "gamelist.xml" {
-		fb.Gamelists = append(fb.Gamelists, path)
+	hidden := node.SelectElement("hidden")
+	if hidden != nil {
+		b, err := strconv.ParseBool(hidden.InnerText())
+		if err == nil {
+			g.Hidden = b
+		}
 	}
 
-	return err
+	return &g
 }
 
-//get all `game` nodes with child node (`lastplayed` OR `playcount` OR `favorite` contains "true" (insensitive))
-var gameXpath string = "//game[./favorite[matches(text(), \"(?i)^true$\")]|./lastplayed|./playcount]"
+// get all `game` nodes with child node (`lastplayed` OR `playcount` OR `favorite` OR `hidden` contains "true" (insensitive))
+var gameXpath string = "//game[./favorite[matches(text(), \"(?i)^true$\")]|./hidden[matches(text(), \"(?i)^true$\")]|./lastplayed|./playcount]"
 
 func (fb *FavBackup) Backup() error {
+	return fb.BackupContext(context.Background())
+}
 
-	for _, romsdir := range fb.RomsDir {
-		err := filepath.WalkDir(romsdir, fb.PopulateGamelists)
-		if err != nil {
-			return err
-		}
-
-		for _, gamelist := range fb.Gamelists {
+// BackupContext backs up every gamelist, it stops starting new gamelists once ctx is done
+func (fb *FavBackup) BackupContext(ctx context.Context) error {
 
-			fb.wg.Add(1)
-			go fb.backupSystem(gamelist)
-		}
+	var err error
+	fb.Gamelists, err = fb.scanner().Scan(fb.RomsDir)
+	if err != nil {
+		return err
+	}
+	if err := forEach(ctx, fb.Jobs, fb.Gamelists, observed(fb.observer(), fb.Gamelists, fb.backupSystem)); err != nil {
+		return err
 	}
 
-	fb.wg.Wait()
-	log.Println("Backup Done !")
+	fb.log().Info(i18n.T(i18n.BackupDone))
 	return nil
 }
 
-func (fb *FavBackup) backupSystem(gamelist string) {
-	defer fb.wg.Done()
+func (fb *FavBackup) backupSystem(gamelist string) (int, error) {
 
 	systemPath := filepath.Dir(gamelist)
-	if fb.Verbose {
-		log.Printf("%s Found\n", gamelist)
-	}
+	fb.log().Debug(i18n.T(i18n.GamelistFound, gamelist), logger.System(gamelist))
 
-	doc, err := xml.OpenXml(gamelist)
+	doc, _, err := vfs.ReadXml(fb.fs(), gamelist)
 	if err != nil {
-		log.Println(err)
-		return
+		return 0, err
 	}
 
-	_, err = xmlquery.QueryAll(doc, gameXpath)
+	nodes, err := xmlquery.QueryAll(doc, gameXpath)
 	if err != nil {
-		log.Println(err)
-		return
+		return 0, err
+	}
+	if len(nodes) == 0 {
+		return 0, nil
 	}
-	if nodes, err := xmlquery.QueryAll(doc, gameXpath); err == nil {
 
-		if len(nodes) > 0 {
+	systemBkp := SystemBackup{
+		Games: make(map[string]*Game),
+	}
+	// a backup of some games only replaces their entries of the existing backup
+	if fb.Filter.FiltersGames() {
+		err := vfs.ReadJson(fb.fs(), filepath.Join(systemPath, fileBackupName), &systemBkp)
+		if err != nil && !errors.Is(err, &i18n.Error{Key: i18n.FileNotExist}) {
+			return 0, err
+		}
+		if systemBkp.Games == nil {
+			systemBkp.Games = make(map[string]*Game)
+		}
+	}
 
-			systemBkp := SystemBackup{
-				Games: make(map[string]*Game),
-			}
+	var backedUp []string
+	for _, node := range nodes {
 
-			for _, node := range nodes {
+		if !fb.Filter.MatchNode(node) {
+			continue
+		}
+		romPath := childText(node, "path")
+		systemBkp.AddGame(node)
+		backedUp = append(backedUp, romPath)
+		fb.log().Debug(i18n.T(i18n.BackupGame, childText(node, "name")), logger.System(gamelist), logger.Rom(romPath))
+	}
 
-				systemBkp.AddGame(node)
-				if fb.Verbose {
-					log.Printf("Backup game : %s\n", node.SelectElement("name").InnerText())
-				}
-			}
+	if len(backedUp) == 0 {
+		return 0, nil
+	}
 
-			if fb.Verbose {
-				j, _ := json.MarshalIndent(systemBkp, "", "  ")
-				log.Println(string(j))
-				log.Printf("Write Json file : %v", filepath.Join(systemPath, fileBackupName))
-			}
+	if fb.log().Enabled(logger.LevelTrace) {
+		j, _ := json.Marshal(systemBkp)
+		fb.log().Trace(string(j), logger.System(gamelist))
+	}
+	fb.log().Debug(i18n.T(i18n.BackupWrite, filepath.Join(systemPath, fileBackupName)), logger.System(gamelist))
 
-			utils.WriteJsonFile(filepath.Join(systemPath, fileBackupName), systemBkp, fb.FormatJson)
-			if err != nil {
-				log.Println(err)
-			}
-		}
+	if err := vfs.WriteJson(fb.fs(), filepath.Join(systemPath, fileBackupName), systemBkp, fb.FormatJson); err != nil {
+		return 0, err
 	}
+	// games are backed up once written
+	for _, romPath := range backedUp {
+		fb.observer().GameUpdated(gamelist, romPath)
+	}
+	fb.observer().FileWritten(gamelist, filepath.Join(systemPath, fileBackupName))
+	return len(backedUp), nil
 }
 
 func (fb *FavBackup) Restore() error {
+	return fb.RestoreContext(context.Background())
+}
 
-	for _, romsdir := range fb.RomsDir {
-
-		err := filepath.WalkDir(romsdir, fb.PopulateGamelists)
-		if err != nil {
-			return err
-		}
-
-		for _, gamelist := range fb.Gamelists {
+// RestoreContext restores every gamelist, it stops starting new gamelists once ctx is done
+func (fb *FavBackup) RestoreContext(ctx context.Context) error {
 
-			fb.wg.Add(1)
-			go fb.restoreSystem(gamelist)
-		}
+	var err error
+	fb.Gamelists, err = fb.scanner().Scan(fb.RomsDir)
+	if err != nil {
+		return err
+	}
+	if err := forEach(ctx, fb.Jobs, fb.Gamelists, observed(fb.observer(), fb.Gamelists, fb.restoreSystem)); err != nil {
+		return err
 	}
 
-	fb.wg.Wait()
-	log.Println("Restore Done !")
+	fb.log().Info(i18n.T(i18n.RestoreDone))
 	return nil
 }
 
-//get `game` nodes with child node (`path` contains specific test)
-var gameFindXpath string = "//game[./path[contains(text(), \"%s\")]]"
-
-func (fb *FavBackup) restoreSystem(gamelist string) {
-	defer fb.wg.Done()
+func (fb *FavBackup) restoreSystem(gamelist string) (int, error) {
 
 	systemPath := filepath.Dir(gamelist)
 
-	doc, err := xml.OpenXml(gamelist)
+	doc, enc, err := vfs.ReadXml(fb.fs(), gamelist)
 	if err != nil {
-		log.Println(err)
-		return
+		return 0, err
 	}
 
-	// Read Json
+	// Read Json, systems without backup have nothing to restore
 	var backup SystemBackup
-	err = utils.ReadJsonFile(filepath.Join(systemPath, fileBackupName), &backup)
+	err = vfs.ReadJson(fb.fs(), filepath.Join(systemPath, fileBackupName), &backup)
+	if errors.Is(err, &i18n.Error{Key: i18n.FileNotExist}) {
+		return 0, nil
+	}
 	if err != nil {
-		return
+		return 0, err
 	}
 
-	if fb.Verbose {
-		log.Printf("%s Found backup\n", filepath.Join(systemPath, fileBackupName))
+	fb.log().Debug(i18n.T(i18n.BackupFound, filepath.Join(systemPath, fileBackupName)), logger.System(gamelist))
+
+	// index `game` nodes once instead of querying the document for each game,
+	// relative and absolute paths of a rom match once resolved against its ROM directory
+	romDir, err := fb.layout().RomDir(gamelist)
+	if err != nil {
+		return 0, err
 	}
+	idx := xml.NewResolvedIndex(doc, func(romPath string) string { return resolvePath(romDir, romPath) })
+	restoreTime := strconv.FormatInt(time.Now().Unix(), 10)
 
+	var restored []string
 	for _, v := range backup.Games {
 
-		if fb.Verbose {
-			log.Printf("Restore game : %s \n", v.RomPath)
+		if !fb.Filter.MatchGame(v) {
+			continue
 		}
+		fb.log().Debug(i18n.T(i18n.RestoreGame, v.RomPath), logger.System(gamelist), logger.Rom(v.RomPath))
 
-		// get `game` Node
-		a, err := xmlquery.Query(doc, fmt.Sprintf(gameFindXpath, v.RomPath))
-		if err != nil {
-			return // no `game` node
+		// get `game` Node by path, or by hash if the rom has been renamed
+		a := idx.ByPath(v.RomPath)
+		if a == nil && v.Hash != "" {
+			a = idx.ByHash(v.Hash)
+		}
+		if a == nil {
+			fb.log().Debug(i18n.T(i18n.RestoreNotFound, v.RomPath), logger.System(gamelist), logger.Rom(v.RomPath))
+			fb.observer().GameUnmatched(gamelist, v.RomPath)
+			continue // no `game` node
+		}
+
+		// restore attributes, so EmulationStation sees restored games as fresh when stamped
+		for key, value := range v.Attributes {
+			xml.SetAttr(a, key, value)
+		}
+		if fb.Stamp {
+			xml.SetAttr(a, "timestamp", restoreTime)
 		}
 
 		// update childs Nodes
@@ -218,15 +285,26 @@ func (fb *FavBackup) restoreSystem(gamelist string) {
 			playcount := xml.NewNode("playcount", v.Playcount)
 			xml.ReplaceChildNode(a, playcount)
 		}
-	}
 
-	if fb.Verbose {
-		log.Printf("Write Xml file : %s", gamelist)
+		if v.Hidden {
+			hidden := xml.NewNode("hidden", fmt.Sprintf("%t", v.Hidden))
+			xml.ReplaceChildNode(a, hidden)
+		}
+
+		restored = append(restored, v.RomPath)
 	}
-	_, err = xml.WriteXml(gamelist, doc)
-	if err != nil {
-		log.Println(err)
-		return
+
+	if fb.NormalizeUTF8 {
+		enc = xml.UTF8
 	}
 
+	fb.log().Debug(i18n.T(i18n.XmlWrite, gamelist, enc.Charset), logger.System(gamelist))
+	if err := vfs.WriteXml(fb.fs(), gamelist, doc, enc); err != nil {
+		return 0, err
+	}
+	for _, romPath := range restored {
+		fb.observer().GameUpdated(gamelist, romPath)
+	}
+	fb.observer().FileWritten(gamelist, gamelist)
+	return len(restored), nil
 }
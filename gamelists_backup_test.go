@@ -1,12 +1,20 @@
 package recaltools
 
 import (
+	"errors"
+	"os"
+	"path/filepath"
 	"sync"
 	"testing"
+
+	"github.com/jymannob/recaltools/utils"
+	"github.com/jymannob/recaltools/vfs"
+	"github.com/jymannob/recaltools/xml"
 )
 
-// Funtional testing
+// Functional testing
 func TestFavBackup_Backup(t *testing.T) {
+	romsDir := copyTestdata(t, "megadrive", "nes", "testSystem")
 
 	type fields struct {
 		RomsDir    []string
@@ -14,7 +22,6 @@ func TestFavBackup_Backup(t *testing.T) {
 		FormatJson bool
 		Verbose    bool
 		RestoreBkp bool
-		wg         sync.WaitGroup
 	}
 	tests := []struct {
 		name    string
@@ -24,7 +31,7 @@ func TestFavBackup_Backup(t *testing.T) {
 		{
 			"Backup",
 			fields{
-				RomsDir:    []string{"./testdata/roms"},
+				RomsDir:    []string{romsDir},
 				FormatJson: true,
 				Verbose:    true,
 				RestoreBkp: false,
@@ -38,9 +45,8 @@ func TestFavBackup_Backup(t *testing.T) {
 				RomsDir:    tt.fields.RomsDir,
 				Gamelists:  tt.fields.Gamelists,
 				FormatJson: tt.fields.FormatJson,
-				Verbose:    tt.fields.Verbose,
 				RestoreBkp: tt.fields.RestoreBkp,
-				wg:         tt.fields.wg,
+				Options:    Options{Verbose: tt.fields.Verbose},
 			}
 			if err := fb.Backup(); (err != nil) != tt.wantErr {
 				t.Errorf("FavBackup.Backup() error = %v, wantErr %v", err, tt.wantErr)
@@ -49,15 +55,16 @@ func TestFavBackup_Backup(t *testing.T) {
 	}
 }
 
-// Funtional testing
+// Functional testing
 func TestFavBackup_Restore(t *testing.T) {
+	romsDir := copyTestdata(t, "megadrive", "nes", "testSystem")
+
 	type fields struct {
 		RomsDir    []string
 		Gamelists  []string
 		FormatJson bool
 		Verbose    bool
 		RestoreBkp bool
-		wg         sync.WaitGroup
 	}
 	tests := []struct {
 		name    string
@@ -67,7 +74,7 @@ func TestFavBackup_Restore(t *testing.T) {
 		{
 			"Restore",
 			fields{
-				RomsDir:    []string{"./testdata/roms"},
+				RomsDir:    []string{romsDir},
 				FormatJson: false,
 				Verbose:    true,
 				RestoreBkp: true,
@@ -81,9 +88,8 @@ func TestFavBackup_Restore(t *testing.T) {
 				RomsDir:    tt.fields.RomsDir,
 				Gamelists:  tt.fields.Gamelists,
 				FormatJson: tt.fields.FormatJson,
-				Verbose:    tt.fields.Verbose,
 				RestoreBkp: tt.fields.RestoreBkp,
-				wg:         tt.fields.wg,
+				Options:    Options{Verbose: tt.fields.Verbose},
 			}
 			if err := fb.Restore(); (err != nil) != tt.wantErr {
 				t.Errorf("FavBackup.Restore() error = %v, wantErr %v", err, tt.wantErr)
@@ -93,13 +99,14 @@ func TestFavBackup_Restore(t *testing.T) {
 }
 
 func TestFavBackup_restoreSystem(t *testing.T) {
+	romsDir := copyTestdata(t, "megadrive", "nes", "testSystem")
+
 	type fields struct {
 		RomsDir    []string
 		Gamelists  []string
 		FormatJson bool
 		Verbose    bool
 		RestoreBkp bool
-		wg         sync.WaitGroup
 	}
 	type args struct {
 		gamelist string
@@ -112,22 +119,22 @@ func TestFavBackup_restoreSystem(t *testing.T) {
 		{
 			"Restore nes system",
 			fields{
-				RomsDir:    []string{"./testdata/roms"},
+				RomsDir:    []string{romsDir},
 				FormatJson: false,
 				Verbose:    true,
 				RestoreBkp: true,
 			},
-			args{"./testdata/roms/nes/gamelist.xml"},
+			args{filepath.Join(romsDir, "nes", "gamelist.xml")},
 		},
 		{
 			"Restore bad xml",
 			fields{
-				RomsDir:    []string{"./testdata/roms"},
+				RomsDir:    []string{romsDir},
 				FormatJson: false,
 				Verbose:    true,
 				RestoreBkp: true,
 			},
-			args{"./testdata/roms/testSystem/badFile.xml"},
+			args{filepath.Join(romsDir, "testSystem", "badFile.xml")},
 		},
 	}
 	for _, tt := range tests {
@@ -136,24 +143,23 @@ func TestFavBackup_restoreSystem(t *testing.T) {
 				RomsDir:    tt.fields.RomsDir,
 				Gamelists:  tt.fields.Gamelists,
 				FormatJson: tt.fields.FormatJson,
-				Verbose:    tt.fields.Verbose,
 				RestoreBkp: tt.fields.RestoreBkp,
-				wg:         tt.fields.wg,
+				Options:    Options{Verbose: tt.fields.Verbose},
 			}
-			fb.wg.Add(1)
 			fb.restoreSystem(tt.args.gamelist)
 		})
 	}
 }
 
 func TestFavBackup_backupSystem(t *testing.T) {
+	romsDir := copyTestdata(t, "megadrive", "nes", "testSystem")
+
 	type fields struct {
 		RomsDir    []string
 		Gamelists  []string
 		FormatJson bool
 		Verbose    bool
 		RestoreBkp bool
-		wg         sync.WaitGroup
 	}
 	type args struct {
 		gamelist string
@@ -166,22 +172,22 @@ func TestFavBackup_backupSystem(t *testing.T) {
 		{
 			"Backup megadrive system",
 			fields{
-				RomsDir:    []string{"./testdata/roms"},
+				RomsDir:    []string{romsDir},
 				FormatJson: false,
 				Verbose:    true,
 				RestoreBkp: false,
 			},
-			args{"./testdata/roms/megadrive/gamelist.xml"},
+			args{filepath.Join(romsDir, "megadrive", "gamelist.xml")},
 		},
 		{
 			"Backup bad xml",
 			fields{
-				RomsDir:    []string{"./testdata/roms"},
+				RomsDir:    []string{romsDir},
 				FormatJson: false,
 				Verbose:    true,
 				RestoreBkp: false,
 			},
-			args{"./testdata/roms/testSystem/badFile.xml"},
+			args{filepath.Join(romsDir, "testSystem", "badFile.xml")},
 		},
 	}
 	for _, tt := range tests {
@@ -190,12 +196,218 @@ func TestFavBackup_backupSystem(t *testing.T) {
 				RomsDir:    tt.fields.RomsDir,
 				Gamelists:  tt.fields.Gamelists,
 				FormatJson: tt.fields.FormatJson,
-				Verbose:    tt.fields.Verbose,
 				RestoreBkp: tt.fields.RestoreBkp,
-				wg:         tt.fields.wg,
+				Options:    Options{Verbose: tt.fields.Verbose},
 			}
-			fb.wg.Add(1)
 			fb.backupSystem(tt.args.gamelist)
 		})
 	}
 }
+
+func TestFavBackup_restoreAttributes(t *testing.T) {
+	romsDir := copyTestdata(t, "nes")
+	systemPath := filepath.Join(romsDir, "nes")
+
+	backup := SystemBackup{Games: map[string]*Game{
+		"Homebrew/Kubo 3.nes": {
+			RomPath:    "Homebrew/Kubo 3.nes",
+			Favorite:   true,
+			Attributes: map[string]string{"source": "Backup", "timestamp": "1"},
+		},
+	}}
+	if err := utils.WriteJsonFile(filepath.Join(systemPath, fileBackupName), backup, false); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name          string
+		stamp         bool
+		wantTimestamp func(string) bool
+	}{
+		{"Restore attributes", false, func(ts string) bool { return ts == "1" }},
+		{"Stamp timestamp", true, func(ts string) bool { return ts != "1" && ts != "0" }},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fb := &FavBackup{RomsDir: []string{romsDir}, Stamp: tt.stamp}
+			fb.restoreSystem(filepath.Join(systemPath, "gamelist.xml"))
+
+			doc, err := xml.OpenXml(filepath.Join(systemPath, "gamelist.xml"))
+			if err != nil {
+				t.Fatal(err)
+			}
+			node := xml.NewIndex(doc).ByPath("Homebrew/Kubo 3.nes")
+			if got := node.SelectAttr("source"); got != "Backup" {
+				t.Errorf("restoreSystem() source = %v, want %v", got, "Backup")
+			}
+			if got := node.SelectAttr("timestamp"); !tt.wantTimestamp(got) {
+				t.Errorf("restoreSystem() timestamp = %v", got)
+			}
+		})
+	}
+}
+
+func TestFavBackup_Backup_failures(t *testing.T) {
+	romsDir := copyTestdata(t, "megadrive", "nes")
+
+	for _, system := range []string{"megadrive", "nes"} {
+		os.Remove(filepath.Join(romsDir, system, fileBackupName))
+	}
+	// a directory in place of the backup file can't be overwritten
+	if err := os.Mkdir(filepath.Join(romsDir, "nes", fileBackupName), 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	rec := &recorder{updated: make(map[string]int), written: make(map[string]int), games: make(map[string]int)}
+	fb := &FavBackup{RomsDir: []string{romsDir}, Options: Options{Observer: rec}}
+	err := fb.Backup()
+
+	var runErr *RunError
+	if !errors.As(err, &runErr) {
+		t.Fatalf("FavBackup.Backup() error = %v, want *RunError", err)
+	}
+	if len(runErr.Failures) != 1 || runErr.Failures[0].Path != filepath.Join(romsDir, "nes", "gamelist.xml") {
+		t.Errorf("FavBackup.Backup() failures = %v, want nes gamelist", runErr.Failures)
+	}
+	if !runErr.Partial() {
+		t.Errorf("FavBackup.Backup() Partial() = false, want true")
+	}
+	assertExist(t, "Backup", filepath.Join(romsDir, "megadrive", fileBackupName), true)
+	if rec.updated["nes"] != 0 || rec.updated["megadrive"] == 0 {
+		t.Errorf("FavBackup.Backup() updated %v games, want none of the unwritten nes backup", rec.updated)
+	}
+}
+
+// recorder counts the events of a backup or restore
+type recorder struct {
+	NopObserver
+	mu                          sync.Mutex
+	discovered, started, errors int
+	finished                    []string
+	updated, written, games     map[string]int
+}
+
+func (r *recorder) SystemDiscovered(gamelist string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.discovered++
+}
+
+func (r *recorder) SystemStarted(gamelist string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.started++
+}
+
+func (r *recorder) SystemFinished(gamelist string, games int) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.finished = append(r.finished, filepath.Base(filepath.Dir(gamelist)))
+	r.games[filepath.Base(filepath.Dir(gamelist))] = games
+}
+
+func (r *recorder) GameUpdated(gamelist, romPath string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.updated[filepath.Base(filepath.Dir(gamelist))]++
+}
+
+func (r *recorder) FileWritten(gamelist, path string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.written[filepath.Base(filepath.Dir(gamelist))]++
+}
+
+func (r *recorder) Error(gamelist string, err error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.errors++
+}
+
+func TestFavBackup_Observer(t *testing.T) {
+	romsDir := copyTestdata(t, "megadrive", "nes")
+	if err := os.WriteFile(filepath.Join(romsDir, "megadrive", "gamelist.xml"), []byte("<gameList>"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, step := range []string{"Backup", "Restore"} {
+		t.Run(step, func(t *testing.T) {
+			rec := &recorder{updated: make(map[string]int), written: make(map[string]int), games: make(map[string]int)}
+			fb := &FavBackup{RomsDir: []string{romsDir}, Options: Options{Observer: rec}}
+
+			run := fb.Backup
+			if step == "Restore" {
+				run = fb.Restore
+			}
+			if err := run(); err == nil {
+				t.Fatalf("FavBackup.%s() error = nil, want megadrive failure", step)
+			}
+
+			if rec.discovered != 2 || rec.started != 2 {
+				t.Errorf("%s discovered %d, started %d systems, want 2", step, rec.discovered, rec.started)
+			}
+			if rec.errors != 1 || len(rec.finished) != 1 || rec.finished[0] != "nes" {
+				t.Errorf("%s failed %d, finished %v, want megadrive failed and nes finished", step, rec.errors, rec.finished)
+			}
+			if rec.updated["nes"] == 0 || rec.updated["megadrive"] != 0 {
+				t.Errorf("%s updated %v games, want only nes games", step, rec.updated)
+			}
+			if rec.games["nes"] != rec.updated["nes"] {
+				t.Errorf("%s finished nes with %d games, want the %d updated", step, rec.games["nes"], rec.updated["nes"])
+			}
+			if rec.written["nes"] != 1 || rec.written["megadrive"] != 0 {
+				t.Errorf("%s wrote %v files, want the nes one", step, rec.written)
+			}
+		})
+	}
+}
+
+func TestFavBackup_Backup_mem(t *testing.T) {
+	mem := vfs.NewMem()
+	gamelist := `<gameList><game><path>./Super Mario.nes</path><favorite>true</favorite></game><game><path>./Zelda.nes</path></game></gameList>`
+	if err := mem.WriteFile("roms/nes/gamelist.xml", []byte(gamelist)); err != nil {
+		t.Fatal(err)
+	}
+
+	fb := &FavBackup{RomsDir: []string{"roms"}, Options: Options{FS: mem}}
+	if err := fb.Backup(); err != nil {
+		t.Fatalf("FavBackup.Backup() error = %v", err)
+	}
+
+	var backup SystemBackup
+	if err := vfs.ReadJson(mem, filepath.Join("roms", "nes", fileBackupName), &backup); err != nil {
+		t.Fatal(err)
+	}
+	if len(backup.Games) != 1 || backup.Games["./Super Mario.nes"] == nil || !backup.Games["./Super Mario.nes"].Favorite {
+		t.Errorf("FavBackup.Backup() games = %v, want Super Mario as favorite", backup.Games)
+	}
+}
+
+func TestFavBackup_Restore_overlay(t *testing.T) {
+	romsDir := copyTestdata(t, "nes")
+	gamelist := filepath.Join(romsDir, "nes", "gamelist.xml")
+	before, err := os.ReadFile(gamelist)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	overlay := vfs.NewOverlay(vfs.OS{})
+	fb := &FavBackup{RomsDir: []string{romsDir}, Stamp: true, Options: Options{FS: overlay}}
+	if err := fb.Restore(); err != nil {
+		t.Fatalf("FavBackup.Restore() error = %v", err)
+	}
+
+	if written := overlay.Written(); len(written) != 1 || written[0] != gamelist {
+		t.Errorf("FavBackup.Restore() wrote %v, want %s", written, gamelist)
+	}
+	restored, err := overlay.ReadFile(gamelist)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(restored) == string(before) {
+		t.Errorf("FavBackup.Restore() gamelist unchanged in the overlay")
+	}
+	if after, _ := os.ReadFile(gamelist); string(after) != string(before) {
+		t.Errorf("FavBackup.Restore() changed the base gamelist")
+	}
+}
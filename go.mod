@@ -5,12 +5,12 @@ go 1.17
 require (
 	github.com/alexflint/go-arg v1.4.3
 	github.com/antchfx/xmlquery v1.3.10
+	github.com/antchfx/xpath v1.2.0
+	golang.org/x/text v0.3.7
 )
 
 require (
 	github.com/alexflint/go-scalar v1.1.0 // indirect
-	github.com/antchfx/xpath v1.2.0 // indirect
 	github.com/golang/groupcache v0.0.0-20210331224755-41bb18bfe9da // indirect
 	golang.org/x/net v0.0.0-20220524220425-1d687d428aca // indirect
-	golang.org/x/text v0.3.7 // indirect
 )
@@ -0,0 +1,310 @@
+package recaltools
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"io/fs"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/antchfx/xmlquery"
+	"github.com/jymannob/recaltools/i18n"
+	"github.com/jymannob/recaltools/logger"
+	"github.com/jymannob/recaltools/vfs"
+	"github.com/jymannob/recaltools/xml"
+)
+
+// Hider marks `game` entries which are not games (BIOS, saves, companion files of multi-file roms) as hidden.
+// Hidden games are recorded in the backup so they stay hidden after a rescrape.
+type Hider struct {
+	RomsDir       []string
+	Rules         []HideRule // which games to hide on which systems, DefaultHideRules if empty
+	DryRun        bool       // do not write, only list games to hide
+	FormatJson    bool
+	NormalizeUTF8 bool
+	Hidden        []string // hidden rom paths
+	Options
+	mu sync.Mutex
+}
+
+// HideRule selects the games to hide on which systems
+type HideRule struct {
+	Systems    []string `json:"systems,omitempty"`    // system directory name globs (`psx`, `mega*`), all systems if empty
+	Patterns   []string `json:"patterns,omitempty"`   // rom file name globs, case insensitive (`*.sav`, `*\\[BIOS\\]*`)
+	Companions bool     `json:"companions,omitempty"` // hide files referenced by a .cue, .gdi, .m3u or .ccd rom of the system
+}
+
+// DefaultHideRules hide BIOS, saves and text files, and the companion files of multi-file roms
+var DefaultHideRules = []HideRule{{
+	Patterns:   []string{`*\[BIOS\]*`, `*(BIOS)*`, "*.sav", "*.srm", "*.txt", "*.nfo"},
+	Companions: true,
+}}
+
+// Validate checks system and pattern globs
+func (r HideRule) Validate() error {
+	for _, pattern := range append(append([]string{}, r.Systems...), r.Patterns...) {
+		if _, err := filepath.Match(pattern, ""); err != nil {
+			return i18n.NewError(i18n.HideRuleInvalid, err, pattern)
+		}
+	}
+	return nil
+}
+
+// MatchSystem reports whether the rule applies to the system directory name
+func (r HideRule) MatchSystem(system string) bool {
+	return len(r.Systems) == 0 || matchGlobs(r.Systems, system)
+}
+
+// MatchRom reports whether the rom file name matches a rule pattern
+func (r HideRule) MatchRom(romPath string) bool {
+	name := strings.ToLower(filepath.Base(romPath))
+	for _, pattern := range r.Patterns {
+		if ok, _ := filepath.Match(strings.ToLower(pattern), name); ok {
+			return true
+		}
+	}
+	return false
+}
+
+func (h *Hider) rules() []HideRule {
+	if len(h.Rules) == 0 {
+		return DefaultHideRules
+	}
+	return h.Rules
+}
+
+// Hide hides the games matching the rules, then backs up the gamelists to record them
+func (h *Hider) Hide() error {
+	return h.HideContext(context.Background())
+}
+
+// HideContext is Hide stopping to start new gamelists once ctx is done
+func (h *Hider) HideContext(ctx context.Context) error {
+
+	for _, rule := range h.rules() {
+		if err := rule.Validate(); err != nil {
+			return err
+		}
+	}
+
+	gamelists, err := h.scanner().Scan(h.RomsDir)
+	if err != nil {
+		return err
+	}
+
+	err = forEach(ctx, h.Jobs, gamelists, observed(h.observer(), gamelists, h.hideSystem))
+	sort.Strings(h.Hidden)
+	if err != nil {
+		return err
+	}
+
+	h.log().Info(i18n.T(i18n.HideDone, len(h.Hidden)))
+	if h.DryRun {
+		return nil
+	}
+
+	// record hidden games so a rescrape does not show them again
+	fb := FavBackup{
+		RomsDir:    h.RomsDir,
+		FormatJson: h.FormatJson,
+		Options:    h.backupOptions(),
+	}
+	return fb.BackupContext(ctx)
+}
+
+func (h *Hider) hideSystem(gamelist string) (int, error) {
+
+	systemPath := filepath.Dir(gamelist)
+	system := filepath.Base(systemPath)
+
+	var rules []HideRule
+	for _, rule := range h.rules() {
+		if rule.MatchSystem(system) {
+			rules = append(rules, rule)
+		}
+	}
+	if len(rules) == 0 {
+		return 0, nil
+	}
+
+	doc, enc, err := vfs.ReadXml(h.fs(), gamelist)
+	if err != nil {
+		return 0, err
+	}
+
+	nodes := xmlquery.Find(doc, "//game")
+	var companions map[string]bool
+
+	var hidden []string
+	for _, node := range nodes {
+		romPath := childText(node, "path")
+		if romPath == "" || normalizeBool(childText(node, "hidden")) == "true" || !h.Filter.MatchNode(node) {
+			continue
+		}
+
+		for _, rule := range rules {
+			match := rule.MatchRom(romPath)
+			if !match && rule.Companions {
+				if companions == nil {
+					companions = companionFiles(h.fs(), systemPath, nodes, h.log())
+				}
+				match = companions[resolvePath(systemPath, romPath)]
+			}
+			if !match {
+				continue
+			}
+
+			h.log().Debug(i18n.T(i18n.HideGame, romPath), logger.System(gamelist), logger.Rom(romPath))
+			xml.ReplaceChildNode(node, xml.NewNode("hidden", "true"))
+			h.addHidden(systemPath, romPath)
+			hidden = append(hidden, romPath)
+			break
+		}
+	}
+
+	if len(hidden) == 0 || h.DryRun {
+		return 0, nil
+	}
+
+	if h.NormalizeUTF8 {
+		enc = xml.UTF8
+	}
+	if err := vfs.WriteXml(h.fs(), gamelist, doc, enc); err != nil {
+		return 0, err
+	}
+	h.observer().FileWritten(gamelist, gamelist)
+	// games are hidden once written
+	for _, romPath := range hidden {
+		h.observer().GameUpdated(gamelist, romPath)
+	}
+	return len(hidden), nil
+}
+
+func (h *Hider) addHidden(systemPath, romPath string) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.Hidden = append(h.Hidden, filepath.Join(systemPath, romPath))
+}
+
+// companionFiles returns the cleaned paths of the files referenced by the multi-file roms of the gamelist
+func companionFiles(fsys vfs.FS, systemPath string, nodes []*xmlquery.Node, log logger.Logger) map[string]bool {
+	companions := make(map[string]bool)
+
+	for _, node := range nodes {
+		romPath := childText(node, "path")
+		if romPath == "" {
+			continue
+		}
+		files, err := playlistFiles(fsys, resolvePath(systemPath, romPath))
+		if err != nil {
+			log.Warn(err.Error(), logger.System(systemPath), logger.Rom(romPath))
+			continue
+		}
+		for _, file := range files {
+			companions[file] = true
+		}
+	}
+
+	return companions
+}
+
+// playlistFiles returns the cleaned paths of the files a multi-file rom references :
+// tracks of a .cue or .gdi, discs of a .m3u, .img and .sub of a .ccd. It returns nil for other roms.
+func playlistFiles(fsys vfs.FS, path string) ([]string, error) {
+	dir := filepath.Dir(path)
+	ext := strings.ToLower(filepath.Ext(path))
+
+	var names []string
+	switch ext {
+	case ".ccd":
+		base := strings.TrimSuffix(path, filepath.Ext(path))
+		return []string{base + ".img", base + ".sub"}, nil
+	case ".cue", ".gdi", ".m3u":
+	default:
+		return nil, nil
+	}
+
+	f, err := fsys.Open(path)
+	if err != nil {
+		if errors.Is(err, fs.ErrNotExist) {
+			return nil, nil
+		}
+		return nil, i18n.NewError(i18n.FileOpen, err, path)
+	}
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+	for line := 0; scanner.Scan(); line++ {
+		text := strings.TrimSpace(scanner.Text())
+		switch ext {
+		case ".cue":
+			// FILE "Game (Track 1).bin" BINARY
+			if len(text) > 5 && strings.EqualFold(text[:5], "FILE ") {
+				names = append(names, cueFileName(text[5:]))
+			}
+		case ".gdi":
+			// first line is the track count, then : number lba type sector "file name" offset
+			if fields := gdiFields(text); line > 0 && len(fields) >= 5 {
+				names = append(names, fields[4])
+			}
+		case ".m3u":
+			if text != "" && !strings.HasPrefix(text, "#") {
+				names = append(names, text)
+			}
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, i18n.NewError(i18n.FileRead, err, path)
+	}
+
+	files := make([]string, 0, len(names))
+	for _, name := range names {
+		files = append(files, resolvePath(dir, filepath.FromSlash(strings.ReplaceAll(name, `\`, "/"))))
+	}
+	return files, nil
+}
+
+// cueFileName returns the file name of a cue FILE command, quoted or not, without its type
+func cueFileName(s string) string {
+	s = strings.TrimSpace(s)
+	if strings.HasPrefix(s, `"`) {
+		if end := strings.Index(s[1:], `"`); end >= 0 {
+			return s[1 : end+1]
+		}
+	}
+	if i := strings.LastIndex(s, " "); i > 0 {
+		return s[:i]
+	}
+	return s
+}
+
+// gdiFields splits a gdi line on spaces, keeping quoted file names whole
+func gdiFields(s string) []string {
+	var fields []string
+	for s = strings.TrimSpace(s); s != ""; s = strings.TrimSpace(s) {
+		if strings.HasPrefix(s, `"`) {
+			if end := strings.Index(s[1:], `"`); end >= 0 {
+				fields = append(fields, s[1:end+1])
+				s = s[end+2:]
+				continue
+			}
+		}
+		field := strings.Fields(s)[0]
+		fields = append(fields, field)
+		s = s[len(field):]
+	}
+	return fields
+}
+
+// matchGlobs reports whether the name matches one of the globs
+func matchGlobs(patterns []string, name string) bool {
+	for _, pattern := range patterns {
+		if ok, _ := filepath.Match(pattern, name); ok {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,140 @@
+package recaltools
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/jymannob/recaltools/utils"
+	"github.com/jymannob/recaltools/xml"
+)
+
+// Functional testing
+func TestHider(t *testing.T) {
+	romsDir := t.TempDir()
+	systemPath := filepath.Join(romsDir, "psx")
+	os.MkdirAll(filepath.Join(systemPath, "discs"), 0775)
+
+	files := map[string]string{
+		"Game.cue":                "FILE \"Game (Track 1).bin\" BINARY\n  TRACK 01 MODE2/2352\nFILE \"Game (Track 2).bin\" BINARY\n",
+		"Game (Track 1).bin":      "",
+		"Game (Track 2).bin":      "",
+		"Saga.m3u":                "#EXTM3U\ndiscs/Saga (Disc 1).cue\ndiscs/Saga (Disc 2).cue\n",
+		"discs/Saga (Disc 1).cue": "",
+		"discs/Saga (Disc 2).cue": "",
+		"scph1001 [BIOS].bin":     "",
+		"Other.chd":               "",
+		"Other.sav":               "",
+		"Already hidden.txt":      "",
+		"Untouched (Track 1).bin": "",
+		"../nes/Nes [BIOS].nes":   "",
+		"../nes/gamelist.xml":     "<gameList><game><path>./Nes [BIOS].nes</path></game></gameList>",
+		"../snes/Snes (BIOS).sfc": "",
+		"../snes/gamelist.xml":    "<gameList><game><path>./Snes (BIOS).sfc</path></game></gameList>",
+	}
+	writeFiles(t, systemPath, files)
+
+	gamelist := `<?xml version="1.0"?>
+<gameList>
+  <game><path>./Game.cue</path><name>Game</name></game>
+  <game><path>./Game (Track 1).bin</path><name>Game (Track 1)</name></game>
+  <game><path>./Game (Track 2).bin</path><name>Game (Track 2)</name></game>
+  <game><path>./Saga.m3u</path><name>Saga</name></game>
+  <game><path>./discs/Saga (Disc 1).cue</path><name>Saga (Disc 1)</name></game>
+  <game><path>./discs/Saga (Disc 2).cue</path><name>Saga (Disc 2)</name></game>
+  <game><path>./scph1001 [BIOS].bin</path><name>scph1001</name></game>
+  <game><path>./Other.chd</path><name>Other</name><favorite>true</favorite></game>
+  <game><path>./Other.sav</path><name>Other save</name></game>
+  <game><path>./Already hidden.txt</path><name>Already</name><hidden>true</hidden></game>
+  <game><path>./Untouched (Track 1).bin</path><name>Untouched</name></game>
+</gameList>
+`
+	if err := os.WriteFile(filepath.Join(systemPath, "gamelist.xml"), []byte(gamelist), 0664); err != nil {
+		t.Fatal(err)
+	}
+
+	// dry run, no game is updated
+	rec := &recorder{updated: make(map[string]int), written: make(map[string]int), games: make(map[string]int)}
+	h := &Hider{RomsDir: []string{romsDir}, DryRun: true, Options: Options{Observer: rec}}
+	if err := h.Hide(); err != nil {
+		t.Fatalf("Hider.Hide() error = %v", err)
+	}
+	want := []string{
+		filepath.Join(romsDir, "nes", "Nes [BIOS].nes"),
+		filepath.Join(systemPath, "Game (Track 1).bin"),
+		filepath.Join(systemPath, "Game (Track 2).bin"),
+		filepath.Join(systemPath, "Other.sav"),
+		filepath.Join(systemPath, "discs", "Saga (Disc 1).cue"),
+		filepath.Join(systemPath, "discs", "Saga (Disc 2).cue"),
+		filepath.Join(systemPath, "scph1001 [BIOS].bin"),
+		filepath.Join(romsDir, "snes", "Snes (BIOS).sfc"),
+	}
+	if !reflect.DeepEqual(h.Hidden, want) {
+		t.Errorf("Hider.Hidden = %v, want %v", h.Hidden, want)
+	}
+	if _, err := os.Stat(filepath.Join(systemPath, fileBackupName)); err == nil {
+		t.Errorf("Hider.Hide() wrote a backup in dry run")
+	}
+	if len(rec.updated) != 0 || rec.games["psx"] != 0 {
+		t.Errorf("Hider.Hide() dry run updated %v, counted %v, want no game", rec.updated, rec.games)
+	}
+
+	// rules restricted to a system
+	h = &Hider{RomsDir: []string{romsDir}, Rules: []HideRule{{Systems: []string{"psx"}, Patterns: []string{"*.SAV"}}}}
+	if err := h.Hide(); err != nil {
+		t.Fatalf("Hider.Hide() error = %v", err)
+	}
+	if want := []string{filepath.Join(systemPath, "Other.sav")}; !reflect.DeepEqual(h.Hidden, want) {
+		t.Errorf("Hider.Hidden = %v, want %v", h.Hidden, want)
+	}
+
+	// default rules, recorded in the backup
+	h = &Hider{RomsDir: []string{romsDir}}
+	if err := h.Hide(); err != nil {
+		t.Fatalf("Hider.Hide() error = %v", err)
+	}
+	if len(h.Hidden) != 7 {
+		t.Errorf("Hider.Hidden = %v, want the 7 games not hidden yet", h.Hidden)
+	}
+
+	doc, err := xml.OpenXml(filepath.Join(systemPath, "gamelist.xml"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	idx := xml.NewIndex(doc)
+	for path, hidden := range map[string]bool{
+		"./Game.cue":                false,
+		"./Game (Track 1).bin":      true,
+		"./Saga.m3u":                false,
+		"./discs/Saga (Disc 2).cue": true,
+		"./Other.chd":               false,
+		"./Untouched (Track 1).bin": false,
+	} {
+		if got := childText(idx.ByPath(path), "hidden") == "true"; got != hidden {
+			t.Errorf("%s hidden = %v, want %v", path, got, hidden)
+		}
+	}
+
+	var backup SystemBackup
+	if err := utils.ReadJsonFile(filepath.Join(systemPath, fileBackupName), &backup); err != nil {
+		t.Fatalf("backup not written : %v", err)
+	}
+	if g := backup.Games["./scph1001 [BIOS].bin"]; g == nil || !g.Hidden {
+		t.Errorf("backup of hidden BIOS = %+v", g)
+	}
+	if g := backup.Games["./Other.chd"]; g == nil || g.Hidden || !g.Favorite {
+		t.Errorf("backup of favorite = %+v", g)
+	}
+}
+
+func TestHideRule_Validate(t *testing.T) {
+	if err := (HideRule{Patterns: []string{"[BIOS"}}).Validate(); err == nil {
+		t.Errorf("HideRule.Validate() no error on a malformed pattern")
+	}
+	for _, rule := range DefaultHideRules {
+		if err := rule.Validate(); err != nil {
+			t.Errorf("DefaultHideRules Validate() error = %v", err)
+		}
+	}
+}
@@ -0,0 +1,105 @@
+/*
+Package i18n holds the catalog of user-facing messages in English and French,
+and the localised Error type returned by every recaltools package.
+*/
+package i18n
+
+import (
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+)
+
+// Lang is a catalog language
+type Lang string
+
+const (
+	English Lang = "en"
+	French  Lang = "fr"
+)
+
+var (
+	mu      sync.RWMutex
+	current = LangFromEnvironment()
+)
+
+// ParseLang returns the Lang of a locale such as `fr`, `fr_FR.UTF-8` or `en-US`, English if unknown
+func ParseLang(locale string) Lang {
+	if strings.HasPrefix(strings.ToLower(locale), string(French)) {
+		return French
+	}
+	return English
+}
+
+// LangFromEnvironment returns the Lang selected by `LC_ALL`, `LC_MESSAGES` or `LANG` (in this order)
+func LangFromEnvironment() Lang {
+	for _, name := range []string{"LC_ALL", "LC_MESSAGES", "LANG"} {
+		if env, ok := os.LookupEnv(name); ok && env != "" {
+			return ParseLang(env)
+		}
+	}
+	return English
+}
+
+// SetLang selects the language of all messages
+func SetLang(lang Lang) {
+	mu.Lock()
+	defer mu.Unlock()
+	if _, ok := catalog[lang]; ok {
+		current = lang
+	}
+}
+
+// CurrentLang returns the selected language
+func CurrentLang() Lang {
+	mu.RLock()
+	defer mu.RUnlock()
+	return current
+}
+
+// T returns the message of key in the selected language, formatted with args
+func T(key Key, args ...interface{}) string {
+	format, ok := catalog[CurrentLang()][key]
+	if !ok {
+		format, ok = catalog[English][key]
+	}
+	if !ok {
+		format = string(key)
+	}
+	return fmt.Sprintf(format, args...)
+}
+
+// Error is a localised error.
+// It wraps the underlying error for errors.Is / errors.As, and matches any Error with the same Key :
+//
+//	errors.Is(err, &i18n.Error{Key: i18n.FileNotExist})
+type Error struct {
+	Key  Key
+	Args []interface{}
+	Err  error
+}
+
+// NewError returns a localised error for key, wrapping err (can be nil)
+func NewError(key Key, err error, args ...interface{}) *Error {
+	return &Error{Key: key, Args: args, Err: err}
+}
+
+func (e *Error) Error() string {
+	msg := T(e.Key, e.Args...)
+	if e.Err != nil {
+		msg = fmt.Sprintf("%s | %v", msg, e.Err)
+	}
+	return msg
+}
+
+// Unwrap returns the underlying error
+func (e *Error) Unwrap() error {
+	return e.Err
+}
+
+// Is reports whether target is an Error with the same Key
+func (e *Error) Is(target error) bool {
+	t, ok := target.(*Error)
+	return ok && t.Key == e.Key
+}
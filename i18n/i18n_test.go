@@ -0,0 +1,110 @@
+package i18n
+
+import (
+	"errors"
+	"io/fs"
+	"os"
+	"testing"
+)
+
+func TestParseLang(t *testing.T) {
+	tests := []struct {
+		name   string
+		locale string
+		want   Lang
+	}{
+		{"fr", "fr", French},
+		{"fr_FR.UTF-8", "fr_FR.UTF-8", French},
+		{"FR-be", "FR-be", French},
+		{"en_US.UTF-8", "en_US.UTF-8", English},
+		{"C", "C", English},
+		{"empty", "", English},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := ParseLang(tt.locale); got != tt.want {
+				t.Errorf("ParseLang() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestLangFromEnvironment(t *testing.T) {
+	for _, name := range []string{"LC_ALL", "LC_MESSAGES", "LANG"} {
+		if env, ok := os.LookupEnv(name); ok {
+			defer os.Setenv(name, env)
+		}
+		os.Unsetenv(name)
+	}
+
+	if got := LangFromEnvironment(); got != English {
+		t.Errorf("LangFromEnvironment() without env = %v, want %v", got, English)
+	}
+
+	os.Setenv("LANG", "fr_FR.UTF-8")
+	defer os.Unsetenv("LANG")
+	if got := LangFromEnvironment(); got != French {
+		t.Errorf("LangFromEnvironment() with LANG = %v, want %v", got, French)
+	}
+
+	os.Setenv("LC_ALL", "en_US.UTF-8")
+	defer os.Unsetenv("LC_ALL")
+	if got := LangFromEnvironment(); got != English {
+		t.Errorf("LangFromEnvironment() with LC_ALL = %v, want %v", got, English)
+	}
+}
+
+func TestT(t *testing.T) {
+	defer SetLang(CurrentLang())
+
+	tests := []struct {
+		name string
+		lang Lang
+		key  Key
+		args []interface{}
+		want string
+	}{
+		{"English", English, EnvMissing, []interface{}{"ROMS"}, "variable `ROMS` is missing"},
+		{"French", French, EnvMissing, []interface{}{"ROMS"}, "la variable `ROMS` est manquante"},
+		{"Unknown lang is ignored", Lang("de"), EnvMissing, []interface{}{"ROMS"}, "la variable `ROMS` est manquante"},
+		{"Unknown key", English, Key("unknown.key"), nil, "unknown.key"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			SetLang(tt.lang)
+			if got := T(tt.key, tt.args...); got != tt.want {
+				t.Errorf("T() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestError(t *testing.T) {
+	defer SetLang(CurrentLang())
+	SetLang(English)
+
+	err := error(NewError(FileOpen, fs.ErrNotExist, "gamelist.xml"))
+
+	if got, want := err.Error(), "file cannot be opened : gamelist.xml | file does not exist"; got != want {
+		t.Errorf("Error() = %v, want %v", got, want)
+	}
+	if !errors.Is(err, fs.ErrNotExist) {
+		t.Errorf("errors.Is(err, fs.ErrNotExist) = false, want true")
+	}
+	if !errors.Is(err, &Error{Key: FileOpen}) {
+		t.Errorf("errors.Is(err, FileOpen) = false, want true")
+	}
+	if errors.Is(err, &Error{Key: FileRead}) {
+		t.Errorf("errors.Is(err, FileRead) = true, want false")
+	}
+
+	var e *Error
+	if !errors.As(err, &e) || e.Key != FileOpen {
+		t.Errorf("errors.As() = %v, want Key %v", e, FileOpen)
+	}
+
+	SetLang(French)
+	if got, want := NewError(EnvNotDir, nil, "/roms").Error(), "`/roms` n'est pas un répertoire valide"; got != want {
+		t.Errorf("Error() = %v, want %v", got, want)
+	}
+}
@@ -0,0 +1,399 @@
+package i18n
+
+// Key identifies a message of the catalog
+type Key string
+
+// files
+const (
+	FileOpen           Key = "file.open"
+	FileRead           Key = "file.read"
+	FileWrite          Key = "file.write"
+	FileNotExist       Key = "file.not_exist"
+	FileExists         Key = "file.exists"
+	FileMove           Key = "file.move"
+	FileDelete         Key = "file.delete"
+	XmlParse           Key = "xml.parse"
+	JsonEncode         Key = "json.encode"
+	JsonParse          Key = "json.parse"
+	CharsetUnsupported Key = "charset.unsupported"
+	CharsetDecode      Key = "charset.decode"
+	CharsetEncode      Key = "charset.encode"
+)
+
+// run
+const (
+	Interrupted    Key = "interrupted"
+	RunInterrupted Key = "run.interrupted"
+	RunFailed      Key = "run.failed"
+	SystemFailed   Key = "run.system_failed"
+)
+
+// logs
+const (
+	LogLevelInvalid  Key = "log.level_invalid"
+	LogFormatInvalid Key = "log.format_invalid"
+)
+
+// gamelists discovery
+const (
+	ScanDuplicate Key = "scan.duplicate"
+	ScanRoot      Key = "scan.root"
+	ScanDir       Key = "scan.dir"
+	Progress      Key = "progress"
+)
+
+// filters
+const (
+	FilterInvalid Key = "filter.invalid"
+	FilterDate    Key = "filter.date"
+)
+
+// gamelists layout
+const (
+	LayoutSystemUnknown Key = "layout.system_unknown"
+	LayoutBackupRestore Key = "layout.backup_restore"
+	LayoutNoSystems     Key = "layout.no_systems"
+)
+
+// EmulationStation
+const (
+	ESRunning       Key = "es.running"
+	ESForced        Key = "es.forced"
+	ESStop          Key = "es.stop"
+	ESStopFailed    Key = "es.stop_failed"
+	ESStart         Key = "es.start"
+	ESStartFailed   Key = "es.start_failed"
+	ESUnknown       Key = "es.unknown"
+	ESUnknownForced Key = "es.unknown_forced"
+)
+
+// environment
+const (
+	EnvMissing Key = "env.missing"
+	EnvNotDir  Key = "env.not_dir"
+)
+
+// backup and restore
+const (
+	GamelistFound   Key = "gamelist.found"
+	BackupFound     Key = "backup.found"
+	BackupGame      Key = "backup.game"
+	BackupWrite     Key = "backup.write"
+	BackupDone      Key = "backup.done"
+	RestoreGame     Key = "restore.game"
+	RestoreNotFound Key = "restore.not_found"
+	XmlWrite        Key = "xml.write"
+	RestoreDone     Key = "restore.done"
+)
+
+// normalize
+const (
+	NormalizeMerged   Key = "normalize.merged"
+	NormalizeDone     Key = "normalize.done"
+	NormalizeNotValid Key = "normalize.not_valid"
+)
+
+// clean
+const (
+	CleanGamelist Key = "clean.gamelist"
+	CleanRename   Key = "clean.rename"
+	CleanDone     Key = "clean.done"
+
+	CleanRuleInvalid Key = "clean.rule_invalid"
+	CleanRenameRules Key = "clean.rename_rules"
+)
+
+// prune
+const (
+	PruneGamelist Key = "prune.gamelist"
+	PruneBackup   Key = "prune.backup"
+	PruneRom      Key = "prune.rom"
+	PruneDone     Key = "prune.done"
+)
+
+// orphaned media
+const (
+	OrphansFile       Key = "orphans.file"
+	OrphansQuarantine Key = "orphans.quarantine"
+	OrphansRestore    Key = "orphans.restore"
+	OrphansEmpty      Key = "orphans.empty"
+	OrphansDone       Key = "orphans.done"
+	OrphansMediaDir   Key = "orphans.media_dir"
+)
+
+// missing media
+const (
+	MissingFile   Key = "missing.file"
+	MissingRelink Key = "missing.relink"
+	MissingDone   Key = "missing.done"
+)
+
+// trash
+const (
+	TrashPut           Key = "trash.put"
+	TrashRestore       Key = "trash.restore"
+	TrashRestoreFailed Key = "trash.restore_failed"
+	TrashAge           Key = "trash.age"
+	TrashEntry         Key = "trash.entry"
+	TrashRestored      Key = "trash.restored"
+	TrashDeleted       Key = "trash.deleted"
+	TrashDone          Key = "trash.done"
+)
+
+// disk usage
+const (
+	UsageSystem        Key = "usage.system"
+	UsageSortInvalid   Key = "usage.sort.invalid"
+	UsageFormatInvalid Key = "usage.format.invalid"
+	UsageFormat        Key = "usage.format"
+	UsageDone          Key = "usage.done"
+)
+
+// hidden games
+const (
+	HideGame        Key = "hide.game"
+	HideRuleInvalid Key = "hide.rule.invalid"
+	HideDone        Key = "hide.done"
+)
+
+// rom renaming
+const (
+	RenameRom      Key = "rename.rom"
+	RenameInvalid  Key = "rename.invalid"
+	RenameExists   Key = "rename.exists"
+	RenameDone     Key = "rename.done"
+	RenamePlaylist Key = "rename.playlist"
+)
+
+// multi-disc games
+const (
+	DiscsPlaylist Key = "discs.playlist"
+	DiscsDone     Key = "discs.done"
+)
+
+var catalog = map[Lang]map[Key]string{
+	English: {
+		FileOpen:           "file cannot be opened : %s",
+		FileRead:           "file cannot be read : %s",
+		FileWrite:          "file cannot be written : %s",
+		FileNotExist:       "file does not exist : %s",
+		FileExists:         "file %s already exists and cannot be deleted",
+		FileMove:           "file %s cannot be moved to %s",
+		FileDelete:         "file or directory %s cannot be deleted",
+		XmlParse:           "cannot parse Xml : %s",
+		JsonEncode:         "data cannot be converted to Json : %s",
+		JsonParse:          "cannot parse Json : %s",
+		CharsetUnsupported: "unsupported encoding : %s",
+		CharsetDecode:      "cannot decode file from %s",
+		CharsetEncode:      "cannot encode file to %s",
+
+		RunInterrupted: "run interrupted : %v",
+		RunFailed:      "%d of %d gamelists failed :",
+		SystemFailed:   "%s : %v",
+		Interrupted:    "Interrupted, waiting for running gamelists to be written (interrupt again to quit now)",
+
+		LogLevelInvalid:  "unknown log level `%s` (error, warn, info, debug, trace)",
+		LogFormatInvalid: "unknown log format `%s` (text, json)",
+
+		ScanDuplicate: "%s already scanned as %s",
+		ScanRoot:      "roms directory %s can not be read",
+		ScanDir:       "directory %s can not be read, skipped",
+		Progress:      "[%s] %d/%d %s : %d games, %d failed",
+
+		FilterInvalid: "invalid filter : %s",
+		FilterDate:    "invalid date : %s (YYYY-MM-DD)",
+
+		LayoutSystemUnknown: "no ROM directory for system %s of %s, is it in es_systems.cfg ?",
+		LayoutBackupRestore: "--es-systems and --es-gamelists only apply to backup and restore, other commands expect gamelist.xml in the ROM directory of its system",
+		LayoutNoSystems:     "--es-gamelists needs --es-systems giving the ROM directory of its systems",
+
+		ESRunning:       "EmulationStation is running (pid %d) and would overwrite the gamelists when exiting, stop it, set --es-stop or use --force",
+		ESUnknown:       "cannot tell whether EmulationStation is running, stop it and use --force",
+		ESUnknownForced: "cannot tell whether EmulationStation is running, gamelists are written anyway",
+		ESForced:        "EmulationStation is running (pid %d), gamelists are written anyway",
+		ESStop:          "Stop EmulationStation (pid %d)",
+		ESStopFailed:    "cannot stop EmulationStation with `%s`",
+		ESStart:         "Start EmulationStation",
+		ESStartFailed:   "cannot start EmulationStation with `%s`",
+
+		EnvMissing: "variable `%s` is missing",
+		EnvNotDir:  "`%s` is not a valid directory",
+
+		GamelistFound:   "%s Found",
+		BackupFound:     "%s Found backup",
+		BackupGame:      "Backup game : %s",
+		BackupWrite:     "Write Json file : %s",
+		BackupDone:      "Backup Done !",
+		RestoreGame:     "Restore game : %s",
+		RestoreNotFound: "Game not found in gamelist : %s",
+		XmlWrite:        "Write Xml file : %s (%s)",
+		RestoreDone:     "Restore Done !",
+
+		NormalizeMerged:   "%s : %d duplicated entries merged",
+		NormalizeDone:     "Normalize Done !",
+		NormalizeNotValid: "%s is not normalized",
+
+		CleanGamelist: "%s : %d scraped elements deleted",
+		CleanRename:   "Rename %s to %s",
+		CleanDone:     "Clean Done !",
+
+		CleanRuleInvalid: "invalid clean rule : %s",
+		CleanRenameRules: "--rename renames whole gamelists, fields, filters and game filters can not be applied",
+
+		PruneGamelist: "%s : %d entries without rom",
+		PruneBackup:   "%s : %d backup entries without rom",
+		PruneRom:      "Missing rom : %s",
+		PruneDone:     "Prune Done !",
+
+		OrphansFile:       "Orphaned media : %s (%s)",
+		OrphansQuarantine: "Quarantine %s",
+		OrphansRestore:    "Restore %s",
+		OrphansEmpty:      "Empty %s",
+		OrphansDone:       "%d orphaned media, %s",
+		OrphansMediaDir:   "media folder %s is not a sub folder of the system directory",
+
+		MissingFile:   "Missing media : %s (%s of %s)",
+		MissingRelink: "Relink %s to %s",
+		MissingDone:   "%d missing media",
+
+		TrashPut:           "%s cannot be moved to the trash",
+		TrashRestore:       "%s cannot be restored from the trash",
+		TrashRestoreFailed: "%d trashed files cannot be restored",
+		TrashAge:           "invalid age : %s",
+		TrashEntry:         "%s  %s  %s (%s)",
+		TrashRestored:      "Restore %s",
+		TrashDeleted:       "Delete %s",
+		TrashDone:          "%d trashed files, %s",
+
+		UsageSystem:        "System %s : %s",
+		UsageSortInvalid:   "invalid sort : %s (name, roms, media, saves or total)",
+		UsageFormatInvalid: "invalid format : %s (text, json or csv)",
+		UsageFormat:        "%-20s %10s %10s %10s %10s",
+		UsageDone:          "%d systems : roms %s, media %s, saves %s, total %s",
+
+		HideGame:        "Hide %s",
+		HideRuleInvalid: "invalid hide rule : %s",
+		HideDone:        "%d games hidden",
+
+		RenameRom:      "Rename %s to %s",
+		RenamePlaylist: "Update the renamed discs of %s",
+		RenameInvalid:  "invalid rename : %s",
+		RenameExists:   "%s cannot be renamed, %s already exists",
+		RenameDone:     "%d roms renamed",
+
+		DiscsPlaylist: "Playlist %s (%d discs)",
+		DiscsDone:     "%d playlists created",
+	},
+	French: {
+		FileOpen:           "impossible d'ouvrir le fichier : %s",
+		FileRead:           "impossible de lire le fichier : %s",
+		FileWrite:          "impossible d'écrire dans le fichier : %s",
+		FileNotExist:       "le fichier n'existe pas : %s",
+		FileExists:         "le fichier %s existe déjà et ne peut pas être supprimé",
+		FileMove:           "impossible de déplacer le fichier %s vers %s",
+		FileDelete:         "impossible de supprimer le fichier ou répertoire %s",
+		XmlParse:           "impossible de parser le xml : %s",
+		JsonEncode:         "impossible de convertir les données en Json : %s",
+		JsonParse:          "impossible de parser le Json : %s",
+		CharsetUnsupported: "encodage non supporté : %s",
+		CharsetDecode:      "impossible de décoder le fichier depuis %s",
+		CharsetEncode:      "impossible d'encoder le fichier en %s",
+
+		RunInterrupted: "exécution interrompue : %v",
+		RunFailed:      "%d gamelists sur %d en échec :",
+		SystemFailed:   "%s : %v",
+		Interrupted:    "Interruption, attente de l'écriture des gamelists en cours (interrompre à nouveau pour quitter immédiatement)",
+
+		LogLevelInvalid:  "niveau de log `%s` inconnu (error, warn, info, debug, trace)",
+		LogFormatInvalid: "format de log `%s` inconnu (text, json)",
+
+		ScanDuplicate: "%s déjà parcouru en tant que %s",
+		ScanRoot:      "le dossier de roms %s ne peut pas être lu",
+		ScanDir:       "le dossier %s ne peut pas être lu, ignoré",
+		Progress:      "[%s] %d/%d %s : %d jeux, %d en échec",
+
+		FilterInvalid: "filtre invalide : %s",
+		FilterDate:    "date invalide : %s (AAAA-MM-JJ)",
+
+		LayoutSystemUnknown: "aucun répertoire de roms pour le système %s de %s, est-il dans es_systems.cfg ?",
+		LayoutBackupRestore: "--es-systems et --es-gamelists ne s'appliquent qu'à backup et restore, les autres commandes attendent gamelist.xml dans le répertoire de roms de son système",
+		LayoutNoSystems:     "--es-gamelists a besoin de --es-systems donnant le répertoire de roms de ses systèmes",
+
+		ESRunning:       "EmulationStation est lancé (pid %d) et écraserait les gamelists en quittant, arrêtez-le, renseignez --es-stop ou utilisez --force",
+		ESUnknown:       "impossible de savoir si EmulationStation est lancé, arrêtez-le et utilisez --force",
+		ESUnknownForced: "impossible de savoir si EmulationStation est lancé, les gamelists sont écrites malgré tout",
+		ESForced:        "EmulationStation est lancé (pid %d), les gamelists sont écrites malgré tout",
+		ESStop:          "Arrêt d'EmulationStation (pid %d)",
+		ESStopFailed:    "impossible d'arrêter EmulationStation avec `%s`",
+		ESStart:         "Démarrage d'EmulationStation",
+		ESStartFailed:   "impossible de démarrer EmulationStation avec `%s`",
+
+		EnvMissing: "la variable `%s` est manquante",
+		EnvNotDir:  "`%s` n'est pas un répertoire valide",
+
+		GamelistFound:   "%s trouvé",
+		BackupFound:     "%s sauvegarde trouvée",
+		BackupGame:      "Sauvegarde du jeu : %s",
+		BackupWrite:     "Écriture du fichier Json : %s",
+		BackupDone:      "Sauvegarde terminée !",
+		RestoreGame:     "Restauration du jeu : %s",
+		RestoreNotFound: "Jeu absent de la gamelist : %s",
+		XmlWrite:        "Écriture du fichier Xml : %s (%s)",
+		RestoreDone:     "Restauration terminée !",
+
+		NormalizeMerged:   "%s : %d entrées en double fusionnées",
+		NormalizeDone:     "Normalisation terminée !",
+		NormalizeNotValid: "%s n'est pas normalisé",
+
+		CleanGamelist: "%s : %d éléments de scraping supprimés",
+		CleanRename:   "Renommage de %s en %s",
+		CleanDone:     "Nettoyage terminé !",
+
+		CleanRuleInvalid: "règle de nettoyage invalide : %s",
+		CleanRenameRules: "--rename renomme des gamelists entières, les éléments, filtres et filtres de jeux ne peuvent pas s'appliquer",
+
+		PruneGamelist: "%s : %d entrées sans rom",
+		PruneBackup:   "%s : %d entrées de sauvegarde sans rom",
+		PruneRom:      "Rom manquante : %s",
+		PruneDone:     "Nettoyage des roms manquantes terminé !",
+
+		OrphansFile:       "Média orphelin : %s (%s)",
+		OrphansQuarantine: "Mise en quarantaine de %s",
+		OrphansRestore:    "Restauration de %s",
+		OrphansEmpty:      "Suppression de %s",
+		OrphansDone:       "%d médias orphelins, %s",
+		OrphansMediaDir:   "le dossier de médias %s n'est pas un sous-dossier du répertoire du système",
+
+		MissingFile:   "Média manquant : %s (%s de %s)",
+		MissingRelink: "Nouveau lien de %s vers %s",
+		MissingDone:   "%d médias manquants",
+
+		TrashPut:           "%s ne peut pas être déplacé dans la corbeille",
+		TrashRestore:       "%s ne peut pas être restauré depuis la corbeille",
+		TrashRestoreFailed: "%d fichiers de la corbeille ne peuvent pas être restaurés",
+		TrashAge:           "durée invalide : %s",
+		TrashEntry:         "%s  %s  %s (%s)",
+		TrashRestored:      "Restauration de %s",
+		TrashDeleted:       "Suppression de %s",
+		TrashDone:          "%d fichiers dans la corbeille, %s",
+
+		UsageSystem:        "Système %s : %s",
+		UsageSortInvalid:   "tri invalide : %s (name, roms, media, saves ou total)",
+		UsageFormatInvalid: "format invalide : %s (text, json ou csv)",
+		UsageFormat:        "%-20s %10s %10s %10s %10s",
+		UsageDone:          "%d systèmes : roms %s, médias %s, sauvegardes %s, total %s",
+
+		HideGame:        "Masquage de %s",
+		HideRuleInvalid: "règle de masquage invalide : %s",
+		HideDone:        "%d jeux masqués",
+
+		RenameRom:      "Renommage de %s en %s",
+		RenamePlaylist: "Mise à jour des disques renommés de %s",
+		RenameInvalid:  "renommage invalide : %s",
+		RenameExists:   "%s ne peut pas être renommé, %s existe déjà",
+		RenameDone:     "%d roms renommées",
+
+		DiscsPlaylist: "Playlist %s (%d disques)",
+		DiscsDone:     "%d playlists créées",
+	},
+}
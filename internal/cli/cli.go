@@ -0,0 +1,128 @@
+/*
+Package cli holds what the recaltools and gamelist-backup commands share.
+*/
+package cli
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/signal"
+	"syscall"
+
+	"github.com/jymannob/recaltools"
+	"github.com/jymannob/recaltools/i18n"
+	"github.com/jymannob/recaltools/logger"
+	"github.com/jymannob/recaltools/vfs"
+)
+
+// Exit codes, so wrappers can tell a partial failure from a total one
+const (
+	ExitSuccess     = 0
+	ExitFailure     = 1   // every gamelist failed, or the command could not run
+	ExitPartial     = 2   // some gamelists failed
+	ExitInterrupted = 130 // interrupted by SIGINT or SIGTERM
+)
+
+// InterruptContext returns a context cancelled on SIGINT or SIGTERM, so running gamelists are written
+// before exiting. A second signal exits immediately.
+func InterruptContext(logs logger.Logger) context.Context {
+	ctx, cancel := context.WithCancel(context.Background())
+
+	signals := make(chan os.Signal, 2)
+	signal.Notify(signals, os.Interrupt, syscall.SIGTERM)
+	go func() {
+		<-signals
+		logs.Warn(i18n.T(i18n.Interrupted))
+		cancel()
+		<-signals
+		os.Exit(ExitInterrupted)
+	}()
+
+	return ctx
+}
+
+// Interrupted returns the error of a run ended with err : once a signal is received the run is interrupted,
+// even if every gamelist it started has been written
+func Interrupted(ctx context.Context, err error) error {
+	if ctx.Err() == nil || errors.Is(err, context.Canceled) {
+		return err
+	}
+	if err == nil {
+		return ctx.Err()
+	}
+	return fmt.Errorf("%v | %w", err, ctx.Err())
+}
+
+// ExitCode returns the exit code of a command ended with err
+func ExitCode(err error) int {
+	var runErr *recaltools.RunError
+	switch {
+	case err == nil:
+		return ExitSuccess
+	case errors.Is(err, context.Canceled):
+		return ExitInterrupted
+	case errors.As(err, &runErr) && runErr.Partial():
+		return ExitPartial
+	default:
+		return ExitFailure
+	}
+}
+
+// NewLogger returns the logger set by the log flags : level name, format name and file, stderr if empty.
+// The level is debug if verbose and no level is given.
+func NewLogger(levelName, formatName, file string, verbose bool) (logger.Logger, error) {
+	level := logger.LevelInfo
+	if verbose {
+		level = logger.LevelDebug
+	}
+	if levelName != "" {
+		var err error
+		if level, err = logger.ParseLevel(levelName); err != nil {
+			return nil, err
+		}
+	}
+
+	format, err := logger.ParseFormat(formatName)
+	if err != nil {
+		return nil, err
+	}
+
+	out := io.Writer(os.Stderr)
+	if file != "" {
+		f, err := os.OpenFile(file, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0664)
+		if err != nil {
+			return nil, i18n.NewError(i18n.FileWrite, err, file)
+		}
+		out = f
+	}
+
+	return logger.New(out, level, format), nil
+}
+
+// NewLayout returns the EmulationStation home layout of the es_systems.cfg esSystems and the gamelists directory
+// esGamelists, DefaultGamelistsDir if empty. It returns nil, the ROM directory layout, if both are empty.
+func NewLayout(esSystems, esGamelists string) (recaltools.Layout, error) {
+	if esSystems == "" && esGamelists == "" {
+		return nil, nil
+	}
+	if esSystems == "" {
+		return nil, i18n.NewError(i18n.LayoutNoSystems, nil)
+	}
+	systems, err := recaltools.ReadESSystems(vfs.OS{}, esSystems)
+	if err != nil {
+		return nil, err
+	}
+	return recaltools.HomeLayout{GamelistsDir: esGamelists, Systems: systems}, nil
+}
+
+// DefaultRomsDir returns the directories scanned when none is given : the gamelists directory of a home layout,
+// defaults otherwise
+func DefaultRomsDir(layout recaltools.Layout, defaults ...string) []string {
+	if home, ok := layout.(recaltools.HomeLayout); ok {
+		return []string{home.Dir()}
+	}
+	return defaults
+}
@@ -0,0 +1,105 @@
+package cli
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/jymannob/recaltools"
+	"github.com/jymannob/recaltools/i18n"
+	"github.com/jymannob/recaltools/logger"
+)
+
+func TestExitCode(t *testing.T) {
+	failure := &recaltools.SystemError{Path: "nes/gamelist.xml", Err: errors.New("broken")}
+
+	tests := []struct {
+		name string
+		err  error
+		want int
+	}{
+		{"Success", nil, ExitSuccess},
+		{"Failure", errors.New("no roms directory"), ExitFailure},
+		{"Every gamelist failed", &recaltools.RunError{Failures: []*recaltools.SystemError{failure}, Total: 1}, ExitFailure},
+		{"Some gamelists failed", &recaltools.RunError{Failures: []*recaltools.SystemError{failure}, Total: 2}, ExitPartial},
+		{"Interrupted", &recaltools.RunError{Total: 1, Err: context.Canceled}, ExitInterrupted},
+		{"Interrupted while stopping", fmt.Errorf("stop : %w", context.Canceled), ExitInterrupted},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := ExitCode(tt.err); got != tt.want {
+				t.Errorf("ExitCode() = %d, want %d", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestInterrupted(t *testing.T) {
+	partial := &recaltools.RunError{Failures: []*recaltools.SystemError{{Path: "nes/gamelist.xml", Err: errors.New("broken")}}, Total: 2}
+	interrupted, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	tests := []struct {
+		name string
+		ctx  context.Context
+		err  error
+		want int
+	}{
+		{"Not interrupted", context.Background(), nil, ExitSuccess},
+		{"Not interrupted failure", context.Background(), partial, ExitPartial},
+		{"Interrupted after the last gamelist", interrupted, nil, ExitInterrupted},
+		{"Interrupted failure", interrupted, partial, ExitInterrupted},
+		{"Interrupted run", interrupted, &recaltools.RunError{Total: 1, Err: context.Canceled}, ExitInterrupted},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := ExitCode(Interrupted(tt.ctx, tt.err)); got != tt.want {
+				t.Errorf("ExitCode(Interrupted()) = %d, want %d", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestNewLogger(t *testing.T) {
+	logs, err := NewLogger("", "json", filepath.Join(t.TempDir(), "run.log"), true)
+	if err != nil {
+		t.Fatalf("NewLogger() error = %v", err)
+	}
+	if !logs.Enabled(logger.LevelDebug) || logs.Enabled(logger.LevelTrace) {
+		t.Errorf("NewLogger() verbose is not at debug level")
+	}
+
+	for _, args := range [][]string{{"loud", "text", ""}, {"info", "xml", ""}, {"info", "text", t.TempDir()}} {
+		if _, err := NewLogger(args[0], args[1], args[2], false); err == nil {
+			t.Errorf("NewLogger(%v) error = nil", args)
+		}
+	}
+}
+
+func TestNewLayout(t *testing.T) {
+	cfg := filepath.Join(t.TempDir(), "es_systems.cfg")
+	if err := os.WriteFile(cfg, []byte(`<systemList><system><name>snes</name><path>/roms/snes</path></system></systemList>`), 0664); err != nil {
+		t.Fatal(err)
+	}
+
+	if layout, err := NewLayout("", ""); layout != nil || err != nil {
+		t.Errorf("NewLayout() without flags = %v, %v, want nil", layout, err)
+	}
+	if _, err := NewLayout("", "gamelists"); !errors.Is(err, &i18n.Error{Key: i18n.LayoutNoSystems}) {
+		t.Errorf("NewLayout() without es_systems.cfg error = %v, want LayoutNoSystems", err)
+	}
+
+	layout, err := NewLayout(cfg, "gamelists")
+	if err != nil {
+		t.Fatalf("NewLayout() error = %v", err)
+	}
+	if got := DefaultRomsDir(layout, "roms"); len(got) != 1 || got[0] != "gamelists" {
+		t.Errorf("DefaultRomsDir() = %v, want the gamelists directory", got)
+	}
+	if got := DefaultRomsDir(nil, "roms"); len(got) != 1 || got[0] != "roms" {
+		t.Errorf("DefaultRomsDir() without layout = %v, want the defaults", got)
+	}
+}
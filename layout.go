@@ -0,0 +1,89 @@
+package recaltools
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/antchfx/xmlquery"
+	"github.com/jymannob/recaltools/i18n"
+	"github.com/jymannob/recaltools/vfs"
+)
+
+// Layout maps a gamelist to the ROM directory of its system, relative `path` elements are relative to it
+type Layout interface {
+	RomDir(gamelist string) (string, error)
+}
+
+// RomDirLayout is the Recalbox layout, each `gamelist.xml` is in the ROM directory of its system
+type RomDirLayout struct{}
+
+func (RomDirLayout) RomDir(gamelist string) (string, error) {
+	return filepath.Dir(gamelist), nil
+}
+
+// DefaultGamelistsDir is the directory of the EmulationStation home layout gamelists
+const DefaultGamelistsDir = "~/.emulationstation/gamelists"
+
+// HomeLayout is the EmulationStation home layout, `<GamelistsDir>/<system>/gamelist.xml` lists the roms of
+// the ROM directory of the system. Gamelists out of GamelistsDir are in the ROM directory of their system.
+type HomeLayout struct {
+	GamelistsDir string            // DefaultGamelistsDir if empty
+	Systems      map[string]string // ROM directory by system name, see ReadESSystems
+}
+
+// Dir returns the directory of the `<system>/gamelist.xml`, `~` expanded
+func (l HomeLayout) Dir() string {
+	if l.GamelistsDir == "" {
+		return expandHome(DefaultGamelistsDir)
+	}
+	return expandHome(l.GamelistsDir)
+}
+
+func (l HomeLayout) RomDir(gamelist string) (string, error) {
+	dir, _ := filepath.Abs(l.Dir())
+	abs, _ := filepath.Abs(gamelist)
+
+	// only `<GamelistsDir>/<system>/gamelist.xml` follows the home layout
+	rel, err := filepath.Rel(dir, filepath.Dir(abs))
+	if err != nil || rel == "." || rel == ".." || strings.ContainsRune(rel, filepath.Separator) {
+		return RomDirLayout{}.RomDir(gamelist)
+	}
+
+	romDir, ok := l.Systems[rel]
+	if !ok {
+		return "", i18n.NewError(i18n.LayoutSystemUnknown, nil, rel, gamelist)
+	}
+	return romDir, nil
+}
+
+// ReadESSystems reads the ROM directory of each system of the EmulationStation `es_systems.cfg` file of fsys,
+// vfs.OS if nil
+func ReadESSystems(fsys vfs.FS, file string) (map[string]string, error) {
+	doc, _, err := vfs.ReadXml(vfs.Default(fsys), file)
+	if err != nil {
+		return nil, err
+	}
+
+	systems := make(map[string]string)
+	for _, node := range xmlquery.Find(doc, "//system") {
+		name, romDir := childText(node, "name"), childText(node, "path")
+		if name == "" || romDir == "" {
+			continue
+		}
+		systems[name] = filepath.Clean(expandHome(romDir))
+	}
+	return systems, nil
+}
+
+// expandHome replaces the `~` EmulationStation writes for the home directory
+func expandHome(path string) string {
+	if path != "~" && !strings.HasPrefix(path, "~/") {
+		return path
+	}
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return path
+	}
+	return filepath.Join(home, strings.TrimPrefix(path, "~"))
+}
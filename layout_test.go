@@ -0,0 +1,100 @@
+package recaltools
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/jymannob/recaltools/i18n"
+	"github.com/jymannob/recaltools/vfs"
+)
+
+func TestHomeLayout_RomDir(t *testing.T) {
+	dir := t.TempDir()
+	layout := HomeLayout{
+		GamelistsDir: filepath.Join(dir, "gamelists"),
+		Systems:      map[string]string{"snes": filepath.Join(dir, "roms", "snes")},
+	}
+
+	tests := []struct {
+		name     string
+		gamelist string
+		want     string
+		wantErr  bool
+	}{
+		{"Home layout", filepath.Join(dir, "gamelists", "snes", "gamelist.xml"), filepath.Join(dir, "roms", "snes"), false},
+		{"ROM directory layout", filepath.Join(dir, "roms", "nes", "gamelist.xml"), filepath.Join(dir, "roms", "nes"), false},
+		{"Not a system", filepath.Join(dir, "gamelists", "gamelist.xml"), filepath.Join(dir, "gamelists"), false},
+		{"Unknown system", filepath.Join(dir, "gamelists", "gba", "gamelist.xml"), "", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := layout.RomDir(tt.gamelist)
+			if (err != nil) != tt.wantErr || (err != nil && !errors.Is(err, &i18n.Error{Key: i18n.LayoutSystemUnknown})) {
+				t.Fatalf("HomeLayout.RomDir() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("HomeLayout.RomDir() = %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestReadESSystems(t *testing.T) {
+	home, err := os.UserHomeDir()
+	if err != nil {
+		t.Skip(err)
+	}
+	cfg := `<systemList>` +
+		`<system><name>snes</name><fullname>Super Nintendo</fullname><path>~/roms/snes</path></system>` +
+		`<system><name>nes</name><path>/roms/nes/</path></system>` +
+		`<system><name>empty</name></system>` +
+		`</systemList>`
+	mem := vfs.NewMem()
+	if err := mem.WriteFile("es_systems.cfg", []byte(cfg)); err != nil {
+		t.Fatal(err)
+	}
+
+	systems, err := ReadESSystems(mem, "es_systems.cfg")
+	if err != nil {
+		t.Fatalf("ReadESSystems() error = %v", err)
+	}
+	if len(systems) != 2 || systems["snes"] != filepath.Join(home, "roms", "snes") || systems["nes"] != filepath.Clean("/roms/nes") {
+		t.Errorf("ReadESSystems() = %v", systems)
+	}
+}
+
+func TestFavBackup_Restore_homeLayout(t *testing.T) {
+	romDir := filepath.Join(string(filepath.Separator), "home", "pi", "roms", "snes")
+	gamelist := filepath.Join("gamelists", "snes", "gamelist.xml")
+
+	// ES writes absolute paths for roms out of its gamelists directory, the backup holds relative ones
+	mem := vfs.NewMem()
+	if err := mem.WriteFile(gamelist, []byte(`<gameList><game><path>`+filepath.Join(romDir, "Mario.sfc")+`</path></game></gameList>`)); err != nil {
+		t.Fatal(err)
+	}
+	if err := vfs.WriteJson(mem, filepath.Join("gamelists", "snes", fileBackupName), SystemBackup{Games: map[string]*Game{
+		"./Mario.sfc": {RomPath: "./Mario.sfc", Favorite: true},
+	}}, false); err != nil {
+		t.Fatal(err)
+	}
+
+	fb := &FavBackup{
+		RomsDir: []string{"gamelists"},
+		Layout:  HomeLayout{GamelistsDir: "gamelists", Systems: map[string]string{"snes": romDir}},
+		Options: Options{FS: mem},
+	}
+	if err := fb.Restore(); err != nil {
+		t.Fatalf("FavBackup.Restore() error = %v", err)
+	}
+
+	restored, err := mem.ReadFile(gamelist)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(restored), "<favorite>true</favorite>") {
+		t.Errorf("FavBackup.Restore() = %s, want Mario.sfc restored", restored)
+	}
+}
@@ -0,0 +1,206 @@
+/*
+Package logger writes levelled logs with fields, as text or JSON lines.
+*/
+package logger
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/jymannob/recaltools/i18n"
+)
+
+// Level is the importance of a log, a logger writes the logs up to its level
+type Level int
+
+const (
+	LevelError Level = iota
+	LevelWarn
+	LevelInfo
+	LevelDebug
+	LevelTrace
+)
+
+var levelNames = []string{"error", "warn", "info", "debug", "trace"}
+
+func (l Level) String() string {
+	if l < LevelError || l > LevelTrace {
+		return strconv.Itoa(int(l))
+	}
+	return levelNames[l]
+}
+
+// ParseLevel returns the level named s (error, warn, info, debug, trace)
+func ParseLevel(s string) (Level, error) {
+	for level, name := range levelNames {
+		if strings.EqualFold(s, name) {
+			return Level(level), nil
+		}
+	}
+	return LevelInfo, i18n.NewError(i18n.LogLevelInvalid, nil, s)
+}
+
+// Format is the layout of the written lines
+type Format string
+
+const (
+	Text Format = "text" // date, level, message then key=value fields
+	Json Format = "json" // one json object per line
+)
+
+// ParseFormat returns the format named s (text, json)
+func ParseFormat(s string) (Format, error) {
+	switch Format(strings.ToLower(s)) {
+	case "", Text:
+		return Text, nil
+	case Json:
+		return Json, nil
+	}
+	return Text, i18n.NewError(i18n.LogFormatInvalid, nil, s)
+}
+
+// Field is a value attached to a log
+type Field struct {
+	Key   string
+	Value interface{}
+}
+
+// F returns a field
+func F(key string, value interface{}) Field {
+	return Field{Key: key, Value: value}
+}
+
+// System returns the field of the system, its directory or gamelist
+func System(path string) Field {
+	return Field{Key: "system", Value: path}
+}
+
+// Rom returns the field of the rom path, as written in the gamelist
+func Rom(path string) Field {
+	return Field{Key: "rom", Value: path}
+}
+
+// Err returns the field of an error
+func Err(err error) Field {
+	return Field{Key: "error", Value: err}
+}
+
+// Logger writes logs, it must be safe for concurrent use
+type Logger interface {
+	Error(msg string, fields ...Field)
+	Warn(msg string, fields ...Field)
+	Info(msg string, fields ...Field)
+	Debug(msg string, fields ...Field)
+	Trace(msg string, fields ...Field)
+	Enabled(level Level) bool // false if logs of level are dropped, to skip building them
+}
+
+// Discard drops every log
+var Discard Logger = discard{}
+
+type discard struct{}
+
+func (discard) Error(msg string, fields ...Field) {}
+func (discard) Warn(msg string, fields ...Field)  {}
+func (discard) Info(msg string, fields ...Field)  {}
+func (discard) Debug(msg string, fields ...Field) {}
+func (discard) Trace(msg string, fields ...Field) {}
+func (discard) Enabled(level Level) bool          { return false }
+
+// writer writes the logs up to its level to w
+type writer struct {
+	mu     sync.Mutex
+	w      io.Writer
+	level  Level
+	format Format
+	now    func() time.Time
+}
+
+// New returns a logger writing the logs up to level to w
+func New(w io.Writer, level Level, format Format) Logger {
+	return &writer{w: w, level: level, format: format, now: time.Now}
+}
+
+// Std returns a text logger writing the logs up to level to stderr
+func Std(level Level) Logger {
+	return New(os.Stderr, level, Text)
+}
+
+func (l *writer) Error(msg string, fields ...Field) { l.log(LevelError, msg, fields) }
+func (l *writer) Warn(msg string, fields ...Field)  { l.log(LevelWarn, msg, fields) }
+func (l *writer) Info(msg string, fields ...Field)  { l.log(LevelInfo, msg, fields) }
+func (l *writer) Debug(msg string, fields ...Field) { l.log(LevelDebug, msg, fields) }
+func (l *writer) Trace(msg string, fields ...Field) { l.log(LevelTrace, msg, fields) }
+
+func (l *writer) Enabled(level Level) bool {
+	return level <= l.level
+}
+
+func (l *writer) log(level Level, msg string, fields []Field) {
+	if !l.Enabled(level) {
+		return
+	}
+
+	var buf bytes.Buffer
+	if l.format == Json {
+		writeJson(&buf, l.now(), level, msg, fields)
+	} else {
+		writeText(&buf, l.now(), level, msg, fields)
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.w.Write(buf.Bytes())
+}
+
+// writeText writes `2006/01/02 15:04:05 LEVEL message key=value`
+func writeText(buf *bytes.Buffer, t time.Time, level Level, msg string, fields []Field) {
+	buf.WriteString(t.Format("2006/01/02 15:04:05 "))
+	buf.WriteString(strings.ToUpper(level.String()))
+	buf.WriteByte(' ')
+	buf.WriteString(msg)
+	for _, field := range fields {
+		value := fmt.Sprint(field.Value)
+		if value == "" || strings.ContainsAny(value, " \t\n\"=") {
+			value = strconv.Quote(value)
+		}
+		buf.WriteString(" " + field.Key + "=" + value)
+	}
+	buf.WriteByte('\n')
+}
+
+// writeJson writes `{"time":...,"level":...,"msg":...,"key":value}`, fields keep their order
+func writeJson(buf *bytes.Buffer, t time.Time, level Level, msg string, fields []Field) {
+	buf.WriteByte('{')
+	writeJsonField(buf, "time", t.Format(time.RFC3339))
+	buf.WriteByte(',')
+	writeJsonField(buf, "level", level.String())
+	buf.WriteByte(',')
+	writeJsonField(buf, "msg", msg)
+	for _, field := range fields {
+		buf.WriteByte(',')
+		writeJsonField(buf, field.Key, field.Value)
+	}
+	buf.WriteString("}\n")
+}
+
+func writeJsonField(buf *bytes.Buffer, key string, value interface{}) {
+	if err, ok := value.(error); ok {
+		value = err.Error()
+	}
+	k, _ := json.Marshal(key)
+	v, err := json.Marshal(value)
+	if err != nil {
+		v, _ = json.Marshal(fmt.Sprint(value))
+	}
+	buf.Write(k)
+	buf.WriteByte(':')
+	buf.Write(v)
+}
@@ -0,0 +1,81 @@
+package logger
+
+import (
+	"bytes"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestParseLevel(t *testing.T) {
+	tests := []struct {
+		name    string
+		want    Level
+		wantErr bool
+	}{
+		{"error", LevelError, false},
+		{"Warn", LevelWarn, false},
+		{"info", LevelInfo, false},
+		{"DEBUG", LevelDebug, false},
+		{"trace", LevelTrace, false},
+		{"verbose", LevelInfo, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ParseLevel(tt.name)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("ParseLevel() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("ParseLevel() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestLogger(t *testing.T) {
+	date := time.Date(2022, 3, 4, 5, 6, 7, 0, time.UTC)
+
+	tests := []struct {
+		name   string
+		level  Level
+		format Format
+		want   string
+	}{
+		{
+			"Text",
+			LevelDebug,
+			Text,
+			"2022/03/04 05:06:07 INFO Backup Done ! system=nes\n" +
+				"2022/03/04 05:06:07 DEBUG Restore game rom=\"Super Mario.nes\" error=\"file locked\"\n",
+		},
+		{
+			"Json",
+			LevelDebug,
+			Json,
+			`{"time":"2022-03-04T05:06:07Z","level":"info","msg":"Backup Done !","system":"nes"}` + "\n" +
+				`{"time":"2022-03-04T05:06:07Z","level":"debug","msg":"Restore game","rom":"Super Mario.nes","error":"file locked"}` + "\n",
+		},
+		{
+			"Info level",
+			LevelInfo,
+			Text,
+			"2022/03/04 05:06:07 INFO Backup Done ! system=nes\n",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var buf bytes.Buffer
+			l := New(&buf, tt.level, tt.format)
+			l.(*writer).now = func() time.Time { return date }
+
+			l.Info("Backup Done !", System("nes"))
+			l.Debug("Restore game", Rom("Super Mario.nes"), Err(errors.New("file locked")))
+			l.Trace("dropped")
+
+			if got := buf.String(); got != tt.want {
+				t.Errorf("Logger wrote\n%s\nwant\n%s", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,20 @@
+package recaltools
+
+import "github.com/jymannob/recaltools/logger"
+
+// loggers used when none is set
+var (
+	infoLogger  = logger.Std(logger.LevelInfo)
+	debugLogger = logger.Std(logger.LevelDebug)
+)
+
+// defaultLogger returns l, or a text logger on stderr at info level, debug level if verbose
+func defaultLogger(l logger.Logger, verbose bool) logger.Logger {
+	if l != nil {
+		return l
+	}
+	if verbose {
+		return debugLogger
+	}
+	return infoLogger
+}
@@ -0,0 +1,319 @@
+package recaltools
+
+import (
+	"context"
+	"errors"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/antchfx/xmlquery"
+	"github.com/jymannob/recaltools/i18n"
+	"github.com/jymannob/recaltools/trash"
+	"github.com/jymannob/recaltools/utils"
+	"github.com/jymannob/recaltools/vfs"
+)
+
+// MediaCleaner finds scraped media files no gamelist references and moves them to a quarantine folder.
+// Only system filters apply.
+type MediaCleaner struct {
+	RomsDir    []string
+	MediaDirs  []string    // media sub folders of the system directory, DefaultMediaDirs if empty
+	Quarantine bool        // move orphaned media to the system quarantine folder
+	Orphans    []MediaFile // orphaned media found
+	Options
+	mu sync.Mutex
+}
+
+// MediaFile is a media file on disk
+type MediaFile struct {
+	Path string `json:"path"`
+	Size int64  `json:"size"`
+}
+
+// MediaFields are the `game` elements referencing a media file
+var MediaFields = []string{"image", "video", "thumbnail", "marquee", "wheel", "manual"}
+
+// DefaultMediaDirs are the folders where the scraper stores media
+var DefaultMediaDirs = []string{"media"}
+
+// name of the quarantine folder, in each system directory
+var quarantineDirName = "media-quarantine"
+
+func (m *MediaCleaner) mediaDirs() []string {
+	if len(m.MediaDirs) == 0 {
+		return DefaultMediaDirs
+	}
+	return m.MediaDirs
+}
+
+// FindOrphans lists media files not referenced by their system gamelist, and quarantines them if asked
+func (m *MediaCleaner) FindOrphans() error {
+	return m.FindOrphansContext(context.Background())
+}
+
+// FindOrphansContext is FindOrphans stopping to start new gamelists once ctx is done
+func (m *MediaCleaner) FindOrphansContext(ctx context.Context) error {
+
+	// roms are not media, the system directory itself is never walked
+	for _, dir := range m.mediaDirs() {
+		if dir = filepath.Clean(dir); dir == "." || filepath.IsAbs(dir) || strings.HasPrefix(dir, "..") {
+			return i18n.NewError(i18n.OrphansMediaDir, nil, dir)
+		}
+	}
+
+	gamelists, err := m.scanner().Scan(m.RomsDir)
+	if err != nil {
+		return err
+	}
+
+	err = forEach(ctx, m.Jobs, gamelists, observed(m.observer(), gamelists, func(gamelist string) (int, error) { return 0, m.orphansSystem(gamelist) }))
+	sort.Slice(m.Orphans, func(i, j int) bool { return m.Orphans[i].Path < m.Orphans[j].Path })
+	if err != nil {
+		return err
+	}
+
+	m.log().Info(i18n.T(i18n.OrphansDone, len(m.Orphans), utils.HumanSize(m.TotalSize())))
+	return nil
+}
+
+// TotalSize returns the size of all orphaned media in bytes
+func (m *MediaCleaner) TotalSize() int64 {
+	var total int64
+	for _, orphan := range m.Orphans {
+		total += orphan.Size
+	}
+	return total
+}
+
+func (m *MediaCleaner) orphansSystem(gamelist string) error {
+
+	systemPath := filepath.Dir(gamelist)
+
+	doc, _, err := vfs.ReadXml(m.fs(), gamelist)
+	if err != nil {
+		return err
+	}
+	referenced := referencedMedia(doc, systemPath)
+	// FAT and exFAT shares match names whatever their case
+	foldCase := isCaseInsensitive(m.fs(), gamelist)
+	if foldCase {
+		for path := range referenced {
+			referenced[strings.ToLower(path)] = true
+		}
+	}
+
+	for _, dir := range m.mediaDirs() {
+		err := fs.WalkDir(m.fs(), filepath.Join(systemPath, dir), func(path string, d fs.DirEntry, err error) error {
+			if err != nil {
+				if errors.Is(err, fs.ErrNotExist) {
+					return nil
+				}
+				return err
+			}
+			if d.IsDir() || referenced[filepath.Clean(path)] || foldCase && referenced[strings.ToLower(filepath.Clean(path))] {
+				return nil
+			}
+
+			info, err := d.Info()
+			if err != nil {
+				return err
+			}
+			m.addOrphan(MediaFile{Path: path, Size: info.Size()})
+
+			if m.Quarantine {
+				return m.quarantine(systemPath, path)
+			}
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// quarantine moves a media file to the system quarantine folder, keeping its path relative to the system.
+// A media already in quarantine under the same path is never overwritten, the new one stays in place.
+func (m *MediaCleaner) quarantine(systemPath, path string) error {
+	rel, err := filepath.Rel(systemPath, path)
+	if err != nil {
+		return err
+	}
+	dest := filepath.Join(systemPath, quarantineDirName, rel)
+	if _, err := m.fs().Stat(dest); err == nil {
+		m.log().Warn(i18n.NewError(i18n.FileExists, nil, dest).Error())
+		return nil
+	}
+
+	m.log().Debug(i18n.T(i18n.OrphansQuarantine, path))
+	return moveNew(m.fs(), path, dest)
+}
+
+// moveNew moves a file to dest, creating its directory, it never replaces an existing file
+func moveNew(fsys vfs.FS, path, dest string) error {
+	if err := fsys.MkdirAll(filepath.Dir(dest)); err != nil {
+		return i18n.NewError(i18n.FileMove, err, path, dest)
+	}
+	if _, err := fsys.Stat(dest); err == nil {
+		return i18n.NewError(i18n.FileExists, nil, dest)
+	}
+	if err := fsys.Rename(path, dest); err != nil {
+		return i18n.NewError(i18n.FileMove, err, path, dest)
+	}
+	return nil
+}
+
+// RestoreQuarantine moves quarantined media back to their system, existing files are not overwritten
+func (m *MediaCleaner) RestoreQuarantine() error {
+	return m.RestoreQuarantineContext(context.Background())
+}
+
+// RestoreQuarantineContext is RestoreQuarantine stopping to move media once ctx is done
+func (m *MediaCleaner) RestoreQuarantineContext(ctx context.Context) error {
+	return m.eachQuarantine(ctx, func(systemPath, quarantinePath string) error {
+		err := fs.WalkDir(m.fs(), quarantinePath, func(path string, d fs.DirEntry, err error) error {
+			if err != nil || d.IsDir() {
+				return err
+			}
+			if err := ctx.Err(); err != nil {
+				return err
+			}
+
+			rel, err := filepath.Rel(quarantinePath, path)
+			if err != nil {
+				return err
+			}
+			dest := filepath.Join(systemPath, rel)
+			if _, err := m.fs().Stat(dest); err == nil {
+				m.log().Warn(i18n.NewError(i18n.FileExists, nil, dest).Error())
+				return nil
+			}
+
+			m.log().Debug(i18n.T(i18n.OrphansRestore, dest))
+			return moveNew(m.fs(), path, dest)
+		})
+		if err != nil {
+			return err
+		}
+
+		return removeEmptyDirs(m.fs(), quarantinePath)
+	})
+}
+
+// EmptyQuarantine moves quarantined media to the trash of their roms directory
+func (m *MediaCleaner) EmptyQuarantine() error {
+	return m.EmptyQuarantineContext(context.Background())
+}
+
+// EmptyQuarantineContext is EmptyQuarantine stopping to start new systems once ctx is done
+func (m *MediaCleaner) EmptyQuarantineContext(ctx context.Context) error {
+	return m.eachQuarantine(ctx, func(systemPath, quarantinePath string) error {
+		m.log().Debug(i18n.T(i18n.OrphansEmpty, quarantinePath))
+		_, err := m.trash(systemPath).Put(quarantinePath)
+		return err
+	})
+}
+
+// trash returns the trash of the roms directory holding the system
+func (m *MediaCleaner) trash(systemPath string) *trash.Trash {
+	for _, romsdir := range m.RomsDir {
+		if rel, err := filepath.Rel(romsdir, systemPath); err == nil && !strings.HasPrefix(rel, "..") {
+			return trash.ForRomsDir(romsdir)
+		}
+	}
+	return trash.ForRomsDir(filepath.Dir(systemPath))
+}
+
+// eachQuarantine calls fn for each system having a quarantine folder until ctx is done
+func (m *MediaCleaner) eachQuarantine(ctx context.Context, fn func(systemPath, quarantinePath string) error) error {
+	gamelists, err := m.scanner().Scan(m.RomsDir)
+	if err != nil {
+		return err
+	}
+
+	for _, gamelist := range gamelists {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		systemPath := filepath.Dir(gamelist)
+		quarantinePath := filepath.Join(systemPath, quarantineDirName)
+		if info, err := m.fs().Stat(quarantinePath); err != nil || !info.IsDir() {
+			continue
+		}
+		if err := fn(systemPath, quarantinePath); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (m *MediaCleaner) addOrphan(orphan MediaFile) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.Orphans = append(m.Orphans, orphan)
+}
+
+// referencedMedia returns the cleaned paths of the media and roms referenced by the gamelist
+func referencedMedia(doc *xmlquery.Node, systemPath string) map[string]bool {
+	referenced := make(map[string]bool)
+
+	for _, node := range xmlquery.Find(doc, "//game|//folder") {
+		for _, field := range append([]string{"path"}, MediaFields...) {
+			if media := childText(node, field); media != "" {
+				referenced[resolvePath(systemPath, media)] = true
+			}
+		}
+	}
+
+	return referenced
+}
+
+// isCaseInsensitive reports whether the filesystem of the file matches names whatever their case,
+// only OS filesystems can
+func isCaseInsensitive(fsys vfs.FS, file string) bool {
+	name := filepath.Base(file)
+	swapped := strings.ToUpper(name)
+	if swapped == name {
+		swapped = strings.ToLower(name)
+	}
+	info, err := fsys.Stat(file)
+	if err != nil {
+		return false
+	}
+	other, err := fsys.Stat(filepath.Join(filepath.Dir(file), swapped))
+	return err == nil && os.SameFile(info, other)
+}
+
+// resolvePath returns the cleaned path of a gamelist path, relative paths are resolved from the system directory
+func resolvePath(systemPath, path string) string {
+	path = expandHome(path)
+	if !filepath.IsAbs(path) {
+		path = filepath.Join(systemPath, path)
+	}
+	return filepath.Clean(path)
+}
+
+// removeEmptyDirs deletes dir and its sub directories if they hold no file
+func removeEmptyDirs(fsys vfs.FS, dir string) error {
+	entries, err := fsys.ReadDir(dir)
+	if err != nil {
+		return err
+	}
+	for _, entry := range entries {
+		if entry.IsDir() {
+			if err := removeEmptyDirs(fsys, filepath.Join(dir, entry.Name())); err != nil {
+				return err
+			}
+		}
+	}
+
+	if entries, err = fsys.ReadDir(dir); err == nil && len(entries) == 0 {
+		return fsys.Remove(dir)
+	}
+	return err
+}
@@ -0,0 +1,120 @@
+package recaltools
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/jymannob/recaltools/i18n"
+	"github.com/jymannob/recaltools/trash"
+)
+
+// Functional testing
+func TestMediaCleaner(t *testing.T) {
+	romsDir := copyTestdata(t, "nes")
+	systemPath := filepath.Join(romsDir, "nes")
+
+	referenced := filepath.Join(systemPath, "media", "images", "2048 (tsone).png")
+	orphans := []string{
+		filepath.Join(systemPath, "media", "images", "orphan.png"),
+		filepath.Join(systemPath, "media", "videos", "old.mp4"),
+	}
+	writeFiles(t, systemPath, map[string]string{
+		"media/images/2048 (tsone).png": "12345",
+		"media/images/orphan.png":       "12345",
+		"media/videos/old.mp4":          "12345",
+	})
+
+	// find orphans
+	m := &MediaCleaner{RomsDir: []string{romsDir}}
+	if err := m.FindOrphans(); err != nil {
+		t.Fatalf("MediaCleaner.FindOrphans() error = %v", err)
+	}
+	if len(m.Orphans) != 2 || m.Orphans[0].Path != orphans[0] || m.Orphans[1].Path != orphans[1] {
+		t.Errorf("MediaCleaner.FindOrphans() = %v, want %v", m.Orphans, orphans)
+	}
+	if m.TotalSize() != 10 {
+		t.Errorf("MediaCleaner.TotalSize() = %v, want 10", m.TotalSize())
+	}
+
+	// quarantine
+	m = &MediaCleaner{RomsDir: []string{romsDir}, Quarantine: true, Options: Options{Verbose: true}}
+	if err := m.FindOrphans(); err != nil {
+		t.Fatalf("MediaCleaner.FindOrphans() error = %v", err)
+	}
+	assertExist(t, "quarantine", referenced, true)
+	for _, orphan := range orphans {
+		assertExist(t, "quarantine", orphan, false)
+		rel, _ := filepath.Rel(systemPath, orphan)
+		assertExist(t, "quarantine", filepath.Join(systemPath, quarantineDirName, rel), true)
+	}
+
+	// restore
+	if err := m.RestoreQuarantine(); err != nil {
+		t.Fatalf("MediaCleaner.RestoreQuarantine() error = %v", err)
+	}
+	for _, orphan := range orphans {
+		assertExist(t, "restore", orphan, true)
+	}
+	assertExist(t, "restore", filepath.Join(systemPath, quarantineDirName), false)
+
+	// empty
+	if err := m.FindOrphans(); err != nil {
+		t.Fatalf("MediaCleaner.FindOrphans() error = %v", err)
+	}
+	if err := m.EmptyQuarantine(); err != nil {
+		t.Fatalf("MediaCleaner.EmptyQuarantine() error = %v", err)
+	}
+	assertExist(t, "empty", filepath.Join(systemPath, quarantineDirName), false)
+	for _, orphan := range orphans {
+		assertExist(t, "empty", orphan, false)
+	}
+	assertExist(t, "empty", referenced, true)
+
+	entries, err := trash.ForRomsDir(romsDir).List()
+	if err != nil || len(entries) != 1 || entries[0].Path != filepath.Join(systemPath, quarantineDirName) {
+		t.Errorf("empty : trash = %+v, %v, want the quarantine folder", entries, err)
+	}
+}
+
+func TestMediaCleaner_quarantineClash(t *testing.T) {
+	romsDir := copyTestdata(t, "nes")
+	systemPath := filepath.Join(romsDir, "nes")
+	orphan := filepath.Join(systemPath, "media", "images", "orphan.png")
+	quarantined := filepath.Join(systemPath, quarantineDirName, "media", "images", "orphan.png")
+	writeFiles(t, systemPath, map[string]string{
+		"media/images/orphan.png":                      "new",
+		quarantineDirName + "/media/images/orphan.png": "old",
+	})
+
+	m := &MediaCleaner{RomsDir: []string{romsDir}, Quarantine: true}
+	if err := m.FindOrphans(); err != nil {
+		t.Fatalf("MediaCleaner.FindOrphans() error = %v", err)
+	}
+	if got, _ := os.ReadFile(quarantined); string(got) != "old" {
+		t.Errorf("MediaCleaner.FindOrphans() quarantined media = %q, want the old one kept", got)
+	}
+	assertExist(t, "quarantine", orphan, true)
+}
+
+func TestMediaCleaner_mediaDirs(t *testing.T) {
+	romsDir := copyTestdata(t, "nes")
+	systemPath := filepath.Join(romsDir, "nes")
+	rom := filepath.Join(systemPath, "Homebrew", "Kubo 3.nes")
+	writeFiles(t, systemPath, map[string]string{"Homebrew/Kubo 3.nes": ""})
+
+	// roms listed by the gamelist are not orphaned media
+	m := &MediaCleaner{RomsDir: []string{romsDir}, MediaDirs: []string{"Homebrew"}}
+	if err := m.FindOrphans(); err != nil || len(m.Orphans) != 0 {
+		t.Errorf("MediaCleaner.FindOrphans() = %v, %v, want no orphan", m.Orphans, err)
+	}
+
+	for _, dir := range []string{".", "media/..", "..", systemPath} {
+		m := &MediaCleaner{RomsDir: []string{romsDir}, MediaDirs: []string{dir}, Quarantine: true}
+		if err := m.FindOrphans(); !errors.Is(err, &i18n.Error{Key: i18n.OrphansMediaDir}) {
+			t.Errorf("MediaCleaner.FindOrphans() media dir %s error = %v, want %s", dir, err, i18n.OrphansMediaDir)
+		}
+	}
+	assertExist(t, "media dir", rom, true)
+}
@@ -0,0 +1,295 @@
+package recaltools
+
+import (
+	"bytes"
+	"context"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/antchfx/xmlquery"
+	"github.com/jymannob/recaltools/i18n"
+	"github.com/jymannob/recaltools/logger"
+	"github.com/jymannob/recaltools/vfs"
+	"github.com/jymannob/recaltools/xml"
+)
+
+// Normalizer canonicalises gamelists : duplicated entries are merged, entries are sorted,
+// booleans and timestamps are normalised and the file is indented. Only system filters apply.
+type Normalizer struct {
+	RomsDir       []string
+	SortBy        string // "name" (default) or "path"
+	Check         bool   // do not write, only list gamelists which are not normalised
+	NormalizeUTF8 bool
+	Unnormalized  []string // gamelists which are not normalised (Check mode)
+	Options
+	mu sync.Mutex
+}
+
+const (
+	SortByName = "name"
+	SortByPath = "path"
+)
+
+// indentation used to write normalised gamelists
+var normalizeIndent = "  "
+
+// user fields always win when duplicated entries are merged
+var userFields = map[string]bool{"favorite": true, "hidden": true, "playcount": true, "lastplayed": true}
+
+var booleanFields = map[string]bool{"favorite": true, "hidden": true, "kidgame": true, "adult": true}
+
+var timestampFields = map[string]bool{"releasedate": true, "lastplayed": true}
+
+// EmulationStation timestamp format
+const timestampLayout = "20060102T150405"
+
+var timestampLayouts = []string{
+	timestampLayout,
+	"20060102T1504",
+	"2006-01-02T15:04:05",
+	"2006-01-02 15:04:05",
+	"2006-01-02",
+	"20060102",
+	"2006",
+}
+
+func (n *Normalizer) Normalize() error {
+	return n.NormalizeContext(context.Background())
+}
+
+// NormalizeContext is Normalize stopping to start new gamelists once ctx is done
+func (n *Normalizer) NormalizeContext(ctx context.Context) error {
+
+	gamelists, err := n.scanner().Scan(n.RomsDir)
+	if err != nil {
+		return err
+	}
+
+	err = forEach(ctx, n.Jobs, gamelists, observed(n.observer(), gamelists, func(gamelist string) (int, error) { return 0, n.normalizeSystem(gamelist) }))
+	sort.Strings(n.Unnormalized)
+	if err != nil {
+		return err
+	}
+
+	if !n.Check {
+		n.log().Info(i18n.T(i18n.NormalizeDone))
+	}
+	return nil
+}
+
+func (n *Normalizer) normalizeSystem(gamelist string) error {
+
+	raw, err := n.fs().ReadFile(gamelist)
+	if err != nil {
+		return i18n.NewError(i18n.FileRead, err, gamelist)
+	}
+
+	doc, enc, err := xml.ParseXml(raw, gamelist)
+	if err != nil {
+		return err
+	}
+
+	merged := NormalizeDocument(doc, n.SortBy)
+	if merged > 0 {
+		n.log().Debug(i18n.T(i18n.NormalizeMerged, gamelist, merged), logger.System(gamelist))
+	}
+
+	if n.NormalizeUTF8 {
+		enc = xml.UTF8
+	}
+
+	out, err := xml.EncodeXml(doc, enc, normalizeIndent)
+	if err != nil {
+		return i18n.NewError(i18n.FileWrite, err, gamelist)
+	}
+
+	if bytes.Equal(raw, out) {
+		return nil
+	}
+
+	if n.Check {
+		n.mu.Lock()
+		n.Unnormalized = append(n.Unnormalized, gamelist)
+		n.mu.Unlock()
+		return nil
+	}
+
+	n.log().Debug(i18n.T(i18n.XmlWrite, gamelist, enc.Charset), logger.System(gamelist))
+	if err := vfs.WriteFile(n.fs(), gamelist, out); err != nil {
+		return err
+	}
+	n.observer().FileWritten(gamelist, gamelist)
+	return nil
+}
+
+// NormalizeDocument merges `game` and `folder` nodes sharing the same path, normalises their booleans
+// and timestamps and sorts them by name or path (folders first). It returns the number of merged nodes.
+func NormalizeDocument(doc *xmlquery.Node, sortBy string) int {
+	root := xmlquery.FindOne(doc, "/gameList")
+	if root == nil {
+		return 0
+	}
+
+	merged := 0
+	var entries []*xmlquery.Node
+	seen := make(map[string]*xmlquery.Node)
+
+	for child := root.FirstChild; child != nil; {
+		next := child.NextSibling
+
+		switch {
+		case child.Type == xmlquery.TextNode:
+			// indentation is rewritten on output
+			xmlquery.RemoveFromTree(child)
+		case child.Type == xmlquery.ElementNode && (child.Data == "game" || child.Data == "folder"):
+			xmlquery.RemoveFromTree(child)
+			key := child.Data + ":" + strings.TrimPrefix(childText(child, "path"), "./")
+			if first, ok := seen[key]; ok {
+				mergeNode(first, child)
+				merged++
+				break
+			}
+			seen[key] = child
+			entries = append(entries, child)
+		}
+
+		child = next
+	}
+
+	for _, entry := range entries {
+		normalizeValues(entry)
+	}
+
+	sort.SliceStable(entries, func(i, j int) bool {
+		a, b := entries[i], entries[j]
+		if a.Data != b.Data {
+			return a.Data == "folder"
+		}
+		if sortBy != SortByPath {
+			na, nb := strings.ToLower(childText(a, "name")), strings.ToLower(childText(b, "name"))
+			if na != nb {
+				return na < nb
+			}
+		}
+		return strings.TrimPrefix(childText(a, "path"), "./") < strings.TrimPrefix(childText(b, "path"), "./")
+	})
+
+	for _, entry := range entries {
+		xmlquery.AddChild(root, entry)
+	}
+
+	return merged
+}
+
+// mergeNode copies into dst the fields of src it lacks. Scraped fields of dst are kept,
+// user fields keep the most significant value (favorite, most played, last played).
+func mergeNode(dst, src *xmlquery.Node) {
+	for _, attr := range src.Attr {
+		if dst.SelectAttr(attr.Name.Local) == "" {
+			xmlquery.AddAttr(dst, attr.Name.Local, attr.Value)
+		}
+	}
+
+	for field := src.FirstChild; field != nil; {
+		next := field.NextSibling
+		if field.Type != xmlquery.ElementNode {
+			field = next
+			continue
+		}
+
+		current := dst.SelectElement(field.Data)
+		value := strings.TrimSpace(field.InnerText())
+		switch {
+		case current == nil:
+			xmlquery.RemoveFromTree(field)
+			xmlquery.AddChild(dst, field)
+		case userFields[field.Data]:
+			if userValueWins(field.Data, value, strings.TrimSpace(current.InnerText())) {
+				xml.SetText(current, value)
+			}
+		case strings.TrimSpace(current.InnerText()) == "" && value != "":
+			xml.SetText(current, value)
+		}
+
+		field = next
+	}
+}
+
+// userValueWins reports whether the user field value of a duplicated entry should replace the current one
+func userValueWins(field, value, current string) bool {
+	switch field {
+	case "playcount":
+		v, _ := strconv.Atoi(value)
+		c, _ := strconv.Atoi(current)
+		return v > c
+	case "lastplayed":
+		return normalizeTimestamp(value) > normalizeTimestamp(current)
+	default:
+		return normalizeBool(value) == "true" && normalizeBool(current) != "true"
+	}
+}
+
+// normalizeValues rewrites booleans as true/false and timestamps in the EmulationStation format
+func normalizeValues(entry *xmlquery.Node) {
+	for field := entry.FirstChild; field != nil; field = field.NextSibling {
+		if field.Type != xmlquery.ElementNode {
+			continue
+		}
+
+		value := strings.TrimSpace(field.InnerText())
+		normalized := value
+		switch {
+		case booleanFields[field.Data]:
+			normalized = normalizeBool(value)
+		case timestampFields[field.Data]:
+			normalized = normalizeTimestamp(value)
+		}
+
+		if normalized != value {
+			xml.SetText(field, normalized)
+		}
+	}
+}
+
+// normalizeBool returns "true" or "false", or the value itself if it is not a boolean
+func normalizeBool(value string) string {
+	switch strings.ToLower(value) {
+	case "yes", "y", "on":
+		return "true"
+	case "no", "n", "off":
+		return "false"
+	}
+	if b, err := strconv.ParseBool(value); err == nil {
+		return strconv.FormatBool(b)
+	}
+	return value
+}
+
+// normalizeTimestamp returns the timestamp in the EmulationStation format, or the value itself if it cannot be parsed
+func normalizeTimestamp(value string) string {
+	if t, ok := parseTimestamp(value); ok {
+		return t.Format(timestampLayout)
+	}
+	return value
+}
+
+// parseTimestamp parses a timestamp in any of timestampLayouts
+func parseTimestamp(value string) (time.Time, bool) {
+	for _, layout := range timestampLayouts {
+		if t, err := time.Parse(layout, value); err == nil {
+			return t, true
+		}
+	}
+	return time.Time{}, false
+}
+
+// childText returns the trimmed text of the first child element named name, "" if none
+func childText(node *xmlquery.Node, name string) string {
+	if child := node.SelectElement(name); child != nil {
+		return strings.TrimSpace(child.InnerText())
+	}
+	return ""
+}
@@ -0,0 +1,143 @@
+package recaltools
+
+import (
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/antchfx/xmlquery"
+	"github.com/jymannob/recaltools/xml"
+)
+
+func TestNormalizeDocument(t *testing.T) {
+	s := `<?xml version="1.0"?><gameList>
+	<game source="Recalbox"><path>./b.zip</path><name>Beta</name><favorite>True</favorite><playcount>2</playcount></game>
+	<game><path>a.zip</path><name>Zeta</name><releasedate>1991-05-02</releasedate></game>
+	<folder><path>Homebrew</path><name>Homebrew</name></folder>
+	<game timestamp="0"><path>b.zip</path><name>Beta duplicate</name><desc>scraped</desc><playcount>5</playcount><lastplayed>20220529T183748</lastplayed><favorite>false</favorite></game>
+	<folder><path>Homebrew</path><name>Homebrew</name></folder>
+	</gameList>`
+
+	tests := []struct {
+		name       string
+		sortBy     string
+		wantMerged int
+		want       string
+	}{
+		{
+			"Sort by name",
+			SortByName,
+			2,
+			`<?xml version="1.0"?><gameList>` +
+				`<folder><path>Homebrew</path><name>Homebrew</name></folder>` +
+				`<game source="Recalbox" timestamp="0"><path>./b.zip</path><name>Beta</name><favorite>true</favorite><playcount>5</playcount><desc>scraped</desc><lastplayed>20220529T183748</lastplayed></game>` +
+				`<game><path>a.zip</path><name>Zeta</name><releasedate>19910502T000000</releasedate></game>` +
+				`</gameList>`,
+		},
+		{
+			"Sort by path",
+			SortByPath,
+			2,
+			`<?xml version="1.0"?><gameList>` +
+				`<folder><path>Homebrew</path><name>Homebrew</name></folder>` +
+				`<game><path>a.zip</path><name>Zeta</name><releasedate>19910502T000000</releasedate></game>` +
+				`<game source="Recalbox" timestamp="0"><path>./b.zip</path><name>Beta</name><favorite>true</favorite><playcount>5</playcount><desc>scraped</desc><lastplayed>20220529T183748</lastplayed></game>` +
+				`</gameList>`,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			doc, err := xmlquery.Parse(strings.NewReader(s))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := NormalizeDocument(doc, tt.sortBy); got != tt.wantMerged {
+				t.Errorf("NormalizeDocument() = %v, want %v", got, tt.wantMerged)
+			}
+			if got := doc.OutputXML(true); got != tt.want {
+				t.Errorf("NormalizeDocument() doc = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func Test_normalizeBool(t *testing.T) {
+	tests := []struct {
+		value string
+		want  string
+	}{
+		{"true", "true"},
+		{"True", "true"},
+		{"1", "true"},
+		{"yes", "true"},
+		{"FALSE", "false"},
+		{"0", "false"},
+		{"no", "false"},
+		{"maybe", "maybe"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.value, func(t *testing.T) {
+			if got := normalizeBool(tt.value); got != tt.want {
+				t.Errorf("normalizeBool() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func Test_normalizeTimestamp(t *testing.T) {
+	tests := []struct {
+		value string
+		want  string
+	}{
+		{"20140621T020000", "20140621T020000"},
+		{"2014-06-21T02:00:00", "20140621T020000"},
+		{"2014-06-21 02:00:00", "20140621T020000"},
+		{"2014-06-21", "20140621T000000"},
+		{"20140621", "20140621T000000"},
+		{"1994", "19940101T000000"},
+		{"0", "0"},
+		{"", ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.value, func(t *testing.T) {
+			if got := normalizeTimestamp(tt.value); got != tt.want {
+				t.Errorf("normalizeTimestamp() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+// Functional testing
+func TestNormalizer_Normalize(t *testing.T) {
+	romsDir := copyTestdata(t, "nes")
+	gamelist := filepath.Join(romsDir, "nes", "gamelist.xml")
+
+	check := &Normalizer{RomsDir: []string{romsDir}, Check: true}
+	if err := check.Normalize(); err != nil {
+		t.Fatalf("Normalizer.Normalize() check error = %v", err)
+	}
+	if len(check.Unnormalized) != 1 || check.Unnormalized[0] != gamelist {
+		t.Errorf("Normalizer.Normalize() check = %v, want %v", check.Unnormalized, []string{gamelist})
+	}
+
+	normalizer := &Normalizer{RomsDir: []string{romsDir}, Options: Options{Verbose: true}}
+	if err := normalizer.Normalize(); err != nil {
+		t.Fatalf("Normalizer.Normalize() error = %v", err)
+	}
+
+	check = &Normalizer{RomsDir: []string{romsDir}, Check: true}
+	if err := check.Normalize(); err != nil {
+		t.Fatalf("Normalizer.Normalize() check error = %v", err)
+	}
+	if len(check.Unnormalized) != 0 {
+		t.Errorf("Normalizer.Normalize() check after normalize = %v, want none", check.Unnormalized)
+	}
+
+	doc, err := xml.OpenXml(gamelist)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n := len(xmlquery.Find(doc, "//folder[path='Homebrew']")); n != 1 {
+		t.Errorf("Normalizer.Normalize() Homebrew folders = %d, want 1", n)
+	}
+}
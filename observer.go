@@ -0,0 +1,106 @@
+package recaltools
+
+// Observer is notified of the progress of a run.
+// Gamelists are processed in parallel, so its methods must be safe for concurrent use.
+type Observer interface {
+	SystemDiscovered(gamelist string)          // gamelist found, before any system is started
+	SystemStarted(gamelist string)             // gamelist being processed
+	SystemFinished(gamelist string, games int) // gamelist processed, games is the count of GameUpdated
+	GameUpdated(gamelist, romPath string)      // game backed up, restored, cleaned, hidden... once written
+	GameUnmatched(gamelist, romPath string)    // backed up game missing from the gamelist
+	FileWritten(gamelist, path string)         // gamelist, backup or playlist written
+	Error(gamelist string, err error)          // the gamelist failed, SystemFinished is not called
+}
+
+// NopObserver ignores every event, embed it to implement only some of them
+type NopObserver struct{}
+
+func (NopObserver) SystemDiscovered(gamelist string)          {}
+func (NopObserver) SystemStarted(gamelist string)             {}
+func (NopObserver) SystemFinished(gamelist string, games int) {}
+func (NopObserver) GameUpdated(gamelist, romPath string)      {}
+func (NopObserver) GameUnmatched(gamelist, romPath string)    {}
+func (NopObserver) FileWritten(gamelist, path string)         {}
+func (NopObserver) Error(gamelist string, err error)          {}
+
+// Observers returns an Observer forwarding every event to each of observers, nil ones are skipped
+func Observers(observers ...Observer) Observer {
+	var all multiObserver
+	for _, obs := range observers {
+		if obs != nil {
+			all = append(all, obs)
+		}
+	}
+	return all
+}
+
+type multiObserver []Observer
+
+func (m multiObserver) SystemDiscovered(gamelist string) {
+	for _, obs := range m {
+		obs.SystemDiscovered(gamelist)
+	}
+}
+
+func (m multiObserver) SystemStarted(gamelist string) {
+	for _, obs := range m {
+		obs.SystemStarted(gamelist)
+	}
+}
+
+func (m multiObserver) SystemFinished(gamelist string, games int) {
+	for _, obs := range m {
+		obs.SystemFinished(gamelist, games)
+	}
+}
+
+func (m multiObserver) GameUpdated(gamelist, romPath string) {
+	for _, obs := range m {
+		obs.GameUpdated(gamelist, romPath)
+	}
+}
+
+func (m multiObserver) GameUnmatched(gamelist, romPath string) {
+	for _, obs := range m {
+		obs.GameUnmatched(gamelist, romPath)
+	}
+}
+
+func (m multiObserver) FileWritten(gamelist, path string) {
+	for _, obs := range m {
+		obs.FileWritten(gamelist, path)
+	}
+}
+
+func (m multiObserver) Error(gamelist string, err error) {
+	for _, obs := range m {
+		obs.Error(gamelist, err)
+	}
+}
+
+// defaultObserver returns obs, or a NopObserver if none is set
+func defaultObserver(obs Observer) Observer {
+	if obs == nil {
+		return NopObserver{}
+	}
+	return obs
+}
+
+// observed notifies obs of the discovery of every gamelist, then wraps fn to notify the start of
+// each gamelist and its end with the count of games fn updated, or its failure
+func observed(obs Observer, gamelists []string, fn func(gamelist string) (int, error)) func(gamelist string) error {
+	for _, gamelist := range gamelists {
+		obs.SystemDiscovered(gamelist)
+	}
+
+	return func(gamelist string) error {
+		obs.SystemStarted(gamelist)
+		games, err := fn(gamelist)
+		if err != nil {
+			obs.Error(gamelist, err)
+			return err
+		}
+		obs.SystemFinished(gamelist, games)
+		return nil
+	}
+}
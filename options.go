@@ -0,0 +1,40 @@
+package recaltools
+
+import (
+	"github.com/jymannob/recaltools/logger"
+	"github.com/jymannob/recaltools/vfs"
+)
+
+// Options are the settings shared by every command, embedded in FavBackup, Cleaner, Pruner...
+type Options struct {
+	Verbose        bool
+	Logger         logger.Logger // text logs on stderr if nil, at debug level if Verbose
+	FollowSymlinks bool          // walk symlinked directories, a directory is still processed once
+	Jobs           int           // gamelists processed at once, DefaultJobs if 0
+	Observer       Observer      // notified of the progress, may be nil
+	Filter         Filter        // systems and games processed, all if zero, see each command for game filters
+	FS             vfs.FS        // filesystem of the roms directories, vfs.OS if nil
+}
+
+func (o *Options) log() logger.Logger {
+	return defaultLogger(o.Logger, o.Verbose)
+}
+
+func (o *Options) observer() Observer {
+	return defaultObserver(o.Observer)
+}
+
+func (o *Options) fs() vfs.FS {
+	return vfs.Default(o.FS)
+}
+
+// scanner returns the Scanner of the gamelists selected by the options
+func (o *Options) scanner() Scanner {
+	return Scanner{FollowSymlinks: o.FollowSymlinks, Logger: o.log(), FS: o.FS, Filter: o.Filter}
+}
+
+// backupOptions returns the options of the backup made before a command changes gamelists,
+// it backs up every game and is not observed
+func (o *Options) backupOptions() Options {
+	return Options{Verbose: o.Verbose, Logger: o.Logger, FollowSymlinks: o.FollowSymlinks, Jobs: o.Jobs, FS: o.FS}
+}
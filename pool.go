@@ -0,0 +1,67 @@
+package recaltools
+
+import (
+	"context"
+	"runtime"
+	"sort"
+	"sync"
+)
+
+// DefaultJobs is the number of gamelists processed at once when Jobs is not set
+var DefaultJobs = runtime.NumCPU()
+
+// forEach calls fn for each item with at most jobs calls running at once (DefaultJobs if jobs < 1).
+// Once ctx is done no new call is started and running calls are waited for.
+// It returns a *RunError listing the failed items and the ctx error, nil if every item succeeded.
+func forEach(ctx context.Context, jobs int, items []string, fn func(item string) error) error {
+	if jobs < 1 {
+		jobs = DefaultJobs
+	}
+	if jobs > len(items) {
+		jobs = len(items)
+	}
+
+	runErr := &RunError{}
+	var mu sync.Mutex
+
+	queue := make(chan string)
+	var wg sync.WaitGroup
+	for i := 0; i < jobs; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for item := range queue {
+				err := fn(item)
+
+				mu.Lock()
+				runErr.Total++
+				if err != nil {
+					runErr.Failures = append(runErr.Failures, &SystemError{Path: item, Err: err})
+				}
+				mu.Unlock()
+			}
+		}()
+	}
+
+feed:
+	for _, item := range items {
+		if runErr.Err = ctx.Err(); runErr.Err != nil {
+			break
+		}
+		select {
+		case <-ctx.Done():
+			runErr.Err = ctx.Err()
+			break feed
+		case queue <- item:
+		}
+	}
+
+	close(queue)
+	wg.Wait()
+
+	if runErr.Err == nil && len(runErr.Failures) == 0 {
+		return nil
+	}
+	sort.Slice(runErr.Failures, func(i, j int) bool { return runErr.Failures[i].Path < runErr.Failures[j].Path })
+	return runErr
+}
@@ -0,0 +1,109 @@
+package recaltools
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func Test_forEach(t *testing.T) {
+	items := make([]string, 20)
+	for i := range items {
+		items[i] = fmt.Sprint(i)
+	}
+
+	var running, max int32
+	var mu sync.Mutex
+	done := make(map[string]bool)
+
+	err := forEach(context.Background(), 3, items, func(item string) error {
+		n := atomic.AddInt32(&running, 1)
+		for {
+			m := atomic.LoadInt32(&max)
+			if n <= m || atomic.CompareAndSwapInt32(&max, m, n) {
+				break
+			}
+		}
+		time.Sleep(time.Millisecond)
+		atomic.AddInt32(&running, -1)
+
+		mu.Lock()
+		done[item] = true
+		mu.Unlock()
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("forEach() error = %v", err)
+	}
+	if len(done) != len(items) {
+		t.Errorf("forEach() processed %d items, want %d", len(done), len(items))
+	}
+	if max > 3 {
+		t.Errorf("forEach() ran %d jobs at once, want at most 3", max)
+	}
+}
+
+func Test_forEach_cancel(t *testing.T) {
+	items := make([]string, 20)
+	ctx, cancel := context.WithCancel(context.Background())
+
+	var started, finished int32
+	err := forEach(ctx, 2, items, func(item string) error {
+		if atomic.AddInt32(&started, 1) == 3 {
+			cancel()
+		}
+		time.Sleep(time.Millisecond)
+		atomic.AddInt32(&finished, 1)
+		return nil
+	})
+	if !errors.Is(err, context.Canceled) {
+		t.Errorf("forEach() error = %v, want %v", err, context.Canceled)
+	}
+	if started >= int32(len(items)) {
+		t.Errorf("forEach() started %d items after cancel", started)
+	}
+	if finished != started {
+		t.Errorf("forEach() finished %d of %d started items", finished, started)
+	}
+}
+
+func Test_forEach_failures(t *testing.T) {
+	items := []string{"c", "a", "b", "d"}
+	failure := errors.New("failure")
+
+	err := forEach(context.Background(), 2, items, func(item string) error {
+		if item == "a" || item == "c" {
+			return failure
+		}
+		return nil
+	})
+
+	var runErr *RunError
+	if !errors.As(err, &runErr) {
+		t.Fatalf("forEach() error = %v, want *RunError", err)
+	}
+	if runErr.Total != len(items) {
+		t.Errorf("forEach() Total = %d, want %d", runErr.Total, len(items))
+	}
+	if len(runErr.Failures) != 2 || runErr.Failures[0].Path != "a" || runErr.Failures[1].Path != "c" {
+		t.Errorf("forEach() Failures = %v, want [a c]", runErr.Failures)
+	}
+	if !errors.Is(runErr.Failures[0], failure) {
+		t.Errorf("forEach() Failures[0] = %v, want %v", runErr.Failures[0], failure)
+	}
+	if !runErr.Partial() {
+		t.Errorf("forEach() Partial() = false, want true")
+	}
+	if errors.Is(err, context.Canceled) {
+		t.Errorf("forEach() error = %v, not interrupted", err)
+	}
+
+	err = forEach(context.Background(), 2, items, func(item string) error { return failure })
+	if !errors.As(err, &runErr) || runErr.Partial() {
+		t.Errorf("forEach() error = %v, want a total failure", err)
+	}
+}
@@ -0,0 +1,160 @@
+package recaltools
+
+import (
+	"context"
+	"path/filepath"
+	"sort"
+	"sync"
+
+	"github.com/antchfx/xmlquery"
+	"github.com/jymannob/recaltools/i18n"
+	"github.com/jymannob/recaltools/logger"
+	"github.com/jymannob/recaltools/vfs"
+	"github.com/jymannob/recaltools/xml"
+)
+
+// Pruner removes gamelist and backup entries whose ROM no longer exists
+type Pruner struct {
+	RomsDir       []string
+	KeepUserData  bool // only prune entries without user data (favorite, playcount, lastplayed)
+	DryRun        bool // do not write, only list entries to prune
+	FormatJson    bool
+	NormalizeUTF8 bool
+	Pruned        []string // pruned rom paths
+	Options
+	mu sync.Mutex
+}
+
+func (p *Pruner) Prune() error {
+	return p.PruneContext(context.Background())
+}
+
+// PruneContext is Prune stopping to start new gamelists once ctx is done
+func (p *Pruner) PruneContext(ctx context.Context) error {
+
+	gamelists, err := p.scanner().Scan(p.RomsDir)
+	if err != nil {
+		return err
+	}
+
+	err = forEach(ctx, p.Jobs, gamelists, observed(p.observer(), gamelists, p.pruneSystem))
+	sort.Strings(p.Pruned)
+	if err != nil {
+		return err
+	}
+
+	p.log().Info(i18n.T(i18n.PruneDone))
+	return nil
+}
+
+func (p *Pruner) pruneSystem(gamelist string) (int, error) {
+
+	systemPath := filepath.Dir(gamelist)
+
+	doc, enc, err := vfs.ReadXml(p.fs(), gamelist)
+	if err != nil {
+		return 0, err
+	}
+
+	var pruned []*xmlquery.Node
+	for _, node := range xmlquery.Find(doc, "//game|//folder") {
+		romPath := childText(node, "path")
+		if romPath == "" || romExists(p.fs(), systemPath, romPath) || !p.Filter.MatchNode(node) {
+			continue
+		}
+		if p.KeepUserData && hasUserData(node) {
+			continue
+		}
+
+		pruned = append(pruned, node)
+		p.addPruned(systemPath, romPath)
+	}
+
+	if len(pruned) > 0 {
+		p.log().Debug(i18n.T(i18n.PruneGamelist, gamelist, len(pruned)), logger.System(gamelist))
+	}
+	if len(pruned) == 0 || p.DryRun {
+		return 0, p.pruneBackup(gamelist)
+	}
+
+	for _, node := range pruned {
+		xml.RemoveNode(node)
+	}
+	if p.NormalizeUTF8 {
+		enc = xml.UTF8
+	}
+	if err := vfs.WriteXml(p.fs(), gamelist, doc, enc); err != nil {
+		return 0, err
+	}
+	p.observer().FileWritten(gamelist, gamelist)
+	// games are pruned once written
+	for _, node := range pruned {
+		p.observer().GameUpdated(gamelist, childText(node, "path"))
+	}
+
+	return len(pruned), p.pruneBackup(gamelist)
+}
+
+// pruneBackup removes the backup entries whose ROM no longer exists, except those holding user data with KeepUserData
+func (p *Pruner) pruneBackup(gamelist string) error {
+	systemPath := filepath.Dir(gamelist)
+	backupFile := filepath.Join(systemPath, fileBackupName)
+	if _, err := p.fs().Stat(backupFile); err != nil {
+		return nil
+	}
+
+	var backup SystemBackup
+	if err := vfs.ReadJson(p.fs(), backupFile, &backup); err != nil {
+		return err
+	}
+
+	pruned := 0
+	for key, game := range backup.Games {
+		if romExists(p.fs(), systemPath, game.RomPath) || !p.Filter.MatchGame(game) {
+			continue
+		}
+		if p.KeepUserData && game.hasUserData() {
+			continue
+		}
+		delete(backup.Games, key)
+		pruned++
+	}
+
+	if pruned == 0 {
+		return nil
+	}
+
+	p.log().Debug(i18n.T(i18n.PruneBackup, backupFile, pruned), logger.System(gamelist))
+	if p.DryRun {
+		return nil
+	}
+	if err := vfs.WriteJson(p.fs(), backupFile, backup, p.FormatJson); err != nil {
+		return err
+	}
+	p.observer().FileWritten(gamelist, backupFile)
+	return nil
+}
+
+func (p *Pruner) addPruned(systemPath, romPath string) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.Pruned = append(p.Pruned, filepath.Join(systemPath, romPath))
+}
+
+// romExists reports whether the rom `path` of a gamelist exists, relative paths are resolved from the system directory
+func romExists(fsys vfs.FS, systemPath, romPath string) bool {
+	_, err := fsys.Stat(resolvePath(systemPath, romPath))
+	return err == nil
+}
+
+// hasUserData reports whether the backed up game holds user data, hidden only is not
+func (g *Game) hasUserData() bool {
+	return g.Favorite || g.Playcount != "" || g.Lastplayed != ""
+}
+
+// hasUserData reports whether the `game` node holds user data saved by the backup
+func hasUserData(node *xmlquery.Node) bool {
+	return normalizeBool(childText(node, "favorite")) == "true" ||
+		node.SelectElement("playcount") != nil ||
+		node.SelectElement("lastplayed") != nil
+}
@@ -0,0 +1,92 @@
+package recaltools
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/antchfx/xmlquery"
+	"github.com/jymannob/recaltools/utils"
+	"github.com/jymannob/recaltools/xml"
+)
+
+// Functional testing
+func TestPruner_Prune(t *testing.T) {
+	tests := []struct {
+		name         string
+		keepUserData bool
+		dryRun       bool
+		wantGames    int // `game` and `folder` nodes left (3 `Homebrew` folders and 2 existing roms)
+		wantBackup   int // backup entries left, the 4 of testdata and one without user data
+	}{
+		{"Dry run", false, true, -1, -1},
+		{"Keep user data", true, false, 8, 4},
+		{"Prune all", false, false, 5, 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			romsDir := copyTestdata(t, "nes")
+			systemPath := filepath.Join(romsDir, "nes")
+			gamelist := filepath.Join(systemPath, "gamelist.xml")
+			backupFile := filepath.Join(systemPath, fileBackupName)
+
+			// only 2 roms exist
+			os.MkdirAll(filepath.Join(systemPath, "Homebrew"), 0775)
+			for _, rom := range []string{"Homebrew/Kubo 3.nes", "2048 (tsone).nes"} {
+				if err := os.WriteFile(filepath.Join(systemPath, rom), nil, 0664); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			// a backed up game whose rom is gone, without user data
+			var backup SystemBackup
+			if err := utils.ReadJsonFile(backupFile, &backup); err != nil {
+				t.Fatal(err)
+			}
+			backup.Games["Homebrew/Gone.nes"] = &Game{RomPath: "Homebrew/Gone.nes", Hidden: true}
+			if err := utils.WriteJsonFile(backupFile, backup, true); err != nil {
+				t.Fatal(err)
+			}
+
+			before, _ := os.ReadFile(gamelist)
+			beforeBackup, _ := os.ReadFile(backupFile)
+
+			p := &Pruner{RomsDir: []string{romsDir}, KeepUserData: tt.keepUserData, DryRun: tt.dryRun, Options: Options{Verbose: true}}
+			if err := p.Prune(); err != nil {
+				t.Fatalf("Pruner.Prune() error = %v", err)
+			}
+			if len(p.Pruned) == 0 {
+				t.Errorf("Pruner.Prune() pruned nothing")
+			}
+
+			after, _ := os.ReadFile(gamelist)
+			if tt.wantGames < 0 {
+				if string(after) != string(before) {
+					t.Errorf("Pruner.Prune() gamelist modified")
+				}
+			} else {
+				doc, err := xml.OpenXml(gamelist)
+				if err != nil {
+					t.Fatal(err)
+				}
+				if got := len(xmlquery.Find(doc, "//game|//folder")); got != tt.wantGames {
+					t.Errorf("Pruner.Prune() entries left = %d, want %d", got, tt.wantGames)
+				}
+			}
+
+			if tt.wantBackup < 0 {
+				if got, _ := os.ReadFile(backupFile); string(got) != string(beforeBackup) {
+					t.Errorf("Pruner.Prune() backup modified")
+				}
+			} else {
+				var backup SystemBackup
+				if err := utils.ReadJsonFile(backupFile, &backup); err != nil {
+					t.Fatal(err)
+				}
+				if len(backup.Games) != tt.wantBackup {
+					t.Errorf("Pruner.Prune() backup entries left = %d, want %d", len(backup.Games), tt.wantBackup)
+				}
+			}
+		})
+	}
+}
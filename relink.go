@@ -0,0 +1,238 @@
+package recaltools
+
+import (
+	"context"
+	"errors"
+	"io/fs"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/antchfx/xmlquery"
+	"github.com/jymannob/recaltools/i18n"
+	"github.com/jymannob/recaltools/logger"
+	"github.com/jymannob/recaltools/vfs"
+	"github.com/jymannob/recaltools/xml"
+)
+
+// MediaLinker reports media referenced by gamelists which do not exist,
+// and relinks them to a media file named after the rom
+type MediaLinker struct {
+	RomsDir       []string
+	MediaDirs     []string // media folders relative to the system directory, DefaultMediaDirs if empty
+	Relink        bool     // rewrite missing media paths to a matching file found in the media folders
+	NormalizeUTF8 bool
+	Missing       []MissingMedia // referenced media not found
+	Options
+	mu sync.Mutex
+}
+
+// MissingMedia is a media referenced by a gamelist which does not exist
+type MissingMedia struct {
+	Gamelist string `json:"gamelist"`
+	RomPath  string `json:"rom"`
+	Field    string `json:"field"`
+	Path     string `json:"path"`
+	Relinked string `json:"relinked,omitempty"` // new path when a matching file has been found
+}
+
+// mediaExtensions are the file extensions accepted to relink each media field
+var mediaExtensions = map[string][]string{
+	"image":     {".png", ".jpg", ".jpeg", ".gif", ".webp"},
+	"thumbnail": {".png", ".jpg", ".jpeg", ".gif", ".webp"},
+	"marquee":   {".png", ".jpg", ".jpeg", ".gif", ".webp"},
+	"wheel":     {".png", ".jpg", ".jpeg", ".gif", ".webp"},
+	"video":     {".mp4", ".mkv", ".avi", ".webm"},
+	"manual":    {".pdf"},
+}
+
+func (l *MediaLinker) mediaDirs() []string {
+	if len(l.MediaDirs) == 0 {
+		return DefaultMediaDirs
+	}
+	return l.MediaDirs
+}
+
+// FindMissing lists referenced media which do not exist, and relinks them if asked
+func (l *MediaLinker) FindMissing() error {
+	return l.FindMissingContext(context.Background())
+}
+
+// FindMissingContext is FindMissing stopping to start new gamelists once ctx is done
+func (l *MediaLinker) FindMissingContext(ctx context.Context) error {
+
+	gamelists, err := l.scanner().Scan(l.RomsDir)
+	if err != nil {
+		return err
+	}
+
+	err = forEach(ctx, l.Jobs, gamelists, observed(l.observer(), gamelists, l.missingSystem))
+	sort.Slice(l.Missing, func(i, j int) bool {
+		if l.Missing[i].Gamelist != l.Missing[j].Gamelist {
+			return l.Missing[i].Gamelist < l.Missing[j].Gamelist
+		}
+		return l.Missing[i].Path < l.Missing[j].Path
+	})
+	if err != nil {
+		return err
+	}
+
+	l.log().Info(i18n.T(i18n.MissingDone, len(l.Missing)))
+	return nil
+}
+
+func (l *MediaLinker) missingSystem(gamelist string) (int, error) {
+
+	systemPath := filepath.Dir(gamelist)
+
+	doc, enc, err := vfs.ReadXml(l.fs(), gamelist)
+	if err != nil {
+		return 0, err
+	}
+
+	var files map[string][]string
+	var relinked []string // rom path of each relinked media
+
+	for _, node := range xmlquery.Find(doc, "//game") {
+		if !l.Filter.MatchNode(node) {
+			continue
+		}
+		for _, field := range MediaFields {
+			element := node.SelectElement(field)
+			if element == nil {
+				continue
+			}
+			media := strings.TrimSpace(element.InnerText())
+			if media == "" {
+				continue
+			}
+			if _, err := l.fs().Stat(resolvePath(systemPath, media)); err == nil {
+				continue
+			}
+
+			missing := MissingMedia{Gamelist: gamelist, RomPath: childText(node, "path"), Field: field, Path: media}
+
+			if l.Relink {
+				if files == nil {
+					files = l.mediaFiles(systemPath)
+				}
+				if found := matchMedia(files, missing, systemPath); found != "" {
+					missing.Relinked = relativeMediaPath(systemPath, found, media)
+					xml.SetText(element, missing.Relinked)
+					relinked = append(relinked, missing.RomPath)
+					l.log().Debug(i18n.T(i18n.MissingRelink, media, missing.Relinked), logger.System(gamelist), logger.Rom(missing.RomPath))
+				}
+			}
+
+			l.addMissing(missing)
+		}
+	}
+
+	if len(relinked) == 0 {
+		return 0, nil
+	}
+
+	if l.NormalizeUTF8 {
+		enc = xml.UTF8
+	}
+	if err := vfs.WriteXml(l.fs(), gamelist, doc, enc); err != nil {
+		return 0, err
+	}
+	// games are relinked once written
+	for _, romPath := range relinked {
+		l.observer().GameUpdated(gamelist, romPath)
+	}
+	l.observer().FileWritten(gamelist, gamelist)
+	return len(relinked), nil
+}
+
+// mediaFiles indexes the files of the system media folders by lower case name without extension
+func (l *MediaLinker) mediaFiles(systemPath string) map[string][]string {
+	files := make(map[string][]string)
+
+	for _, dir := range l.mediaDirs() {
+		err := fs.WalkDir(l.fs(), filepath.Join(systemPath, dir), func(path string, d fs.DirEntry, err error) error {
+			if err != nil {
+				if errors.Is(err, fs.ErrNotExist) {
+					return nil
+				}
+				return err
+			}
+			if !d.IsDir() {
+				key := strings.ToLower(strings.TrimSuffix(d.Name(), filepath.Ext(d.Name())))
+				files[key] = append(files[key], path)
+			}
+			return nil
+		})
+		if err != nil {
+			l.log().Warn(err.Error(), logger.System(systemPath))
+		}
+	}
+
+	return files
+}
+
+// matchMedia returns the media file named after the rom with an extension accepted for the field, `<rom>-image.png`
+// in any media folder or `<rom>.png` in the folder of the missing media only, since image, thumbnail and marquee
+// files share their extensions. It prefers the folder of the missing media and returns "" if none.
+func matchMedia(files map[string][]string, missing MissingMedia, systemPath string) string {
+	rom := filepath.Base(missing.RomPath)
+	rom = strings.ToLower(strings.TrimSuffix(rom, filepath.Ext(rom)))
+	missingDir := filepath.Dir(resolvePath(systemPath, missing.Path))
+
+	var candidates []string
+	for _, file := range files[rom+"-"+missing.Field] {
+		if hasExtension(file, mediaExtensions[missing.Field]) {
+			candidates = append(candidates, file)
+		}
+	}
+	for _, file := range files[rom] {
+		if filepath.Dir(file) == missingDir && hasExtension(file, mediaExtensions[missing.Field]) {
+			candidates = append(candidates, file)
+		}
+	}
+	if len(candidates) == 0 {
+		return ""
+	}
+
+	sort.Strings(candidates)
+	for _, candidate := range candidates {
+		if filepath.Dir(candidate) == missingDir {
+			return candidate
+		}
+	}
+	return candidates[0]
+}
+
+func hasExtension(file string, extensions []string) bool {
+	ext := strings.ToLower(filepath.Ext(file))
+	for _, e := range extensions {
+		if ext == e {
+			return true
+		}
+	}
+	return false
+}
+
+// relativeMediaPath returns the path of file relative to the system directory, written like the previous path
+func relativeMediaPath(systemPath, file, previous string) string {
+	if filepath.IsAbs(previous) {
+		return file
+	}
+	rel, err := filepath.Rel(systemPath, file)
+	if err != nil {
+		return file
+	}
+	rel = filepath.ToSlash(rel)
+	if strings.HasPrefix(previous, "./") {
+		rel = "./" + rel
+	}
+	return rel
+}
+
+func (l *MediaLinker) addMissing(missing MissingMedia) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.Missing = append(l.Missing, missing)
+}
@@ -0,0 +1,79 @@
+package recaltools
+
+import (
+	"path/filepath"
+	"testing"
+
+	"github.com/jymannob/recaltools/xml"
+)
+
+// Functional testing
+func TestMediaLinker_FindMissing(t *testing.T) {
+	romsDir := copyTestdata(t, "nes")
+	systemPath := filepath.Join(romsDir, "nes")
+
+	// scraper wrote a jpg instead of the referenced png
+	writeFiles(t, systemPath, map[string]string{"media/images/2048 (tsone).jpg": ""})
+
+	report := &MediaLinker{RomsDir: []string{romsDir}}
+	if err := report.FindMissing(); err != nil {
+		t.Fatalf("MediaLinker.FindMissing() error = %v", err)
+	}
+	if len(report.Missing) == 0 {
+		t.Fatalf("MediaLinker.FindMissing() found no missing media")
+	}
+
+	linker := &MediaLinker{RomsDir: []string{romsDir}, Relink: true, Options: Options{Verbose: true}}
+	if err := linker.FindMissing(); err != nil {
+		t.Fatalf("MediaLinker.FindMissing() error = %v", err)
+	}
+	if len(linker.Missing) != len(report.Missing) {
+		t.Errorf("MediaLinker.FindMissing() relink missing = %d, want %d", len(linker.Missing), len(report.Missing))
+	}
+
+	doc, err := xml.OpenXml(filepath.Join(systemPath, "gamelist.xml"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	game := xml.NewIndex(doc).ByPath("2048 (tsone).nes")
+	if got, want := childText(game, "image"), "media/images/2048 (tsone).jpg"; got != want {
+		t.Errorf("MediaLinker.FindMissing() relinked image = %v, want %v", got, want)
+	}
+
+	// nothing to relink anymore for 2048
+	again := &MediaLinker{RomsDir: []string{romsDir}}
+	if err := again.FindMissing(); err != nil {
+		t.Fatalf("MediaLinker.FindMissing() error = %v", err)
+	}
+	if len(again.Missing) != len(report.Missing)-1 {
+		t.Errorf("MediaLinker.FindMissing() after relink = %d, want %d", len(again.Missing), len(report.Missing)-1)
+	}
+}
+
+func Test_matchMedia(t *testing.T) {
+	systemPath := "/roms/nes"
+	files := map[string][]string{
+		"kubo 3":       {"/roms/nes/media/videos/Kubo 3.mp4", "/roms/nes/media/images/Kubo 3.png", "/roms/nes/media/box/Kubo 3.png"},
+		"kubo 3-image": {"/roms/nes/media/Kubo 3-image.jpg"},
+	}
+
+	tests := []struct {
+		name    string
+		missing MissingMedia
+		want    string
+	}{
+		{"Same folder first", MissingMedia{RomPath: "Homebrew/Kubo 3.nes", Field: "image", Path: "media/images/Kubo 3.jpg"}, "/roms/nes/media/images/Kubo 3.png"},
+		{"Other folder", MissingMedia{RomPath: "Homebrew/Kubo 3.nes", Field: "image", Path: "media/screens/Kubo 3.jpg"}, "/roms/nes/media/Kubo 3-image.jpg"},
+		{"Extension of the field", MissingMedia{RomPath: "Homebrew/Kubo 3.nes", Field: "video", Path: "media/videos/Kubo 3.avi"}, "/roms/nes/media/videos/Kubo 3.mp4"},
+		{"Rom name in another folder", MissingMedia{RomPath: "Homebrew/Kubo 3.nes", Field: "thumbnail", Path: "media/thumbnails/Kubo 3.png"}, ""},
+		{"Media of another field", MissingMedia{RomPath: "Homebrew/Kubo 3.nes", Field: "marquee", Path: "media/Kubo 3-marquee.png"}, ""},
+		{"No match", MissingMedia{RomPath: "Micro Mages.nes", Field: "image", Path: "media/images/Micro Mages.png"}, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := matchMedia(files, tt.missing, systemPath); got != tt.want {
+				t.Errorf("matchMedia() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,356 @@
+package recaltools
+
+import (
+	"context"
+	"path"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/antchfx/xmlquery"
+	"github.com/jymannob/recaltools/i18n"
+	"github.com/jymannob/recaltools/logger"
+	"github.com/jymannob/recaltools/vfs"
+	"github.com/jymannob/recaltools/xml"
+)
+
+// Renamer renames roms and their media on disk, and updates their gamelist and backup paths so
+// no entry, media or user data is lost
+type Renamer struct {
+	RomsDir       []string
+	Names         map[string]string // new file name by rom path relative to the system directory (`./2048 (tsone).nes`: `2048.nes`)
+	Pattern       string            // regular expression replaced in rom names without extension, when not in Names
+	Replace       string            // replacement of Pattern, `$1` expands to the first submatch
+	DryRun        bool              // do not rename, only list renames
+	FormatJson    bool
+	NormalizeUTF8 bool
+	Renamed       []RenamedRom
+	Options
+	mu sync.Mutex
+}
+
+// RenamedRom is a rom renamed with its media, paths as written in the gamelist
+type RenamedRom struct {
+	Gamelist string            `json:"gamelist"`
+	From     string            `json:"from"`
+	To       string            `json:"to"`
+	Media    map[string]string `json:"media,omitempty"` // new media path by previous path
+}
+
+// rename is a file move, undone if a later move fails
+type rename struct {
+	from, to string
+}
+
+// Rename renames the roms selected by Names or Pattern on every system
+func (r *Renamer) Rename() error {
+	return r.RenameContext(context.Background())
+}
+
+// RenameContext is Rename stopping to start new gamelists once ctx is done
+func (r *Renamer) RenameContext(ctx context.Context) error {
+
+	var re *regexp.Regexp
+	if r.Pattern != "" {
+		var err error
+		if re, err = regexp.Compile(r.Pattern); err != nil {
+			return i18n.NewError(i18n.RenameInvalid, err, r.Pattern)
+		}
+	}
+	for from, to := range r.Names {
+		if !isFileName(to) {
+			return i18n.NewError(i18n.RenameInvalid, nil, from+" : "+to)
+		}
+	}
+
+	gamelists, err := r.scanner().Scan(r.RomsDir)
+	if err != nil {
+		return err
+	}
+
+	err = forEach(ctx, r.Jobs, gamelists, observed(r.observer(), gamelists, func(gamelist string) (int, error) { return r.renameSystem(gamelist, re) }))
+	sort.Slice(r.Renamed, func(i, j int) bool {
+		if r.Renamed[i].Gamelist != r.Renamed[j].Gamelist {
+			return r.Renamed[i].Gamelist < r.Renamed[j].Gamelist
+		}
+		return r.Renamed[i].From < r.Renamed[j].From
+	})
+	if err != nil {
+		return err
+	}
+
+	r.log().Info(i18n.T(i18n.RenameDone, len(r.Renamed)))
+	return nil
+}
+
+// newName returns the new file name of a rom, "" to keep it.
+// A replacement which is not a file name, moving the rom to another folder, is an error.
+func (r *Renamer) newName(romPath string, re *regexp.Regexp) (string, error) {
+	trimmed := strings.TrimPrefix(romPath, "./")
+	for from, to := range r.Names {
+		if strings.TrimPrefix(filepath.ToSlash(from), "./") == trimmed {
+			return to, nil
+		}
+	}
+
+	if re == nil {
+		return "", nil
+	}
+	name := path.Base(romPath)
+	ext := path.Ext(name)
+	renamed := strings.TrimSpace(re.ReplaceAllString(strings.TrimSuffix(name, ext), r.Replace))
+	if renamed == "" {
+		return "", nil
+	}
+	if !isFileName(renamed + ext) {
+		return "", i18n.NewError(i18n.RenameInvalid, nil, romPath+" : "+renamed+ext)
+	}
+	return renamed + ext, nil
+}
+
+// isFileName reports whether name is a file name, not a path to another folder
+func isFileName(name string) bool {
+	return name != "" && name != "." && name != ".." && !strings.ContainsAny(name, `/\`)
+}
+
+func (r *Renamer) renameSystem(gamelist string, re *regexp.Regexp) (int, error) {
+
+	systemPath := filepath.Dir(gamelist)
+
+	doc, enc, err := vfs.ReadXml(r.fs(), gamelist)
+	if err != nil {
+		return 0, err
+	}
+
+	nodes := xmlquery.Find(doc, "//game|//folder")
+	mediaUses := make(map[string]int)
+	for _, node := range nodes {
+		for _, field := range MediaFields {
+			if media := childText(node, field); media != "" {
+				mediaUses[resolvePath(systemPath, media)]++
+			}
+		}
+	}
+
+	var renames []rename
+	var renamed []RenamedRom
+	targets := make(map[string]bool)
+
+	for _, node := range xmlquery.Find(doc, "//game") {
+		romPath := childText(node, "path")
+		if romPath == "" || !r.Filter.MatchNode(node) {
+			continue
+		}
+		name, err := r.newName(romPath, re)
+		if err != nil {
+			r.log().Warn(err.Error(), logger.System(gamelist), logger.Rom(romPath))
+			continue
+		}
+		if name == "" || name == path.Base(romPath) {
+			continue
+		}
+
+		rom := RenamedRom{Gamelist: gamelist, From: romPath, To: replaceBase(romPath, name)}
+		moves := []rename{{resolvePath(systemPath, rom.From), resolvePath(systemPath, rom.To)}}
+
+		// media named after the rom follow it, unless another entry uses them
+		oldBase := strings.TrimSuffix(path.Base(romPath), path.Ext(romPath))
+		newBase := strings.TrimSuffix(name, path.Ext(name))
+		for _, field := range MediaFields {
+			media := childText(node, field)
+			if media == "" || mediaUses[resolvePath(systemPath, media)] > 1 || !strings.HasPrefix(path.Base(media), oldBase) {
+				continue
+			}
+			if _, err := r.fs().Stat(resolvePath(systemPath, media)); err != nil {
+				continue
+			}
+			to := replaceBase(media, newBase+strings.TrimPrefix(path.Base(media), oldBase))
+			if rom.Media == nil {
+				rom.Media = make(map[string]string)
+			}
+			rom.Media[media] = to
+			moves = append(moves, rename{resolvePath(systemPath, media), resolvePath(systemPath, to)})
+		}
+
+		if err := checkRenames(r.fs(), moves, targets); err != nil {
+			r.log().Warn(err.Error(), logger.System(gamelist))
+			continue
+		}
+		for _, move := range moves {
+			targets[move.to] = true
+		}
+
+		r.log().Debug(i18n.T(i18n.RenameRom, rom.From, rom.To), logger.System(gamelist), logger.Rom(rom.From))
+		renames = append(renames, moves...)
+		renamed = append(renamed, rom)
+
+		if !r.DryRun {
+			xml.SetText(node.SelectElement("path"), rom.To)
+			for _, field := range MediaFields {
+				if element := node.SelectElement(field); element != nil {
+					if to, ok := rom.Media[strings.TrimSpace(element.InnerText())]; ok {
+						xml.SetText(element, to)
+					}
+				}
+			}
+		}
+	}
+
+	if len(renamed) == 0 {
+		return 0, nil
+	}
+	if r.DryRun {
+		r.addRenamed(renamed...)
+		return 0, nil
+	}
+
+	// rename every file then write the gamelist, undo everything if one of them fails
+	done, err := moveFiles(r.fs(), renames)
+	if err == nil {
+		if r.NormalizeUTF8 {
+			enc = xml.UTF8
+		}
+		err = vfs.WriteXml(r.fs(), gamelist, doc, enc)
+	}
+	if err != nil {
+		for i := done - 1; i >= 0; i-- {
+			if err := r.fs().Rename(renames[i].to, renames[i].from); err != nil {
+				r.log().Warn(i18n.NewError(i18n.FileMove, err, renames[i].to, renames[i].from).Error(), logger.System(gamelist))
+			}
+		}
+		return 0, err
+	}
+
+	for _, move := range renames {
+		r.observer().FileWritten(gamelist, move.to)
+	}
+	r.observer().FileWritten(gamelist, gamelist)
+	// games are renamed once written
+	for _, rom := range renamed {
+		r.observer().GameUpdated(gamelist, rom.From)
+	}
+
+	r.addRenamed(renamed...)
+	if err := r.renamePlaylists(gamelist, nodes, renames); err != nil {
+		return len(renamed), err
+	}
+	return len(renamed), r.renameBackup(gamelist, renamed)
+}
+
+// renamePlaylists updates the .m3u playlists of the gamelist listing renamed files, so multi-disc games
+// still find their discs
+func (r *Renamer) renamePlaylists(gamelist string, nodes []*xmlquery.Node, renames []rename) error {
+	systemPath := filepath.Dir(gamelist)
+	moved := make(map[string]string)
+	for _, move := range renames {
+		moved[move.from] = move.to
+	}
+
+	for _, node := range nodes {
+		romPath := childText(node, "path")
+		if !strings.EqualFold(path.Ext(romPath), ".m3u") {
+			continue
+		}
+		m3u := resolvePath(systemPath, romPath)
+		raw, err := r.fs().ReadFile(m3u)
+		if err != nil {
+			continue
+		}
+
+		changed := false
+		lines := strings.Split(string(raw), "\n")
+		for i, line := range lines {
+			entry := strings.TrimSpace(line)
+			if entry == "" || strings.HasPrefix(entry, "#") {
+				continue
+			}
+			if to, ok := moved[resolvePath(filepath.Dir(m3u), entry)]; ok {
+				lines[i] = strings.Replace(line, entry, replaceBase(entry, filepath.Base(to)), 1)
+				changed = true
+			}
+		}
+		if !changed {
+			continue
+		}
+
+		r.log().Debug(i18n.T(i18n.RenamePlaylist, m3u), logger.System(gamelist))
+		if err := vfs.WriteFile(r.fs(), m3u, []byte(strings.Join(lines, "\n"))); err != nil {
+			return err
+		}
+		r.observer().FileWritten(gamelist, m3u)
+	}
+	return nil
+}
+
+// renameBackup moves the backup entries of renamed roms to their new path
+func (r *Renamer) renameBackup(gamelist string, renamed []RenamedRom) error {
+	backupFile := filepath.Join(filepath.Dir(gamelist), fileBackupName)
+	if _, err := r.fs().Stat(backupFile); err != nil {
+		return nil
+	}
+
+	var backup SystemBackup
+	if err := vfs.ReadJson(r.fs(), backupFile, &backup); err != nil {
+		return err
+	}
+
+	changed := false
+	for _, rom := range renamed {
+		game, ok := backup.Games[rom.From]
+		if !ok {
+			continue
+		}
+		delete(backup.Games, rom.From)
+		game.RomPath = rom.To
+		backup.Games[rom.To] = game
+		changed = true
+	}
+
+	if !changed {
+		return nil
+	}
+	if err := vfs.WriteJson(r.fs(), backupFile, backup, r.FormatJson); err != nil {
+		return err
+	}
+	r.observer().FileWritten(gamelist, backupFile)
+	return nil
+}
+
+func (r *Renamer) addRenamed(renamed ...RenamedRom) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.Renamed = append(r.Renamed, renamed...)
+}
+
+// checkRenames refuses to rename a missing file, or to overwrite an existing file or a file already renamed to
+func checkRenames(fsys vfs.FS, moves []rename, targets map[string]bool) error {
+	for _, move := range moves {
+		if _, err := fsys.Stat(move.from); err != nil {
+			return i18n.NewError(i18n.FileNotExist, nil, move.from)
+		}
+		if _, err := fsys.Stat(move.to); err == nil || targets[move.to] {
+			return i18n.NewError(i18n.RenameExists, nil, move.from, move.to)
+		}
+	}
+	return nil
+}
+
+// moveFiles renames files in order and returns how many have been renamed
+func moveFiles(fsys vfs.FS, renames []rename) (int, error) {
+	for i, move := range renames {
+		if err := fsys.MkdirAll(filepath.Dir(move.to)); err != nil {
+			return i, i18n.NewError(i18n.FileMove, err, move.from, move.to)
+		}
+		if err := fsys.Rename(move.from, move.to); err != nil {
+			return i, i18n.NewError(i18n.FileMove, err, move.from, move.to)
+		}
+	}
+	return len(renames), nil
+}
+
+// replaceBase replaces the file name of a gamelist path, keeping its folder written the same way
+func replaceBase(p, name string) string {
+	return p[:len(p)-len(path.Base(p))] + name
+}
@@ -0,0 +1,192 @@
+package recaltools
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/jymannob/recaltools/utils"
+	"github.com/jymannob/recaltools/vfs"
+	"github.com/jymannob/recaltools/xml"
+)
+
+// Functional testing
+func TestRenamer(t *testing.T) {
+	romsDir := t.TempDir()
+	systemPath := filepath.Join(romsDir, "nes")
+
+	writeFiles(t, systemPath, map[string]string{
+		"2048 (tsone).nes":                    "2048",
+		"media/images/2048 (tsone).png":       "2048 image",
+		"media/videos/2048 (tsone)-video.mp4": "2048 video",
+		"Blocked (tsone).nes":                 "blocked",
+		"Blocked.nes":                         "blocked",
+		"Shared (tsone).nes":                  "shared",
+		"media/images/shared.png":             "shared image",
+		"Kept.nes":                            "kept",
+	})
+
+	gamelist := `<?xml version="1.0"?>
+<gameList>
+  <game>
+    <path>./2048 (tsone).nes</path>
+    <name>2048</name>
+    <image>./media/images/2048 (tsone).png</image>
+    <video>./media/videos/2048 (tsone)-video.mp4</video>
+    <favorite>true</favorite>
+  </game>
+  <game>
+    <path>./Blocked (tsone).nes</path>
+    <name>Blocked</name>
+  </game>
+  <game>
+    <path>./Shared (tsone).nes</path>
+    <name>Shared</name>
+    <image>./media/images/shared.png</image>
+  </game>
+  <game>
+    <path>./Kept.nes</path>
+    <name>Kept</name>
+    <image>./media/images/shared.png</image>
+  </game>
+</gameList>
+`
+	if err := os.WriteFile(filepath.Join(systemPath, "gamelist.xml"), []byte(gamelist), 0664); err != nil {
+		t.Fatal(err)
+	}
+	backup := SystemBackup{Games: map[string]*Game{"./2048 (tsone).nes": {RomPath: "./2048 (tsone).nes", Favorite: true}}}
+	if err := utils.WriteJsonFile(filepath.Join(systemPath, fileBackupName), backup, true); err != nil {
+		t.Fatal(err)
+	}
+
+	// dry run
+	r := &Renamer{RomsDir: []string{romsDir}, Pattern: `\s*\(tsone\)`, DryRun: true}
+	if err := r.Rename(); err != nil {
+		t.Fatalf("Renamer.Rename() error = %v", err)
+	}
+	if len(r.Renamed) != 2 {
+		t.Fatalf("Renamer.Renamed = %+v, want 2048 and Shared", r.Renamed)
+	}
+	assertExist(t, "dry run", filepath.Join(systemPath, "2048 (tsone).nes"), true)
+
+	r = &Renamer{RomsDir: []string{romsDir}, Pattern: `\s*\(tsone\)`}
+	if err := r.Rename(); err != nil {
+		t.Fatalf("Renamer.Rename() error = %v", err)
+	}
+
+	// roms and media named after them are renamed, blocked and shared files are kept
+	for path, want := range map[string]bool{
+		"2048 (tsone).nes":                    false,
+		"2048.nes":                            true,
+		"media/images/2048.png":               true,
+		"media/videos/2048-video.mp4":         true,
+		"media/videos/2048 (tsone)-video.mp4": false,
+		"Blocked (tsone).nes":                 true,
+		"Shared.nes":                          true,
+		"media/images/shared.png":             true,
+	} {
+		assertExist(t, "rename", filepath.Join(systemPath, path), want)
+	}
+
+	doc, err := xml.OpenXml(filepath.Join(systemPath, "gamelist.xml"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	idx := xml.NewIndex(doc)
+	game := idx.ByPath("./2048.nes")
+	if game == nil {
+		t.Fatalf("gamelist path not renamed")
+	}
+	if got := childText(game, "image"); got != "./media/images/2048.png" {
+		t.Errorf("image = %s, want ./media/images/2048.png", got)
+	}
+	if got := childText(game, "video"); got != "./media/videos/2048-video.mp4" {
+		t.Errorf("video = %s, want ./media/videos/2048-video.mp4", got)
+	}
+	if got := childText(idx.ByPath("./Shared.nes"), "image"); got != "./media/images/shared.png" {
+		t.Errorf("shared image = %s, want ./media/images/shared.png", got)
+	}
+	if idx.ByPath("./Blocked (tsone).nes") == nil {
+		t.Errorf("blocked rom path changed")
+	}
+
+	backup = SystemBackup{}
+	if err := utils.ReadJsonFile(filepath.Join(systemPath, fileBackupName), &backup); err != nil {
+		t.Fatal(err)
+	}
+	if g := backup.Games["./2048.nes"]; g == nil || g.RomPath != "./2048.nes" || !g.Favorite {
+		t.Errorf("backup entry not renamed : %+v", backup.Games)
+	}
+
+	// rename map
+	r = &Renamer{RomsDir: []string{romsDir}, Names: map[string]string{"Kept.nes": "Kept (USA).nes"}}
+	if err := r.Rename(); err != nil {
+		t.Fatalf("Renamer.Rename() error = %v", err)
+	}
+	assertExist(t, "map", filepath.Join(systemPath, "Kept (USA).nes"), true)
+
+	for _, to := range []string{"../Kept.nes", "..", "sub/Kept.nes"} {
+		r = &Renamer{RomsDir: []string{romsDir}, Names: map[string]string{"Kept (USA).nes": to}}
+		if err := r.Rename(); err == nil {
+			t.Errorf("Renamer.Rename() no error renaming to %s", to)
+		}
+	}
+
+	// a replacement moving roms to another folder is refused
+	r = &Renamer{RomsDir: []string{romsDir}, Pattern: `^Kept`, Replace: "../Kept"}
+	if err := r.Rename(); err != nil || len(r.Renamed) != 0 {
+		t.Errorf("Renamer.Rename() to another folder = %+v, %v, want nothing renamed", r.Renamed, err)
+	}
+	assertExist(t, "replace", filepath.Join(systemPath, "Kept (USA).nes"), true)
+}
+
+func TestRenamer_playlists(t *testing.T) {
+	romsDir := t.TempDir()
+	systemPath := filepath.Join(romsDir, "psx")
+	writeFiles(t, systemPath, map[string]string{
+		"Game (Disc 1) [!].chd": "",
+		"Game (Disc 2) [!].chd": "",
+		"Game.m3u":              "Game (Disc 1) [!].chd\r\nGame (Disc 2) [!].chd\r\n",
+		"gamelist.xml": `<gameList><game><path>./Game.m3u</path></game>` +
+			`<game><path>./Game (Disc 1) [!].chd</path><hidden>true</hidden></game>` +
+			`<game><path>./Game (Disc 2) [!].chd</path><hidden>true</hidden></game></gameList>`,
+	})
+
+	r := &Renamer{RomsDir: []string{romsDir}, Pattern: `\s*\[!\]`}
+	if err := r.Rename(); err != nil {
+		t.Fatalf("Renamer.Rename() error = %v", err)
+	}
+	got, _ := os.ReadFile(filepath.Join(systemPath, "Game.m3u"))
+	if want := "Game (Disc 1).chd\r\nGame (Disc 2).chd\r\n"; string(got) != want {
+		t.Errorf("Renamer.Rename() playlist = %q, want %q", got, want)
+	}
+}
+
+func TestRenamer_overlay(t *testing.T) {
+	romsDir := t.TempDir()
+	systemPath := filepath.Join(romsDir, "nes")
+	writeFiles(t, systemPath, map[string]string{
+		"2048 (tsone).nes":              "",
+		"media/images/2048 (tsone).png": "",
+		"gamelist.xml":                  "<gameList><game><path>./2048 (tsone).nes</path><image>./media/images/2048 (tsone).png</image></game></gameList>",
+	})
+
+	overlay := vfs.NewOverlay(vfs.OS{})
+	r := &Renamer{RomsDir: []string{romsDir}, Pattern: `\s*\(tsone\)`, Options: Options{FS: overlay}}
+	if err := r.Rename(); err != nil {
+		t.Fatalf("Renamer.Rename() error = %v", err)
+	}
+
+	// the renames are seen through the overlay only
+	if _, err := overlay.Stat(filepath.Join(systemPath, "media", "images", "2048.png")); err != nil {
+		t.Errorf("Overlay.Stat() of the renamed media error = %v", err)
+	}
+	if _, err := overlay.Stat(filepath.Join(systemPath, "2048 (tsone).nes")); err == nil {
+		t.Errorf("Overlay.Stat() of the old rom, want error")
+	}
+	if got := len(overlay.Removed()); got != 2 {
+		t.Errorf("Overlay.Removed() = %v, want the rom and its media", overlay.Removed())
+	}
+	assertExist(t, "overlay", filepath.Join(systemPath, "2048 (tsone).nes"), true)
+	assertExist(t, "overlay", filepath.Join(systemPath, "2048.nes"), false)
+}
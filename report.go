@@ -0,0 +1,166 @@
+package recaltools
+
+import (
+	"context"
+	"errors"
+	"sort"
+	"sync"
+	"time"
+)
+
+// ReportVersion is the version of the Report schema.
+// Fields may be added without changing it, it is increased when a field is removed or changes meaning.
+const ReportVersion = 1
+
+// Statuses of a run and of its systems
+const (
+	StatusOk          = "ok"
+	StatusPartial     = "partial"     // run only, some systems failed
+	StatusFailed      = "failed"      // every system failed, or the command could not run
+	StatusInterrupted = "interrupted" // run only, stopped by SIGINT or SIGTERM
+	StatusSkipped     = "skipped"     // system only, not started because the run was interrupted
+)
+
+// Report is the machine-readable result of a run, the same for every command
+type Report struct {
+	Version    int            `json:"version"`     // ReportVersion
+	Command    string         `json:"command"`     // subcommand, `trash restore` for nested ones
+	Status     string         `json:"status"`      // ok, partial, failed or interrupted
+	Start      time.Time      `json:"start"`       // RFC 3339 date
+	DurationMs int64          `json:"duration_ms"` // whole run
+	Games      int            `json:"games"`       // sum of the systems games
+	Unmatched  int            `json:"unmatched"`   // sum of the systems unmatched games
+	Error      string         `json:"error,omitempty"`
+	Systems    []SystemReport `json:"systems"` // sorted by path
+}
+
+// SystemReport is the result of a gamelist, or of a system directory for `usage`
+type SystemReport struct {
+	Path       string   `json:"path"`
+	Status     string   `json:"status"`      // ok, failed or skipped
+	Games      int      `json:"games"`       // games backed up, restored, cleaned, hidden, renamed...
+	Unmatched  int      `json:"unmatched"`   // backed up games missing from the gamelist
+	Files      []string `json:"files"`       // files written, in the order they were
+	DurationMs int64    `json:"duration_ms"` // 0 if skipped
+	Error      string   `json:"error,omitempty"`
+}
+
+// Reporter is an Observer building the Report of a run
+type Reporter struct {
+	command string
+	start   time.Time
+	now     func() time.Time
+
+	mu      sync.Mutex
+	systems map[string]*SystemReport
+	started map[string]time.Time
+}
+
+// NewReporter returns a Reporter of the command, its run starts now
+func NewReporter(command string) *Reporter {
+	return &Reporter{
+		command: command,
+		start:   time.Now(),
+		now:     time.Now,
+		systems: make(map[string]*SystemReport),
+		started: make(map[string]time.Time),
+	}
+}
+
+// system returns the report of the gamelist, it must be called with mu held
+func (r *Reporter) system(gamelist string) *SystemReport {
+	system, ok := r.systems[gamelist]
+	if !ok {
+		system = &SystemReport{Path: gamelist, Status: StatusSkipped, Files: []string{}}
+		r.systems[gamelist] = system
+	}
+	return system
+}
+
+func (r *Reporter) SystemDiscovered(gamelist string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.system(gamelist)
+}
+
+func (r *Reporter) SystemStarted(gamelist string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.system(gamelist)
+	r.started[gamelist] = r.now()
+}
+
+func (r *Reporter) SystemFinished(gamelist string, games int) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	system := r.system(gamelist)
+	system.Status = StatusOk
+	system.Games = games
+	system.DurationMs = r.now().Sub(r.started[gamelist]).Milliseconds()
+}
+
+func (r *Reporter) GameUpdated(gamelist, romPath string) {}
+
+func (r *Reporter) GameUnmatched(gamelist, romPath string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.system(gamelist).Unmatched++
+}
+
+func (r *Reporter) FileWritten(gamelist, path string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	system := r.system(gamelist)
+	system.Files = append(system.Files, path)
+}
+
+func (r *Reporter) Error(gamelist string, err error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	system := r.system(gamelist)
+	system.Status = StatusFailed
+	system.Error = err.Error()
+	system.DurationMs = r.now().Sub(r.started[gamelist]).Milliseconds()
+}
+
+// Report returns the report of the run ended with err, the error returned by the command
+func (r *Reporter) Report(err error) Report {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	report := Report{
+		Version:    ReportVersion,
+		Command:    r.command,
+		Status:     runStatus(err),
+		Start:      r.start,
+		DurationMs: r.now().Sub(r.start).Milliseconds(),
+		Systems:    []SystemReport{},
+	}
+	if err != nil {
+		report.Error = err.Error()
+	}
+
+	for _, system := range r.systems {
+		report.Games += system.Games
+		report.Unmatched += system.Unmatched
+		report.Systems = append(report.Systems, *system)
+	}
+	sort.Slice(report.Systems, func(i, j int) bool { return report.Systems[i].Path < report.Systems[j].Path })
+
+	return report
+}
+
+// runStatus returns the status of a run ended with err
+func runStatus(err error) string {
+	var runErr *RunError
+	switch {
+	case err == nil:
+		return StatusOk
+	case errors.Is(err, context.Canceled), errors.Is(err, context.DeadlineExceeded):
+		return StatusInterrupted
+	case errors.As(err, &runErr) && runErr.Partial():
+		return StatusPartial
+	default:
+		return StatusFailed
+	}
+}
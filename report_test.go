@@ -0,0 +1,75 @@
+package recaltools
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestReporter_Report(t *testing.T) {
+	romsDir := copyTestdata(t, "megadrive", "nes")
+	megadrive := filepath.Join(romsDir, "megadrive", "gamelist.xml")
+	nes := filepath.Join(romsDir, "nes", "gamelist.xml")
+	if err := os.WriteFile(megadrive, []byte("<gameList>"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	reporter := NewReporter("restore")
+	fb := &FavBackup{RomsDir: []string{romsDir}, Options: Options{Observer: reporter}}
+	err := fb.Restore()
+	report := reporter.Report(err)
+
+	if report.Version != ReportVersion || report.Command != "restore" || report.Status != StatusPartial {
+		t.Errorf("Report() = version %d, command %q, status %q", report.Version, report.Command, report.Status)
+	}
+	if len(report.Systems) != 2 || report.Systems[0].Path != megadrive || report.Systems[1].Path != nes {
+		t.Fatalf("Report() systems = %+v, want megadrive then nes", report.Systems)
+	}
+
+	failed, ok := report.Systems[0], report.Systems[1]
+	if failed.Status != StatusFailed || failed.Error == "" || len(failed.Files) != 0 {
+		t.Errorf("Report() megadrive = %+v, want failed", failed)
+	}
+	if ok.Status != StatusOk || ok.Games == 0 || len(ok.Files) != 1 || ok.Files[0] != nes {
+		t.Errorf("Report() nes = %+v, want ok with the gamelist written", ok)
+	}
+	if report.Games != ok.Games || !strings.Contains(report.Error, megadrive) {
+		t.Errorf("Report() games = %d, error = %q", report.Games, report.Error)
+	}
+
+	// the schema keys are stable
+	j, err := json.Marshal(report)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var keys map[string]interface{}
+	if err := json.Unmarshal(j, &keys); err != nil {
+		t.Fatal(err)
+	}
+	for _, key := range []string{"version", "command", "status", "start", "duration_ms", "games", "unmatched", "error", "systems"} {
+		if _, ok := keys[key]; !ok {
+			t.Errorf("Report() json has no %q key", key)
+		}
+	}
+}
+
+func TestReporter_skipped(t *testing.T) {
+	reporter := NewReporter("backup")
+	reporter.SystemDiscovered("nes/gamelist.xml")
+	report := reporter.Report(&RunError{Err: context.Canceled})
+
+	if report.Status != StatusInterrupted {
+		t.Errorf("Report() status = %q, want %q", report.Status, StatusInterrupted)
+	}
+	if len(report.Systems) != 1 || report.Systems[0].Status != StatusSkipped || report.Systems[0].Files == nil {
+		t.Errorf("Report() systems = %+v, want nes skipped", report.Systems)
+	}
+
+	if got := NewReporter("trash empty").Report(errors.New("denied")); got.Status != StatusFailed || got.Systems == nil {
+		t.Errorf("Report() = %+v, want failed with no systems", got)
+	}
+}
@@ -0,0 +1,181 @@
+package recaltools
+
+import (
+	"io/fs"
+	"path"
+	"path/filepath"
+
+	"github.com/jymannob/recaltools/i18n"
+	"github.com/jymannob/recaltools/logger"
+	"github.com/jymannob/recaltools/trash"
+	"github.com/jymannob/recaltools/vfs"
+)
+
+// Scanner finds the gamelists of roms directories.
+// A directory reached twice, through a symlink or a bind mount between roots, is scanned once.
+type Scanner struct {
+	FollowSymlinks bool          // walk symlinked directories, roots are always followed
+	Logger         logger.Logger // logs the directories reached twice and the directories skipped, dropped if nil
+	FS             vfs.FS        // filesystem of the roots, vfs.OS if nil
+	Filter         Filter        // systems whose gamelists are returned, game filters are ignored
+}
+
+// fileKey identifies a file whatever the path it is reached by
+type fileKey struct {
+	dev, ino uint64
+	path     string // resolved path when the system has no inodes
+}
+
+// Scan walks roots and returns every `gamelist.xml` of the selected systems, each one once.
+// Roots which can not be read, like an unplugged externals directory, are skipped unless none can be.
+func (s Scanner) Scan(roots []string) ([]string, error) {
+	if err := s.Filter.Validate(); err != nil {
+		return nil, err
+	}
+	sc := &scan{Scanner: s, fsys: vfs.Default(s.FS), seen: make(map[fileKey]string)}
+
+	for _, root := range roots {
+		info, err := sc.fsys.Stat(root)
+		if err != nil {
+			sc.skip(root, err)
+			continue
+		}
+		if err := sc.walk(root, info); err != nil {
+			sc.skip(root, err)
+			continue
+		}
+		sc.scanned++
+	}
+
+	if sc.scanned == 0 && sc.skipped != nil {
+		return nil, sc.skipped
+	}
+	return sc.gamelists, nil
+}
+
+// SystemDirs returns the selected system directories of roots, the directories right under each root,
+// each one once. Symlinked directories are not followed, roots which can not be read are skipped unless none can be.
+func (s Scanner) SystemDirs(roots []string) ([]string, error) {
+	if err := s.Filter.Validate(); err != nil {
+		return nil, err
+	}
+	sc := &scan{Scanner: s, fsys: vfs.Default(s.FS), seen: make(map[fileKey]string)}
+
+	var dirs []string
+	for _, root := range roots {
+		entries, err := sc.fsys.ReadDir(root)
+		if err != nil {
+			sc.skip(root, err)
+			continue
+		}
+		sc.scanned++
+
+		for _, entry := range entries {
+			if !entry.IsDir() || entry.Name() == trash.DirName || !s.Filter.MatchSystem(entry.Name()) {
+				continue
+			}
+			info, err := entry.Info()
+			if err != nil {
+				return nil, err
+			}
+			if name := filepath.Join(root, entry.Name()); sc.visit(name, info) {
+				dirs = append(dirs, name)
+			}
+		}
+	}
+
+	if sc.scanned == 0 && sc.skipped != nil {
+		return nil, sc.skipped
+	}
+	return dirs, nil
+}
+
+// scan is the state of a single Scan
+type scan struct {
+	Scanner
+	fsys      vfs.FS
+	seen      map[fileKey]string // first path each directory and gamelist was reached by
+	gamelists []string
+	scanned   int   // roots read
+	skipped   error // first root which could not be read
+}
+
+// skip logs a root which can not be read
+func (sc *scan) skip(root string, err error) {
+	err = i18n.NewError(i18n.ScanRoot, err, root)
+	if sc.Logger != nil {
+		sc.Logger.Warn(err.Error())
+	}
+	if sc.skipped == nil {
+		sc.skipped = err
+	}
+}
+
+func (sc *scan) walk(dir string, info fs.FileInfo) error {
+	if !sc.visit(dir, info) {
+		return nil
+	}
+
+	entries, err := sc.fsys.ReadDir(dir)
+	if err != nil {
+		return err
+	}
+
+	for _, entry := range entries {
+		name := filepath.Join(dir, entry.Name())
+
+		info, err := entry.Info()
+		if err != nil {
+			return err
+		}
+		if info.Mode()&fs.ModeSymlink != 0 {
+			// skip broken links
+			if info, err = sc.fsys.Stat(name); err != nil {
+				continue
+			}
+			if info.IsDir() && !sc.FollowSymlinks {
+				continue
+			}
+		}
+
+		switch {
+		case info.IsDir():
+			// trashed gamelists are never processed
+			if entry.Name() == trash.DirName {
+				continue
+			}
+			// a sub directory which can not be read does not end the scan
+			if err := sc.walk(name, info); err != nil && sc.Logger != nil {
+				sc.Logger.Warn(i18n.NewError(i18n.ScanDir, err, name).Error())
+			}
+		case entry.Name() == "gamelist.xml" && sc.Filter.MatchSystem(filepath.Base(dir)) && sc.visit(name, info):
+			sc.gamelists = append(sc.gamelists, name)
+		}
+	}
+
+	return nil
+}
+
+// visit reports whether the file is reached for the first time
+func (sc *scan) visit(name string, info fs.FileInfo) bool {
+	key, ok := statKey(info)
+	if _, isOS := sc.fsys.(vfs.OS); !ok && isOS {
+		resolved, err := filepath.EvalSymlinks(name)
+		if err != nil {
+			resolved = name
+		}
+		key.path, _ = filepath.Abs(resolved)
+	} else if !ok {
+		// other filesystems have no links
+		key.path = path.Clean(filepath.ToSlash(name))
+	}
+
+	if first, found := sc.seen[key]; found {
+		if sc.Logger != nil {
+			sc.Logger.Debug(i18n.T(i18n.ScanDuplicate, name, first))
+		}
+		return false
+	}
+	sc.seen[key] = name
+	return true
+}
@@ -0,0 +1,11 @@
+//go:build !linux && !darwin && !freebsd && !netbsd && !openbsd && !dragonfly
+// +build !linux,!darwin,!freebsd,!netbsd,!openbsd,!dragonfly
+
+package recaltools
+
+import "io/fs"
+
+// statKey has no inode to return, files are identified by their resolved path
+func statKey(info fs.FileInfo) (fileKey, bool) {
+	return fileKey{}, false
+}
@@ -0,0 +1,160 @@
+package recaltools
+
+import (
+	"bytes"
+	"errors"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/jymannob/recaltools/i18n"
+	"github.com/jymannob/recaltools/logger"
+	"github.com/jymannob/recaltools/trash"
+	"github.com/jymannob/recaltools/vfs"
+)
+
+func TestScanner_Scan(t *testing.T) {
+	dir := t.TempDir()
+	roms := filepath.Join(dir, "roms")
+	externals := filepath.Join(dir, "externals")
+
+	for _, path := range []string{
+		filepath.Join(roms, "nes", "gamelist.xml"),
+		filepath.Join(roms, "snes", "gamelist.xml"),
+		filepath.Join(roms, trash.DirName, "snes", "gamelist.xml"),
+		filepath.Join(externals, "megadrive", "gamelist.xml"),
+	} {
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte("<gameList/>"), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// externals mounted in the roms directory, and a symlink loop
+	if err := os.Symlink(externals, filepath.Join(roms, "externals")); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Symlink(roms, filepath.Join(roms, "nes", "loop")); err != nil {
+		t.Fatal(err)
+	}
+	// the roms directory reached through a symlinked root
+	link := filepath.Join(dir, "link")
+	if err := os.Symlink(roms, link); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name           string
+		followSymlinks bool
+		roots          []string
+		want           []string
+	}{
+		{
+			"Symlinks not followed",
+			false,
+			[]string{roms},
+			[]string{
+				filepath.Join(roms, "nes", "gamelist.xml"),
+				filepath.Join(roms, "snes", "gamelist.xml"),
+			},
+		},
+		{
+			"Symlinks followed once",
+			true,
+			[]string{roms, externals},
+			[]string{
+				filepath.Join(roms, "externals", "megadrive", "gamelist.xml"),
+				filepath.Join(roms, "nes", "gamelist.xml"),
+				filepath.Join(roms, "snes", "gamelist.xml"),
+			},
+		},
+		{
+			"Same root twice",
+			false,
+			[]string{roms, link, externals},
+			[]string{
+				filepath.Join(roms, "nes", "gamelist.xml"),
+				filepath.Join(roms, "snes", "gamelist.xml"),
+				filepath.Join(externals, "megadrive", "gamelist.xml"),
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := Scanner{FollowSymlinks: tt.followSymlinks}.Scan(tt.roots)
+			if err != nil {
+				t.Fatalf("Scanner.Scan() error = %v", err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Scanner.Scan() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+
+	// an unplugged externals directory is skipped, unless no root is left
+	missing := filepath.Join(dir, "missing")
+	if got, err := (Scanner{}).Scan([]string{roms, missing}); err != nil || len(got) != 2 {
+		t.Errorf("Scanner.Scan() with a missing root = %v, %v, want the gamelists of the other root", got, err)
+	}
+	if _, err := (Scanner{}).Scan([]string{missing}); !errors.Is(err, &i18n.Error{Key: i18n.ScanRoot}) {
+		t.Errorf("Scanner.Scan() missing root error = %v, want ScanRoot", err)
+	}
+}
+
+// unreadable fails reading the directory dir
+type unreadable struct {
+	vfs.FS
+	dir string
+}
+
+func (u unreadable) ReadDir(name string) ([]fs.DirEntry, error) {
+	if name == u.dir {
+		return nil, fs.ErrPermission
+	}
+	return u.FS.ReadDir(name)
+}
+
+func TestScanner_Scan_unreadable(t *testing.T) {
+	mem := vfs.NewMem()
+	for _, name := range []string{"roms/nes/gamelist.xml", "roms/snes/gamelist.xml"} {
+		if err := mem.WriteFile(name, []byte("<gameList/>")); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	var logs bytes.Buffer
+	scanner := Scanner{FS: unreadable{mem, "roms/nes"}, Logger: logger.New(&logs, logger.LevelWarn, logger.Text)}
+	got, err := scanner.Scan([]string{"roms"})
+	if err != nil {
+		t.Fatalf("Scanner.Scan() error = %v", err)
+	}
+	if want := []string{"roms/snes/gamelist.xml"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("Scanner.Scan() = %v, want %v", got, want)
+	}
+	if !bytes.Contains(logs.Bytes(), []byte("roms/nes")) {
+		t.Errorf("Scanner.Scan() logs = %q, want a warning about roms/nes", logs.String())
+	}
+
+	// a root which can not be read is skipped
+	scanner.FS = unreadable{mem, "roms"}
+	if _, err := scanner.Scan([]string{"roms"}); !errors.Is(err, &i18n.Error{Key: i18n.ScanRoot}) {
+		t.Errorf("Scanner.Scan() unreadable root error = %v, want ScanRoot", err)
+	}
+}
+
+func TestFavBackup_Backup_roots(t *testing.T) {
+	romsDir := copyTestdata(t, "megadrive", "nes")
+
+	fb := &FavBackup{RomsDir: []string{romsDir, romsDir}}
+	for i := 0; i < 2; i++ {
+		if err := fb.Backup(); err != nil {
+			t.Fatalf("FavBackup.Backup() error = %v", err)
+		}
+		if len(fb.Gamelists) != 2 {
+			t.Errorf("FavBackup.Backup() run %d found %d gamelists, want 2", i+1, len(fb.Gamelists))
+		}
+	}
+}
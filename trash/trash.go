@@ -0,0 +1,331 @@
+/*
+Package trash moves files to a dated folder instead of deleting them,
+they can be listed and restored until the trash is emptied.
+*/
+package trash
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/jymannob/recaltools/i18n"
+	"github.com/jymannob/recaltools/utils"
+)
+
+// DirName is the name of the trash folder created in each roms directory
+const DirName = ".trash"
+
+// name of the file listing trashed files
+const indexName = "index.json"
+
+// layout of the dated folders
+const dateLayout = "20060102-150405"
+
+// Trash is a folder holding trashed files, it must be on the same filesystem as the files it receives
+type Trash struct {
+	Dir string
+	mu  sync.Mutex
+	now func() time.Time
+}
+
+// Entry is a trashed file or directory
+type Entry struct {
+	ID       string    `json:"id"`   // path of the trashed file relative to the trash folder
+	Path     string    `json:"path"` // original path
+	Date     time.Time `json:"date"`
+	Size     int64     `json:"size"`
+	IsDir    bool      `json:"dir,omitempty"`
+	restored bool
+}
+
+// New returns the trash stored in dir
+func New(dir string) *Trash {
+	return &Trash{Dir: dir, now: time.Now}
+}
+
+// ForRomsDir returns the trash of a roms directory
+func ForRomsDir(romsDir string) *Trash {
+	return New(filepath.Join(romsDir, DirName))
+}
+
+// Put moves a file or directory to a dated folder of the trash and records its original path
+func (t *Trash) Put(path string) (Entry, error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	abs, err := filepath.Abs(path)
+	if err != nil {
+		return Entry{}, i18n.NewError(i18n.TrashPut, err, path)
+	}
+	info, err := os.Stat(abs)
+	if err != nil {
+		return Entry{}, i18n.NewError(i18n.TrashPut, err, path)
+	}
+
+	now := t.now()
+	id := filepath.Join(now.Format(dateLayout), t.relativeName(abs))
+	for i := 1; exists(filepath.Join(t.Dir, id)); i++ {
+		id = filepath.Join(now.Format(dateLayout), fmt.Sprintf("%s.%d", t.relativeName(abs), i))
+	}
+
+	dest := filepath.Join(t.Dir, id)
+	if err := os.MkdirAll(filepath.Dir(dest), 0775); err != nil {
+		return Entry{}, i18n.NewError(i18n.TrashPut, err, path)
+	}
+	if err := os.Rename(abs, dest); err != nil {
+		return Entry{}, i18n.NewError(i18n.TrashPut, err, path)
+	}
+
+	entry := Entry{ID: filepath.ToSlash(id), Path: abs, Date: now, Size: dirSize(dest), IsDir: info.IsDir()}
+
+	entries, err := t.read()
+	if err != nil {
+		return entry, err
+	}
+	return entry, t.write(append(entries, entry))
+}
+
+// List returns the trashed files, oldest first
+func (t *Trash) List() ([]Entry, error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	return t.read()
+}
+
+// Restore moves trashed files back to their original path.
+// Each selector is an entry ID or an original path, every entry is restored if no selector is given.
+// Existing files are never overwritten.
+func (t *Trash) Restore(selectors ...string) ([]Entry, error) {
+	return t.RestoreContext(context.Background(), selectors...)
+}
+
+// RestoreContext is Restore stopping to move files once ctx is done, the files already restored are recorded
+func (t *Trash) RestoreContext(ctx context.Context, selectors ...string) ([]Entry, error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	entries, err := t.read()
+	if err != nil {
+		return nil, err
+	}
+
+	var restored []Entry
+	var errs []string
+	for i, entry := range entries {
+		if !entry.match(selectors) {
+			continue
+		}
+		if ctx.Err() != nil {
+			break
+		}
+
+		if exists(entry.Path) {
+			errs = append(errs, i18n.NewError(i18n.FileExists, nil, entry.Path).Error())
+			continue
+		}
+		if err := os.MkdirAll(filepath.Dir(entry.Path), 0775); err != nil {
+			errs = append(errs, i18n.NewError(i18n.TrashRestore, err, entry.Path).Error())
+			continue
+		}
+		if err := os.Rename(filepath.Join(t.Dir, entry.ID), entry.Path); err != nil {
+			errs = append(errs, i18n.NewError(i18n.TrashRestore, err, entry.Path).Error())
+			continue
+		}
+
+		entries[i].restored = true
+		restored = append(restored, entry)
+	}
+
+	if err := t.write(entries); err != nil {
+		return restored, err
+	}
+	if ctx.Err() != nil {
+		return restored, ctx.Err()
+	}
+	if len(errs) > 0 {
+		return restored, i18n.NewError(i18n.TrashRestoreFailed, errors.New(strings.Join(errs, "\n")), len(errs))
+	}
+	return restored, nil
+}
+
+// Empty deletes for good the files trashed for more than olderThan (all files if 0)
+func (t *Trash) Empty(olderThan time.Duration) ([]Entry, error) {
+	return t.EmptyContext(context.Background(), olderThan)
+}
+
+// EmptyContext is Empty stopping to delete files once ctx is done or a file can not be deleted,
+// the files already deleted are recorded
+func (t *Trash) EmptyContext(ctx context.Context, olderThan time.Duration) ([]Entry, error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	entries, err := t.read()
+	if err != nil {
+		return nil, err
+	}
+
+	limit := t.now().Add(-olderThan)
+	var deleted []Entry
+	var deleteErr error
+	for i, entry := range entries {
+		if olderThan > 0 && entry.Date.After(limit) {
+			continue
+		}
+		if ctx.Err() != nil {
+			break
+		}
+		if deleteErr = utils.DeleteFile(filepath.Join(t.Dir, entry.ID)); deleteErr != nil {
+			break
+		}
+		entries[i].restored = true
+		deleted = append(deleted, entry)
+	}
+
+	if err := t.write(entries); err != nil {
+		return deleted, err
+	}
+	if deleteErr != nil {
+		return deleted, deleteErr
+	}
+	if err := t.removeEmptyDateDirs(); err != nil {
+		return deleted, err
+	}
+	return deleted, ctx.Err()
+}
+
+// relativeName returns the path of the file relative to the trash parent folder, its base name if outside
+func (t *Trash) relativeName(abs string) string {
+	parent, err := filepath.Abs(filepath.Dir(t.Dir))
+	if err == nil {
+		if rel, err := filepath.Rel(parent, abs); err == nil && !strings.HasPrefix(rel, "..") {
+			return rel
+		}
+	}
+	return filepath.Base(abs)
+}
+
+func (t *Trash) read() ([]Entry, error) {
+	var entries []Entry
+	if !exists(filepath.Join(t.Dir, indexName)) {
+		return entries, nil
+	}
+	if err := utils.ReadJsonFile(filepath.Join(t.Dir, indexName), &entries); err != nil {
+		return nil, err
+	}
+	sort.SliceStable(entries, func(i, j int) bool { return entries[i].Date.Before(entries[j].Date) })
+	return entries, nil
+}
+
+// write saves the entries which are still in the trash
+func (t *Trash) write(entries []Entry) error {
+	kept := []Entry{}
+	for _, entry := range entries {
+		if !entry.restored {
+			kept = append(kept, entry)
+		}
+	}
+
+	if err := os.MkdirAll(t.Dir, 0775); err != nil {
+		return i18n.NewError(i18n.FileWrite, err, t.Dir)
+	}
+	return utils.WriteJsonFile(filepath.Join(t.Dir, indexName), kept, true)
+}
+
+// removeEmptyDateDirs deletes the dated folders left empty
+func (t *Trash) removeEmptyDateDirs() error {
+	dirs, err := os.ReadDir(t.Dir)
+	if err != nil {
+		return nil
+	}
+	for _, dir := range dirs {
+		if !dir.IsDir() {
+			continue
+		}
+		if _, err := time.Parse(dateLayout, dir.Name()); err != nil {
+			continue
+		}
+		if !hasFile(filepath.Join(t.Dir, dir.Name())) {
+			if err := utils.DeleteFile(filepath.Join(t.Dir, dir.Name())); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// match reports whether the entry is selected by its ID or original path, or if there is no selector
+func (e Entry) match(selectors []string) bool {
+	if len(selectors) == 0 {
+		return true
+	}
+	for _, s := range selectors {
+		if s == e.ID || filepath.Clean(s) == e.Path {
+			return true
+		}
+		if abs, err := filepath.Abs(s); err == nil && abs == e.Path {
+			return true
+		}
+	}
+	return false
+}
+
+// ParseAge parses a positive duration accepting days (`30d`) on top of time.ParseDuration units
+func ParseAge(s string) (time.Duration, error) {
+	var d time.Duration
+	if strings.HasSuffix(s, "d") {
+		days, err := strconv.Atoi(strings.TrimSuffix(s, "d"))
+		if err != nil {
+			return 0, i18n.NewError(i18n.TrashAge, err, s)
+		}
+		d = time.Duration(days) * 24 * time.Hour
+	} else {
+		var err error
+		if d, err = time.ParseDuration(s); err != nil {
+			return 0, i18n.NewError(i18n.TrashAge, err, s)
+		}
+	}
+	// a negative age would empty the whole trash
+	if d <= 0 {
+		return 0, i18n.NewError(i18n.TrashAge, nil, s)
+	}
+	return d, nil
+}
+
+func exists(path string) bool {
+	_, err := os.Lstat(path)
+	return err == nil
+}
+
+// dirSize returns the size of a file or of all the files of a directory
+func dirSize(path string) int64 {
+	var size int64
+	filepath.Walk(path, func(_ string, info os.FileInfo, err error) error {
+		if err == nil && !info.IsDir() {
+			size += info.Size()
+		}
+		return nil
+	})
+	return size
+}
+
+// hasFile reports whether a directory holds at least one file
+func hasFile(dir string) bool {
+	found := false
+	filepath.Walk(dir, func(_ string, info os.FileInfo, err error) error {
+		if err == nil && !info.IsDir() {
+			found = true
+			return filepath.SkipDir
+		}
+		return nil
+	})
+	return found
+}
@@ -0,0 +1,145 @@
+package trash
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/jymannob/recaltools/i18n"
+)
+
+func TestTrash(t *testing.T) {
+	romsDir := t.TempDir()
+	files := []string{
+		filepath.Join(romsDir, "nes", "old.zip"),
+		filepath.Join(romsDir, "nes", "new.zip"),
+		filepath.Join(romsDir, "snes", "game.zip"),
+	}
+	for _, file := range files {
+		os.MkdirAll(filepath.Dir(file), 0775)
+		if err := os.WriteFile(file, []byte("rom"), 0664); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	now := time.Date(2022, 5, 1, 12, 0, 0, 0, time.UTC)
+	tr := ForRomsDir(romsDir)
+	tr.now = func() time.Time { return now }
+
+	// put
+	for i, file := range files {
+		if i == 1 {
+			now = now.Add(48 * time.Hour)
+		}
+		entry, err := tr.Put(file)
+		if err != nil {
+			t.Fatalf("Trash.Put() error = %v", err)
+		}
+		if _, err := os.Stat(file); err == nil {
+			t.Errorf("Trash.Put() %s still exists", file)
+		}
+		if _, err := os.Stat(filepath.Join(tr.Dir, entry.ID)); err != nil {
+			t.Errorf("Trash.Put() %s not in trash : %v", file, err)
+		}
+	}
+
+	entries, err := tr.List()
+	if err != nil {
+		t.Fatalf("Trash.List() error = %v", err)
+	}
+	if len(entries) != 3 {
+		t.Fatalf("Trash.List() = %d entries, want 3", len(entries))
+	}
+	if entries[0].Path != files[0] || entries[0].ID != "20220501-120000/nes/old.zip" || entries[0].Size != 3 {
+		t.Errorf("Trash.List()[0] = %+v", entries[0])
+	}
+
+	// restore by original path, existing files are not overwritten
+	os.WriteFile(files[2], []byte("new rom"), 0664)
+	restored, err := tr.Restore(files[1], files[2])
+	if !errors.Is(err, &i18n.Error{Key: i18n.TrashRestoreFailed}) {
+		t.Errorf("Trash.Restore() error = %v restoring over an existing file, want %s", err, i18n.TrashRestoreFailed)
+	}
+	if len(restored) != 1 || restored[0].Path != files[1] {
+		t.Errorf("Trash.Restore() = %+v, want %s", restored, files[1])
+	}
+	if _, err := os.Stat(files[1]); err != nil {
+		t.Errorf("Trash.Restore() %s not restored", files[1])
+	}
+	if data, _ := os.ReadFile(files[2]); string(data) != "new rom" {
+		t.Errorf("Trash.Restore() overwrote %s", files[2])
+	}
+
+	// empty files trashed for more than a day
+	deleted, err := tr.Empty(24 * time.Hour)
+	if err != nil {
+		t.Fatalf("Trash.Empty() error = %v", err)
+	}
+	if len(deleted) != 1 || deleted[0].Path != files[0] {
+		t.Errorf("Trash.Empty() = %+v, want %s", deleted, files[0])
+	}
+	if _, err := os.Stat(filepath.Join(tr.Dir, "20220501-120000")); err == nil {
+		t.Errorf("Trash.Empty() did not remove the empty dated folder")
+	}
+
+	entries, _ = tr.List()
+	if len(entries) != 1 || entries[0].Path != files[2] {
+		t.Errorf("Trash.List() after empty = %+v, want %s", entries, files[2])
+	}
+}
+
+func TestTrash_cancelled(t *testing.T) {
+	romsDir := t.TempDir()
+	file := filepath.Join(romsDir, "nes", "game.zip")
+	os.MkdirAll(filepath.Dir(file), 0775)
+	if err := os.WriteFile(file, []byte("rom"), 0664); err != nil {
+		t.Fatal(err)
+	}
+	tr := ForRomsDir(romsDir)
+	if _, err := tr.Put(file); err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if restored, err := tr.RestoreContext(ctx); !errors.Is(err, context.Canceled) || len(restored) != 0 {
+		t.Errorf("Trash.RestoreContext() = %+v, %v, want nothing restored", restored, err)
+	}
+	if deleted, err := tr.EmptyContext(ctx, 0); !errors.Is(err, context.Canceled) || len(deleted) != 0 {
+		t.Errorf("Trash.EmptyContext() = %+v, %v, want nothing deleted", deleted, err)
+	}
+	if entries, _ := tr.List(); len(entries) != 1 {
+		t.Errorf("Trash.List() after cancelled runs = %+v, want the trashed file", entries)
+	}
+}
+
+func TestParseAge(t *testing.T) {
+	tests := []struct {
+		age     string
+		want    time.Duration
+		wantErr bool
+	}{
+		{"30d", 30 * 24 * time.Hour, false},
+		{"12h", 12 * time.Hour, false},
+		{"1h30m", 90 * time.Minute, false},
+		{"d", 0, true},
+		{"0d", 0, true},
+		{"-1d", 0, true},
+		{"-5h", 0, true},
+		{"month", 0, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.age, func(t *testing.T) {
+			got, err := ParseAge(tt.age)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("ParseAge() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("ParseAge() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,243 @@
+package recaltools
+
+import (
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"io"
+	"io/fs"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/jymannob/recaltools/i18n"
+	"github.com/jymannob/recaltools/logger"
+	"github.com/jymannob/recaltools/utils"
+	"github.com/jymannob/recaltools/vfs"
+)
+
+// UsageReporter reports the disk space used by the roms, media and saves of each system.
+// Only system filters apply, symlinked directories are not followed.
+type UsageReporter struct {
+	RomsDir   []string
+	MediaDirs []string // media folders relative to the system directory, DefaultMediaDirs if empty
+	SavesDir  string   // folder holding a saves folder per system, `saves` next to each roms directory if empty
+	SortBy    string   // SortByName, or SortByRoms, SortByMedia, SortBySaves, SortByTotal largest first
+	Systems   []SystemUsage
+	Options
+	mu sync.Mutex
+}
+
+// SystemUsage is the disk space used by a system, in bytes
+type SystemUsage struct {
+	System string `json:"system"`
+	Path   string `json:"path"`
+	Roms   int64  `json:"roms"`
+	Media  int64  `json:"media"`
+	Saves  int64  `json:"saves"`
+	Total  int64  `json:"total"`
+}
+
+// sizes the usage can be sorted by
+const (
+	SortByRoms  = "roms"
+	SortByMedia = "media"
+	SortBySaves = "saves"
+	SortByTotal = "total"
+)
+
+// files of a system directory which are neither roms nor media
+var systemFiles = []string{"gamelist.xml", fileBackupName}
+
+func (u *UsageReporter) mediaDirs() []string {
+	if len(u.MediaDirs) == 0 {
+		return DefaultMediaDirs
+	}
+	return u.MediaDirs
+}
+
+func (u *UsageReporter) savesDir(romsdir string) string {
+	if u.SavesDir == "" {
+		return filepath.Join(filepath.Dir(filepath.Clean(romsdir)), "saves")
+	}
+	return u.SavesDir
+}
+
+// Usage walks every system directory of RomsDir and sums its roms, media and saves sizes
+func (u *UsageReporter) Usage() error {
+	return u.UsageContext(context.Background())
+}
+
+// UsageContext is Usage stopping to start new systems once ctx is done
+func (u *UsageReporter) UsageContext(ctx context.Context) error {
+
+	switch u.SortBy {
+	case "", SortByName, SortByRoms, SortByMedia, SortBySaves, SortByTotal:
+	default:
+		return i18n.NewError(i18n.UsageSortInvalid, nil, u.SortBy)
+	}
+
+	// a system reached twice through a bind mount is counted once
+	systems, err := u.scanner().SystemDirs(u.RomsDir)
+	if err != nil {
+		return err
+	}
+	saves := make(map[string]string)
+	for _, systemPath := range systems {
+		saves[systemPath] = filepath.Join(u.savesDir(filepath.Dir(systemPath)), filepath.Base(systemPath))
+	}
+
+	err = forEach(ctx, u.Jobs, systems, observed(u.observer(), systems, func(systemPath string) (int, error) { return 0, u.usageSystem(systemPath, saves[systemPath]) }))
+	u.sort()
+	if err != nil {
+		return err
+	}
+
+	total := u.Total()
+	u.log().Info(i18n.T(i18n.UsageDone, len(u.Systems), utils.HumanSize(total.Roms), utils.HumanSize(total.Media), utils.HumanSize(total.Saves), utils.HumanSize(total.Total)))
+	return nil
+}
+
+func (u *UsageReporter) usageSystem(systemPath, savesPath string) error {
+
+	usage := SystemUsage{System: filepath.Base(systemPath), Path: systemPath}
+
+	media := map[string]bool{filepath.Join(systemPath, quarantineDirName): true}
+	for _, dir := range u.mediaDirs() {
+		media[filepath.Join(systemPath, dir)] = true
+	}
+
+	err := fs.WalkDir(u.fs(), systemPath, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.IsDir() {
+			if media[path] {
+				usage.Media += dirSize(u.fs(), path)
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		for _, name := range systemFiles {
+			if d.Name() == name {
+				return nil
+			}
+		}
+		info, err := d.Info()
+		if err != nil {
+			return err
+		}
+		usage.Roms += info.Size()
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	usage.Saves = dirSize(u.fs(), savesPath)
+	usage.Total = usage.Roms + usage.Media + usage.Saves
+
+	u.log().Debug(i18n.T(i18n.UsageSystem, usage.System, utils.HumanSize(usage.Total)), logger.System(systemPath))
+
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	u.Systems = append(u.Systems, usage)
+	return nil
+}
+
+// Total returns the sum of the systems usage
+func (u *UsageReporter) Total() SystemUsage {
+	total := SystemUsage{System: "total"}
+	for _, usage := range u.Systems {
+		total.Roms += usage.Roms
+		total.Media += usage.Media
+		total.Saves += usage.Saves
+		total.Total += usage.Total
+	}
+	return total
+}
+
+// sort orders systems by name, or by the SortBy size largest first
+func (u *UsageReporter) sort() {
+	size := func(usage SystemUsage) int64 {
+		switch u.SortBy {
+		case SortByRoms:
+			return usage.Roms
+		case SortByMedia:
+			return usage.Media
+		case SortBySaves:
+			return usage.Saves
+		case SortByTotal:
+			return usage.Total
+		}
+		return 0
+	}
+
+	sort.SliceStable(u.Systems, func(i, j int) bool {
+		if si, sj := size(u.Systems[i]), size(u.Systems[j]); si != sj {
+			return si > sj
+		}
+		if u.Systems[i].System != u.Systems[j].System {
+			return strings.ToLower(u.Systems[i].System) < strings.ToLower(u.Systems[j].System)
+		}
+		return u.Systems[i].Path < u.Systems[j].Path
+	})
+}
+
+// WriteJson writes the systems usage and their total as Json
+func (u *UsageReporter) WriteJson(w io.Writer, indent bool) error {
+	report := struct {
+		Systems []SystemUsage `json:"systems"`
+		Total   SystemUsage   `json:"total"`
+	}{u.Systems, u.Total()}
+	if report.Systems == nil {
+		report.Systems = []SystemUsage{}
+	}
+
+	enc := json.NewEncoder(w)
+	if indent {
+		enc.SetIndent("", "  ")
+	}
+	if err := enc.Encode(report); err != nil {
+		return i18n.NewError(i18n.JsonEncode, err, "usage")
+	}
+	return nil
+}
+
+// WriteCsv writes a line per system and a total line, sizes in bytes
+func (u *UsageReporter) WriteCsv(w io.Writer) error {
+	cw := csv.NewWriter(w)
+	cw.Write([]string{"system", "path", "roms", "media", "saves", "total"})
+	lines := append(append([]SystemUsage{}, u.Systems...), u.Total())
+	for _, usage := range lines {
+		cw.Write([]string{
+			usage.System,
+			usage.Path,
+			strconv.FormatInt(usage.Roms, 10),
+			strconv.FormatInt(usage.Media, 10),
+			strconv.FormatInt(usage.Saves, 10),
+			strconv.FormatInt(usage.Total, 10),
+		})
+	}
+	cw.Flush()
+	return cw.Error()
+}
+
+// dirSize returns the size of all the files of a directory, 0 if it does not exist
+func dirSize(fsys vfs.FS, dir string) int64 {
+	var size int64
+	fs.WalkDir(fsys, dir, func(_ string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return nil
+		}
+		if !d.IsDir() {
+			if info, err := d.Info(); err == nil {
+				size += info.Size()
+			}
+		}
+		return nil
+	})
+	return size
+}
@@ -0,0 +1,91 @@
+package recaltools
+
+import (
+	"bytes"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// Functional testing
+func TestUsageReporter(t *testing.T) {
+	share := t.TempDir()
+	romsDir := filepath.Join(share, "roms")
+	files := map[string]int{
+		"roms/nes/a.zip":                          100,
+		"roms/nes/sub/b.zip":                      50,
+		"roms/nes/gamelist.xml":                   1000,
+		"roms/nes/media/images/a.png":             20,
+		"roms/nes/media-quarantine/images/c.png":  5,
+		"roms/snes/c.sfc":                         10,
+		"roms/snes/media/videos/c.mp4":            300,
+		"roms/.trash/20220501-120000/nes/old.zip": 1000,
+		"saves/nes/a.state":                       7,
+	}
+	for file, size := range files {
+		path := filepath.Join(share, file)
+		os.MkdirAll(filepath.Dir(path), 0775)
+		if err := os.WriteFile(path, make([]byte, size), 0664); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	u := &UsageReporter{RomsDir: []string{romsDir}, SortBy: SortByTotal}
+	if err := u.Usage(); err != nil {
+		t.Fatalf("UsageReporter.Usage() error = %v", err)
+	}
+
+	want := []SystemUsage{
+		{System: "snes", Path: filepath.Join(romsDir, "snes"), Roms: 10, Media: 300, Total: 310},
+		{System: "nes", Path: filepath.Join(romsDir, "nes"), Roms: 150, Media: 25, Saves: 7, Total: 182},
+	}
+	if len(u.Systems) != len(want) {
+		t.Fatalf("UsageReporter.Systems = %+v, want %+v", u.Systems, want)
+	}
+	for i := range want {
+		if u.Systems[i] != want[i] {
+			t.Errorf("UsageReporter.Systems[%d] = %+v, want %+v", i, u.Systems[i], want[i])
+		}
+	}
+	if total := u.Total(); total.Total != 492 {
+		t.Errorf("UsageReporter.Total() = %+v, want 492", total)
+	}
+
+	var csv bytes.Buffer
+	if err := u.WriteCsv(&csv); err != nil {
+		t.Fatalf("UsageReporter.WriteCsv() error = %v", err)
+	}
+	lines := strings.Split(strings.TrimSpace(csv.String()), "\n")
+	if len(lines) != 4 || lines[0] != "system,path,roms,media,saves,total" || lines[3] != "total,,160,325,7,492" {
+		t.Errorf("UsageReporter.WriteCsv() = %q", csv.String())
+	}
+
+	var data bytes.Buffer
+	if err := u.WriteJson(&data, false); err != nil {
+		t.Fatalf("UsageReporter.WriteJson() error = %v", err)
+	}
+	var report struct {
+		Systems []SystemUsage
+		Total   SystemUsage
+	}
+	if err := json.Unmarshal(data.Bytes(), &report); err != nil || len(report.Systems) != 2 || report.Total.Total != 492 {
+		t.Errorf("UsageReporter.WriteJson() = %s, %v", data.String(), err)
+	}
+
+	// a roms directory reached twice is counted once
+	link := filepath.Join(share, "roms-link")
+	if err := os.Symlink(romsDir, link); err != nil {
+		t.Fatal(err)
+	}
+	u = &UsageReporter{RomsDir: []string{romsDir, link}}
+	if err := u.Usage(); err != nil || len(u.Systems) != 2 || u.Total().Total != 492 {
+		t.Errorf("UsageReporter.Usage() twice the same roms = %+v, %v, want 2 systems", u.Systems, err)
+	}
+
+	u = &UsageReporter{RomsDir: []string{romsDir}, SortBy: "size"}
+	if err := u.Usage(); err == nil {
+		t.Errorf("UsageReporter.Usage() no error with an invalid sort")
+	}
+}
@@ -1,10 +1,14 @@
 package utils
 
 import (
+	"bytes"
 	"encoding/json"
 	"fmt"
 	"os"
+	"path/filepath"
 	"sync"
+
+	"github.com/jymannob/recaltools/i18n"
 )
 
 var mu sync.Mutex
@@ -26,21 +30,37 @@ func fileExists(path string) bool {
 	return true
 }
 
-// bToMb takes a number of bytes and returns a number of megabytes
-func bToMb(b uint64) uint64 {
-	return b / 1024 / 1024
+// HumanSize formats a number of bytes with the largest fitting unit (B, KB, MB, GB, TB)
+func HumanSize(b int64) string {
+	size := float64(b)
+	for _, unit := range []string{"B", "KB", "MB", "GB"} {
+		if size < 1024 {
+			if unit == "B" {
+				return fmt.Sprintf("%d %s", b, unit)
+			}
+			return fmt.Sprintf("%.1f %s", size, unit)
+		}
+		size /= 1024
+	}
+	return fmt.Sprintf("%.1f TB", size)
 }
 
 // WriteJsonFile encodes the data into JSON, and writes it to the file
 func WriteJsonFile(fPath string, data interface{}, indent bool) error {
 
-	// Write Only, Create file if not exist, truncate if exist
-	f, err := os.OpenFile(fPath, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0664)
+	out, err := EncodeJson(data, indent)
 	if err != nil {
-		return fmt.Errorf("file cannot be write : %s | %v", fPath, err)
+		return i18n.NewError(i18n.JsonEncode, err, fPath)
 	}
-	defer f.Close() // close file at end
-	enc := json.NewEncoder(f)
+
+	return WriteFileAtomic(fPath, out)
+}
+
+// EncodeJson encodes the data into JSON, indented with 2 spaces if indent
+func EncodeJson(data interface{}, indent bool) ([]byte, error) {
+
+	var buf bytes.Buffer
+	enc := json.NewEncoder(&buf)
 
 	// format json
 	if indent {
@@ -51,11 +71,44 @@ func WriteJsonFile(fPath string, data interface{}, indent bool) error {
 	defer mu.Unlock() // Unlock file at end
 	{
 		if err := enc.Encode(data); err != nil {
-			fmt.Println(err)
-			return fmt.Errorf("data cannot be convert to Json : %v", data)
+			return nil, err
 		}
 	}
 
+	return buf.Bytes(), nil
+}
+
+// WriteFileAtomic writes data to a temporary file next to path then renames it over path,
+// so an interrupted write never leaves a truncated file. The mode of an existing file is kept.
+func WriteFileAtomic(path string, data []byte) error {
+	mode := os.FileMode(0664)
+	if info, err := os.Stat(path); err == nil {
+		mode = info.Mode().Perm()
+	}
+
+	f, err := os.CreateTemp(filepath.Dir(path), "."+filepath.Base(path)+".*.tmp")
+	if err != nil {
+		return i18n.NewError(i18n.FileWrite, err, path)
+	}
+	tmp := f.Name()
+
+	_, err = f.Write(data)
+	if err == nil {
+		err = f.Sync()
+	}
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		err = os.Chmod(tmp, mode)
+	}
+	if err == nil {
+		err = os.Rename(tmp, path)
+	}
+	if err != nil {
+		os.Remove(tmp)
+		return i18n.NewError(i18n.FileWrite, err, path)
+	}
 	return nil
 }
 
@@ -63,12 +116,12 @@ func WriteJsonFile(fPath string, data interface{}, indent bool) error {
 func ReadJsonFile(fPath string, data interface{}) error {
 
 	if !fileExists(fPath) {
-		return fmt.Errorf("file do not exist : %s", fPath)
+		return i18n.NewError(i18n.FileNotExist, nil, fPath)
 	}
 
 	f, err := os.Open(fPath)
 	if err != nil {
-		return fmt.Errorf("file cannot be read : %s | %v", fPath, err)
+		return i18n.NewError(i18n.FileRead, err, fPath)
 	}
 	defer f.Close() // close file at end
 	dec := json.NewDecoder(f)
@@ -77,8 +130,7 @@ func ReadJsonFile(fPath string, data interface{}) error {
 	defer mu.Unlock() // Unlock file when finish
 	{
 		if err := dec.Decode(data); err != nil {
-			fmt.Println(err)
-			return fmt.Errorf("cannot parse Json : %v", data)
+			return i18n.NewError(i18n.JsonParse, err, fPath)
 		}
 	}
 
@@ -88,19 +140,19 @@ func ReadJsonFile(fPath string, data interface{}) error {
 // MoveFile moves a file from one location to another
 func MoveFile(from, to string) error {
 	if !fileExists(from) {
-		return fmt.Errorf("file do not exist : %s", from)
+		return i18n.NewError(i18n.FileNotExist, nil, from)
 	}
 
 	if fileExists(to) {
 		err := os.Remove(to)
 		if err != nil {
-			return fmt.Errorf("file %s already exist and cannot be deleted | %v", to, err)
+			return i18n.NewError(i18n.FileExists, err, to)
 		}
 	}
 
 	err := os.Rename(from, to)
 	if err != nil {
-		return fmt.Errorf("file %s cannot be move to %s | %v", from, to, err)
+		return i18n.NewError(i18n.FileMove, err, from, to)
 	}
 
 	return nil
@@ -110,7 +162,7 @@ func MoveFile(from, to string) error {
 func DeleteFile(file string) error {
 	err := os.RemoveAll(file)
 	if err != nil {
-		return fmt.Errorf("file or directory %s cannot be deleted | %v", file, err)
+		return i18n.NewError(i18n.FileDelete, err, file)
 	}
 	return nil
 }
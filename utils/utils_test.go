@@ -220,23 +220,49 @@ func TestWriteJsonFile(t *testing.T) {
 	}
 }
 
-func Test_bToMb(t *testing.T) {
-	type args struct {
-		b uint64
-	}
+func TestHumanSize(t *testing.T) {
 	tests := []struct {
 		name string
-		args args
-		want uint64
+		b    int64
+		want string
 	}{
-		{"Ok", args{625 * 1024 * 1024}, 625},
-		{"Ok", args{0}, 0},
+		{"Bytes", 512, "512 B"},
+		{"Kilobytes", 1536, "1.5 KB"},
+		{"Megabytes", 5 * 1024 * 1024, "5.0 MB"},
+		{"Terabytes", 3 * 1024 * 1024 * 1024 * 1024, "3.0 TB"},
 	}
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			if got := bToMb(tt.args.b); got != tt.want {
-				t.Errorf("bToMb() = %v, want %v", got, tt.want)
+			if got := HumanSize(tt.b); got != tt.want {
+				t.Errorf("HumanSize() = %v, want %v", got, tt.want)
 			}
 		})
 	}
 }
+
+func TestWriteFileAtomic(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "gamelist.xml")
+
+	if err := os.WriteFile(path, []byte("old content"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if err := WriteFileAtomic(path, []byte("new")); err != nil {
+		t.Fatalf("WriteFileAtomic() error = %v", err)
+	}
+
+	data, _ := os.ReadFile(path)
+	if string(data) != "new" {
+		t.Errorf("WriteFileAtomic() content = %q, want %q", data, "new")
+	}
+	if info, _ := os.Stat(path); info.Mode().Perm() != 0600 {
+		t.Errorf("WriteFileAtomic() mode = %v, want %v", info.Mode().Perm(), os.FileMode(0600))
+	}
+	if entries, _ := os.ReadDir(dir); len(entries) != 1 {
+		t.Errorf("WriteFileAtomic() left %d files, want 1", len(entries))
+	}
+
+	if err := WriteFileAtomic(filepath.Join(dir, "missing", "file"), nil); err == nil {
+		t.Errorf("WriteFileAtomic() no error writing in a missing directory")
+	}
+}
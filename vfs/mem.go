@@ -0,0 +1,301 @@
+package vfs
+
+import (
+	"bytes"
+	"io"
+	"io/fs"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Mem is a filesystem held in memory, safe for concurrent use
+type Mem struct {
+	mu    sync.RWMutex
+	files map[string]*memFile // by clean name, directories included
+	now   func() time.Time
+}
+
+// memFile is a file or directory of a Mem
+type memFile struct {
+	name    string // base name
+	data    []byte
+	mode    fs.FileMode
+	modTime time.Time
+}
+
+// NewMem returns an empty Mem
+func NewMem() *Mem {
+	m := &Mem{files: make(map[string]*memFile), now: time.Now}
+	m.files["."] = &memFile{name: ".", mode: fs.ModeDir | 0775, modTime: m.now()}
+	return m
+}
+
+// clean returns the name of a file of a Mem, `/`, `./` and OS separators are accepted
+func clean(name string) string {
+	name = strings.TrimPrefix(path.Clean("/"+filepath.ToSlash(name)), "/")
+	if name == "" {
+		return "."
+	}
+	return name
+}
+
+func (m *Mem) Open(name string) (fs.File, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	f, ok := m.files[clean(name)]
+	if !ok {
+		return nil, &fs.PathError{Op: "open", Path: name, Err: fs.ErrNotExist}
+	}
+	open := &memHandle{info: f.info(), name: name, reader: bytes.NewReader(f.data)}
+	if f.mode.IsDir() {
+		open.entries = m.readDir(clean(name))
+	}
+	return open, nil
+}
+
+func (m *Mem) ReadDir(name string) ([]fs.DirEntry, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	f, ok := m.files[clean(name)]
+	if !ok {
+		return nil, &fs.PathError{Op: "readdir", Path: name, Err: fs.ErrNotExist}
+	}
+	if !f.mode.IsDir() {
+		return nil, &fs.PathError{Op: "readdir", Path: name, Err: fs.ErrInvalid}
+	}
+	return m.readDir(clean(name)), nil
+}
+
+// readDir returns the entries of the directory dir sorted by name, it must be called with mu held
+func (m *Mem) readDir(dir string) []fs.DirEntry {
+	entries := []fs.DirEntry{}
+	for name, f := range m.files {
+		if name != "." && path.Dir(name) == dir {
+			entries = append(entries, f.info())
+		}
+	}
+	sort.Slice(entries, func(i, j int) bool { return entries[i].Name() < entries[j].Name() })
+	return entries
+}
+
+func (m *Mem) ReadFile(name string) ([]byte, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	f, ok := m.files[clean(name)]
+	if !ok {
+		return nil, &fs.PathError{Op: "read", Path: name, Err: fs.ErrNotExist}
+	}
+	if f.mode.IsDir() {
+		return nil, &fs.PathError{Op: "read", Path: name, Err: fs.ErrInvalid}
+	}
+	return append([]byte(nil), f.data...), nil
+}
+
+func (m *Mem) Stat(name string) (fs.FileInfo, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	f, ok := m.files[clean(name)]
+	if !ok {
+		return nil, &fs.PathError{Op: "stat", Path: name, Err: fs.ErrNotExist}
+	}
+	return f.info(), nil
+}
+
+// WriteFile writes the file name, its missing parent directories are created
+func (m *Mem) WriteFile(name string, data []byte) error {
+	return m.writeFile(name, data, 0664)
+}
+
+// writeFile writes the file name, with mode if it is new
+func (m *Mem) writeFile(name string, data []byte, mode fs.FileMode) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	file := clean(name)
+	if f, ok := m.files[file]; ok && f.mode.IsDir() {
+		return &fs.PathError{Op: "write", Path: name, Err: fs.ErrInvalid}
+	}
+	if !m.mkdirAll(path.Dir(file)) {
+		return &fs.PathError{Op: "write", Path: name, Err: fs.ErrInvalid}
+	}
+
+	if f, ok := m.files[file]; ok {
+		mode = f.mode
+	}
+	// files are replaced, never changed, so open ones keep their content
+	m.files[file] = &memFile{name: path.Base(file), data: append([]byte(nil), data...), mode: mode, modTime: m.now()}
+	return nil
+}
+
+// MkdirAll creates the directory name and its missing parents
+func (m *Mem) MkdirAll(name string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if !m.mkdirAll(clean(name)) {
+		return &fs.PathError{Op: "mkdir", Path: name, Err: fs.ErrInvalid}
+	}
+	return nil
+}
+
+// mkdirAll creates the clean directory dir and its missing parents, it fails if one of them is a file.
+// It must be called with mu held.
+func (m *Mem) mkdirAll(dir string) bool {
+	// check the parents before creating any of them
+	var missing []string
+	for ; dir != "."; dir = path.Dir(dir) {
+		f, ok := m.files[dir]
+		if ok && !f.mode.IsDir() {
+			return false
+		}
+		if !ok {
+			missing = append(missing, dir)
+		}
+	}
+
+	now := m.now()
+	for _, dir := range missing {
+		m.files[dir] = &memFile{name: path.Base(dir), mode: fs.ModeDir | 0775, modTime: now}
+	}
+	return true
+}
+
+// Remove removes the file or empty directory name
+func (m *Mem) Remove(name string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	file := clean(name)
+	f, ok := m.files[file]
+	if !ok {
+		return &fs.PathError{Op: "remove", Path: name, Err: fs.ErrNotExist}
+	}
+	if file == "." || f.mode.IsDir() && len(m.readDir(file)) > 0 {
+		return &fs.PathError{Op: "remove", Path: name, Err: fs.ErrInvalid}
+	}
+	delete(m.files, file)
+	return nil
+}
+
+// Rename moves the file or directory oldname to newname, whose directory must exist.
+// A file replaces an existing file, a directory is never replaced.
+func (m *Mem) Rename(oldname, newname string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	from, to := clean(oldname), clean(newname)
+	f, ok := m.files[from]
+	if !ok {
+		return &fs.PathError{Op: "rename", Path: oldname, Err: fs.ErrNotExist}
+	}
+	if from == to {
+		return nil
+	}
+	if dir, ok := m.files[path.Dir(to)]; !ok || !dir.mode.IsDir() {
+		return &fs.PathError{Op: "rename", Path: newname, Err: fs.ErrNotExist}
+	}
+	if target, ok := m.files[to]; ok && (target.mode.IsDir() || f.mode.IsDir()) {
+		return &fs.PathError{Op: "rename", Path: newname, Err: fs.ErrExist}
+	}
+	if from == "." || strings.HasPrefix(to, from+"/") {
+		return &fs.PathError{Op: "rename", Path: newname, Err: fs.ErrInvalid}
+	}
+
+	for name, file := range m.files {
+		if name != from && !strings.HasPrefix(name, from+"/") {
+			continue
+		}
+		moved := *file
+		if name == from {
+			moved.name = path.Base(to)
+		}
+		delete(m.files, name)
+		m.files[to+strings.TrimPrefix(name, from)] = &moved
+	}
+	return nil
+}
+
+// Files returns the names of the files of m, directories excluded, sorted
+func (m *Mem) Files() []string {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	var names []string
+	for name, f := range m.files {
+		if !f.mode.IsDir() {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	return names
+}
+
+// info returns the fs.FileInfo and fs.DirEntry of the file
+func (f *memFile) info() *memInfo {
+	return &memInfo{name: f.name, size: int64(len(f.data)), mode: f.mode, modTime: f.modTime}
+}
+
+type memInfo struct {
+	name    string
+	size    int64
+	mode    fs.FileMode
+	modTime time.Time
+}
+
+func (i *memInfo) Name() string               { return i.name }
+func (i *memInfo) Size() int64                { return i.size }
+func (i *memInfo) Mode() fs.FileMode          { return i.mode }
+func (i *memInfo) ModTime() time.Time         { return i.modTime }
+func (i *memInfo) IsDir() bool                { return i.mode.IsDir() }
+func (i *memInfo) Sys() interface{}           { return nil }
+func (i *memInfo) Type() fs.FileMode          { return i.mode.Type() }
+func (i *memInfo) Info() (fs.FileInfo, error) { return i, nil }
+
+// memHandle is an open file or directory of a Mem
+type memHandle struct {
+	info    *memInfo
+	name    string
+	reader  *bytes.Reader
+	entries []fs.DirEntry // directory entries not read yet
+}
+
+func (h *memHandle) Stat() (fs.FileInfo, error) {
+	return h.info, nil
+}
+
+func (h *memHandle) Read(b []byte) (int, error) {
+	if h.info.IsDir() {
+		return 0, &fs.PathError{Op: "read", Path: h.name, Err: fs.ErrInvalid}
+	}
+	return h.reader.Read(b)
+}
+
+func (h *memHandle) Close() error {
+	return nil
+}
+
+// ReadDir reads the directory like os.File.ReadDir
+func (h *memHandle) ReadDir(n int) ([]fs.DirEntry, error) {
+	if !h.info.IsDir() {
+		return nil, &fs.PathError{Op: "readdir", Path: h.name, Err: fs.ErrInvalid}
+	}
+	if n <= 0 || n >= len(h.entries) {
+		entries := h.entries
+		h.entries = nil
+		if n > 0 && len(entries) == 0 {
+			return nil, io.EOF
+		}
+		return entries, nil
+	}
+	entries := h.entries[:n]
+	h.entries = h.entries[n:]
+	return entries, nil
+}
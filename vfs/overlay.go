@@ -0,0 +1,307 @@
+package vfs
+
+import (
+	"errors"
+	"io/fs"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// Overlay reads a base filesystem and keeps the files written in memory, the base is never written.
+// Files removed or moved from the base are hidden. A run against an Overlay can be inspected before anything is changed.
+type Overlay struct {
+	base  FS
+	upper *Mem
+
+	mu      sync.Mutex
+	written map[string]bool // names given to WriteFile and Rename
+	removed map[string]bool // clean names of the base files removed or moved
+}
+
+// NewOverlay returns an Overlay of base
+func NewOverlay(base FS) *Overlay {
+	return &Overlay{base: base, upper: NewMem(), written: make(map[string]bool), removed: make(map[string]bool)}
+}
+
+// inUpper reports whether the file name has been written, or is a directory of a written file
+func (o *Overlay) inUpper(name string) bool {
+	_, err := o.upper.Stat(name)
+	return err == nil
+}
+
+// isRemoved reports whether the base file name is hidden
+func (o *Overlay) isRemoved(name string) bool {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	return o.removed[clean(name)]
+}
+
+func (o *Overlay) Open(name string) (fs.File, error) {
+	if o.inUpper(name) {
+		if info, _ := o.upper.Stat(name); info.IsDir() {
+			return o.openDir(name, info)
+		}
+		return o.upper.Open(name)
+	}
+	if o.isRemoved(name) {
+		return nil, &fs.PathError{Op: "open", Path: name, Err: fs.ErrNotExist}
+	}
+	if info, err := o.base.Stat(name); err == nil && info.IsDir() {
+		return o.openDir(name, info)
+	}
+	return o.base.Open(name)
+}
+
+// openDir opens the directory name holding written files, with the entries of both filesystems
+func (o *Overlay) openDir(name string, info fs.FileInfo) (fs.File, error) {
+	entries, err := o.ReadDir(name)
+	if err != nil {
+		return nil, err
+	}
+	if baseInfo, err := o.base.Stat(name); err == nil && !o.isRemoved(name) {
+		info = baseInfo
+	}
+	return &memHandle{info: &memInfo{name: info.Name(), mode: info.Mode(), modTime: info.ModTime()}, name: name, entries: entries}, nil
+}
+
+// ReadDir returns the entries of the base directory name not removed and the files written in it, sorted by name
+func (o *Overlay) ReadDir(name string) ([]fs.DirEntry, error) {
+	var upper, base []fs.DirEntry
+	var err error
+	if o.inUpper(name) {
+		if upper, err = o.upper.ReadDir(name); err != nil {
+			return nil, err
+		}
+		if !o.isRemoved(name) {
+			base, err = o.base.ReadDir(name)
+		}
+		if err != nil && !errors.Is(err, fs.ErrNotExist) {
+			return nil, err
+		}
+	} else {
+		if o.isRemoved(name) {
+			return nil, &fs.PathError{Op: "readdir", Path: name, Err: fs.ErrNotExist}
+		}
+		if base, err = o.base.ReadDir(name); err != nil {
+			return nil, err
+		}
+	}
+
+	entries := make(map[string]fs.DirEntry, len(base)+len(upper))
+	for _, entry := range base {
+		if !o.isRemoved(path.Join(clean(name), entry.Name())) {
+			entries[entry.Name()] = entry
+		}
+	}
+	for _, entry := range upper {
+		// directories created in memory only hold written files, the base one is kept
+		if _, ok := entries[entry.Name()]; ok && entry.IsDir() {
+			continue
+		}
+		entries[entry.Name()] = entry
+	}
+
+	merged := make([]fs.DirEntry, 0, len(entries))
+	for _, entry := range entries {
+		merged = append(merged, entry)
+	}
+	sort.Slice(merged, func(i, j int) bool { return merged[i].Name() < merged[j].Name() })
+	return merged, nil
+}
+
+func (o *Overlay) ReadFile(name string) ([]byte, error) {
+	if o.inUpper(name) {
+		return o.upper.ReadFile(name)
+	}
+	if o.isRemoved(name) {
+		return nil, &fs.PathError{Op: "read", Path: name, Err: fs.ErrNotExist}
+	}
+	return o.base.ReadFile(name)
+}
+
+func (o *Overlay) Stat(name string) (fs.FileInfo, error) {
+	info, err := o.upper.Stat(name)
+	if err == nil && (!info.IsDir() || o.isRemoved(name)) {
+		return info, nil
+	}
+	if err != nil && o.isRemoved(name) {
+		return nil, &fs.PathError{Op: "stat", Path: name, Err: fs.ErrNotExist}
+	}
+	// directories are the base ones, unless created in memory only
+	if baseInfo, baseErr := o.base.Stat(name); baseErr == nil || err != nil {
+		return baseInfo, baseErr
+	}
+	return info, nil
+}
+
+// WriteFile keeps data in memory, the mode of the base file is kept
+func (o *Overlay) WriteFile(name string, data []byte) error {
+	info, err := o.Stat(name)
+	if err == nil && info.IsDir() {
+		return &fs.PathError{Op: "write", Path: name, Err: fs.ErrInvalid}
+	}
+	return o.write(name, data, info)
+}
+
+// write keeps data in memory with the mode of info, a new file if nil
+func (o *Overlay) write(name string, data []byte, info fs.FileInfo) error {
+	mode := fs.FileMode(0664)
+	if info != nil {
+		mode = info.Mode().Perm()
+	}
+	if err := o.mkdirAll(path.Dir(clean(name))); err != nil {
+		return err
+	}
+	if err := o.upper.writeFile(name, data, mode); err != nil {
+		return err
+	}
+
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	o.written[name] = true
+	delete(o.removed, clean(name))
+	return nil
+}
+
+// Remove hides the base file or empty directory name, and forgets it if it was written
+func (o *Overlay) Remove(name string) error {
+	info, err := o.Stat(name)
+	if err != nil {
+		return &fs.PathError{Op: "remove", Path: name, Err: fs.ErrNotExist}
+	}
+	if info.IsDir() {
+		if entries, err := o.ReadDir(name); err != nil || len(entries) > 0 {
+			return &fs.PathError{Op: "remove", Path: name, Err: fs.ErrInvalid}
+		}
+	}
+	if o.inUpper(name) {
+		if err := o.upper.Remove(name); err != nil {
+			return err
+		}
+	}
+
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	delete(o.written, name)
+	if _, err := o.base.Stat(name); err == nil {
+		o.removed[clean(name)] = true
+	}
+	return nil
+}
+
+// Rename copies the file or directory oldname to newname in memory and hides oldname.
+// A file replaces an existing file, a directory is never replaced.
+func (o *Overlay) Rename(oldname, newname string) error {
+	info, err := o.Stat(oldname)
+	if err != nil {
+		return &fs.PathError{Op: "rename", Path: oldname, Err: fs.ErrNotExist}
+	}
+	from, to := clean(oldname), clean(newname)
+	if from == to {
+		return nil
+	}
+	if dir, err := o.Stat(filepath.Dir(newname)); err != nil || !dir.IsDir() {
+		return &fs.PathError{Op: "rename", Path: newname, Err: fs.ErrNotExist}
+	}
+	if target, err := o.Stat(newname); err == nil && (target.IsDir() || info.IsDir()) {
+		return &fs.PathError{Op: "rename", Path: newname, Err: fs.ErrExist}
+	}
+	if from == "." || strings.HasPrefix(to, from+"/") {
+		return &fs.PathError{Op: "rename", Path: newname, Err: fs.ErrInvalid}
+	}
+	if !info.IsDir() {
+		data, err := o.ReadFile(oldname)
+		if err == nil {
+			err = o.write(newname, data, info)
+		}
+		if err != nil {
+			return err
+		}
+		return o.Remove(oldname)
+	}
+
+	// copy the files then remove them, children first
+	var moved []string
+	err = fs.WalkDir(o, oldname, func(name string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		dest := newname + strings.TrimPrefix(clean(name), from)
+		moved = append(moved, name)
+		if d.IsDir() {
+			return o.mkdirAll(clean(dest))
+		}
+		info, err := d.Info()
+		if err != nil {
+			return err
+		}
+		data, err := o.ReadFile(name)
+		if err != nil {
+			return err
+		}
+		return o.write(dest, data, info)
+	})
+	if err != nil {
+		return err
+	}
+	for i := len(moved) - 1; i >= 0; i-- {
+		if err := o.Remove(moved[i]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// MkdirAll creates the missing directories in memory
+func (o *Overlay) MkdirAll(name string) error {
+	if info, err := o.Stat(name); err == nil {
+		if !info.IsDir() {
+			return &fs.PathError{Op: "mkdir", Path: name, Err: fs.ErrInvalid}
+		}
+		return nil
+	}
+	return o.mkdirAll(clean(name))
+}
+
+// mkdirAll creates the clean directory dir and its parents in memory, and shows them again if they were removed
+func (o *Overlay) mkdirAll(dir string) error {
+	if err := o.upper.MkdirAll(dir); err != nil {
+		return err
+	}
+
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	for ; dir != "."; dir = path.Dir(dir) {
+		delete(o.removed, dir)
+	}
+	return nil
+}
+
+// Removed returns the clean names of the base files removed or moved, sorted
+func (o *Overlay) Removed() []string {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+
+	names := make([]string, 0, len(o.removed))
+	for name := range o.removed {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Written returns the names of the files written, sorted
+func (o *Overlay) Written() []string {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+
+	names := make([]string, 0, len(o.written))
+	for name := range o.written {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
@@ -0,0 +1,150 @@
+/*
+Package vfs is the filesystem gamelists and backups are read from and written to:
+the one of the OS, one in memory, or an overlay keeping the writes off a read-only one.
+*/
+package vfs
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"io/fs"
+	"os"
+
+	"github.com/antchfx/xmlquery"
+	"github.com/jymannob/recaltools/i18n"
+	"github.com/jymannob/recaltools/utils"
+	"github.com/jymannob/recaltools/xml"
+)
+
+// FS is a writable io/fs.FS.
+// Names are cleaned slash-separated paths, a leading `/` is ignored, except for OS which takes OS paths.
+type FS interface {
+	fs.ReadDirFS
+	fs.ReadFileFS
+	fs.StatFS
+
+	// WriteFile replaces the content of the file name at once, readers never see it partly written.
+	// The mode of an existing file is kept.
+	WriteFile(name string, data []byte) error
+
+	// Remove removes the file or empty directory name
+	Remove(name string) error
+
+	// Rename moves the file or directory oldname to newname, whose directory must exist.
+	// A file replaces an existing file.
+	Rename(oldname, newname string) error
+
+	// MkdirAll creates the directory name and its missing parents
+	MkdirAll(name string) error
+}
+
+// OS is the filesystem of the OS, names are paths absolute or relative to the working directory
+type OS struct{}
+
+func (OS) Open(name string) (fs.File, error) {
+	return os.Open(name)
+}
+
+func (OS) ReadDir(name string) ([]fs.DirEntry, error) {
+	return os.ReadDir(name)
+}
+
+func (OS) ReadFile(name string) ([]byte, error) {
+	return os.ReadFile(name)
+}
+
+func (OS) Stat(name string) (fs.FileInfo, error) {
+	return os.Stat(name)
+}
+
+// WriteFile writes to a temporary file renamed over name, its directory must exist
+func (OS) WriteFile(name string, data []byte) error {
+	return utils.WriteFileAtomic(name, data)
+}
+
+func (OS) Remove(name string) error {
+	return os.Remove(name)
+}
+
+func (OS) Rename(oldname, newname string) error {
+	return os.Rename(oldname, newname)
+}
+
+func (OS) MkdirAll(name string) error {
+	return os.MkdirAll(name, 0775)
+}
+
+// Default returns fsys, or OS if it is nil
+func Default(fsys FS) FS {
+	if fsys == nil {
+		return OS{}
+	}
+	return fsys
+}
+
+// ReadXml reads the Xml file name of fsys, see xml.OpenXmlWithEncoding
+func ReadXml(fsys FS, name string) (*xmlquery.Node, xml.Encoding, error) {
+	raw, err := fsys.ReadFile(name)
+	if err != nil {
+		return nil, xml.Encoding{}, i18n.NewError(i18n.FileOpen, err, name)
+	}
+	return xml.ParseXml(raw, name)
+}
+
+// WriteXml writes the Xml data to the file name of fsys in the given encoding
+func WriteXml(fsys FS, name string, data *xmlquery.Node, enc xml.Encoding) error {
+	out, err := xml.EncodeXml(data, enc, "")
+	if err != nil {
+		return i18n.NewError(i18n.FileWrite, err, name)
+	}
+	if err := fsys.WriteFile(name, out); err != nil {
+		return writeError(err, name)
+	}
+	return nil
+}
+
+// WriteFile writes data to the file name of fsys
+func WriteFile(fsys FS, name string, data []byte) error {
+	if err := fsys.WriteFile(name, data); err != nil {
+		return writeError(err, name)
+	}
+	return nil
+}
+
+// ReadJson reads the json file name of fsys and unmarshals it into data
+func ReadJson(fsys FS, name string, data interface{}) error {
+	raw, err := fsys.ReadFile(name)
+	if errors.Is(err, fs.ErrNotExist) {
+		return i18n.NewError(i18n.FileNotExist, nil, name)
+	}
+	if err != nil {
+		return i18n.NewError(i18n.FileRead, err, name)
+	}
+
+	if err := json.NewDecoder(bytes.NewReader(raw)).Decode(data); err != nil {
+		return i18n.NewError(i18n.JsonParse, err, name)
+	}
+	return nil
+}
+
+// WriteJson encodes the data into JSON, and writes it to the file name of fsys
+func WriteJson(fsys FS, name string, data interface{}, indent bool) error {
+	out, err := utils.EncodeJson(data, indent)
+	if err != nil {
+		return i18n.NewError(i18n.JsonEncode, err, name)
+	}
+	if err := fsys.WriteFile(name, out); err != nil {
+		return writeError(err, name)
+	}
+	return nil
+}
+
+// writeError returns err as a FileWrite error, OS ones already are
+func writeError(err error, name string) error {
+	var i18nErr *i18n.Error
+	if errors.As(err, &i18nErr) {
+		return err
+	}
+	return i18n.NewError(i18n.FileWrite, err, name)
+}
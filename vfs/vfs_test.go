@@ -0,0 +1,209 @@
+package vfs
+
+import (
+	"errors"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/jymannob/recaltools/i18n"
+)
+
+func TestMem(t *testing.T) {
+	mem := NewMem()
+	for name, data := range map[string]string{
+		"roms/nes/gamelist.xml":           "<gameList/>",
+		"/roms/snes/gamelist.xml":         "<gameList/>",
+		"./roms/nes/gamelist-backup.json": "{}",
+	} {
+		if err := mem.WriteFile(name, []byte(data)); err != nil {
+			t.Fatalf("Mem.WriteFile(%s) error = %v", name, err)
+		}
+	}
+
+	want := []string{"roms/nes/gamelist-backup.json", "roms/nes/gamelist.xml", "roms/snes/gamelist.xml"}
+	if got := walk(t, mem); !reflect.DeepEqual(got, want) {
+		t.Errorf("fs.WalkDir(Mem) = %v, want %v", got, want)
+	}
+	if !reflect.DeepEqual(mem.Files(), want) {
+		t.Errorf("Mem.Files() = %v, want %v", mem.Files(), want)
+	}
+
+	// a directory is not a file, nor a file a directory
+	if err := mem.WriteFile("roms/nes", nil); err == nil {
+		t.Errorf("Mem.WriteFile() on a directory, want error")
+	}
+	if err := mem.WriteFile("roms/nes/gamelist.xml/child", nil); err == nil {
+		t.Errorf("Mem.WriteFile() in a file, want error")
+	}
+	if _, err := mem.ReadFile("roms/gba/gamelist.xml"); !errors.Is(err, fs.ErrNotExist) {
+		t.Errorf("Mem.ReadFile() missing file error = %v, want fs.ErrNotExist", err)
+	}
+
+	// files and directories are moved, removed and created
+	if err := mem.Rename("roms/nes", "roms/famicom"); err != nil {
+		t.Fatalf("Mem.Rename() error = %v", err)
+	}
+	if err := mem.Rename("roms/famicom/gamelist.xml", "roms/gba/gamelist.xml"); err == nil {
+		t.Errorf("Mem.Rename() to a missing directory, want error")
+	}
+	if err := mem.MkdirAll("roms/gba/media"); err != nil {
+		t.Fatalf("Mem.MkdirAll() error = %v", err)
+	}
+	if err := mem.Rename("roms/famicom/gamelist.xml", "roms/gba/gamelist.xml"); err != nil {
+		t.Fatalf("Mem.Rename() error = %v", err)
+	}
+	if err := mem.Remove("roms/famicom"); err == nil {
+		t.Errorf("Mem.Remove() of a directory not empty, want error")
+	}
+	if err := mem.Remove("roms/famicom/gamelist-backup.json"); err != nil {
+		t.Fatalf("Mem.Remove() error = %v", err)
+	}
+	if err := mem.Remove("roms/famicom"); err != nil {
+		t.Fatalf("Mem.Remove() of an empty directory error = %v", err)
+	}
+	if err := mem.MkdirAll("roms/gba/gamelist.xml/media"); err == nil {
+		t.Errorf("Mem.MkdirAll() in a file, want error")
+	}
+	if want := []string{"roms/gba/gamelist.xml", "roms/snes/gamelist.xml"}; !reflect.DeepEqual(walk(t, mem), want) {
+		t.Errorf("fs.WalkDir(Mem) = %v, want %v", walk(t, mem), want)
+	}
+}
+
+// walk returns the files of fsys, through its Open and ReadDir
+func walk(t *testing.T, fsys fs.FS) []string {
+	var files []string
+	err := fs.WalkDir(fsys, ".", func(name string, d fs.DirEntry, err error) error {
+		if err == nil && !d.IsDir() {
+			files = append(files, name)
+		}
+		return err
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return files
+}
+
+func TestOverlay(t *testing.T) {
+	base := NewMem()
+	if err := base.WriteFile("nes/gamelist.xml", []byte("base")); err != nil {
+		t.Fatal(err)
+	}
+	overlay := NewOverlay(base)
+
+	for _, name := range []string{"nes/gamelist.xml", "snes/gamelist.xml"} {
+		if err := overlay.WriteFile(name, []byte("overlay")); err != nil {
+			t.Fatalf("Overlay.WriteFile(%s) error = %v", name, err)
+		}
+	}
+
+	if got, want := walk(t, overlay), []string{"nes/gamelist.xml", "snes/gamelist.xml"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("fs.WalkDir(Overlay) = %v, want %v", got, want)
+	}
+	if data, _ := overlay.ReadFile("nes/gamelist.xml"); string(data) != "overlay" {
+		t.Errorf("Overlay.ReadFile() = %q, want the written content", data)
+	}
+	if data, _ := base.ReadFile("nes/gamelist.xml"); string(data) != "base" {
+		t.Errorf("Overlay.WriteFile() changed the base to %q", data)
+	}
+	if _, err := base.Stat("snes"); !errors.Is(err, fs.ErrNotExist) {
+		t.Errorf("Overlay.WriteFile() created a base directory")
+	}
+	if want := []string{"nes/gamelist.xml", "snes/gamelist.xml"}; !reflect.DeepEqual(overlay.Written(), want) {
+		t.Errorf("Overlay.Written() = %v, want %v", overlay.Written(), want)
+	}
+}
+
+func TestOverlay_remove(t *testing.T) {
+	base := NewMem()
+	for _, name := range []string{"nes/gamelist.xml", "nes/media/images/Game.png", "snes/gamelist.xml"} {
+		if err := base.WriteFile(name, []byte(name)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	overlay := NewOverlay(base)
+
+	if err := overlay.Rename("nes/media", "nes/quarantine"); err != nil {
+		t.Fatalf("Overlay.Rename() error = %v", err)
+	}
+	if err := overlay.Rename("snes/gamelist.xml", "snes/gamelist-old.xml"); err != nil {
+		t.Fatalf("Overlay.Rename() error = %v", err)
+	}
+	if err := overlay.Remove("nes/gamelist.xml"); err != nil {
+		t.Fatalf("Overlay.Remove() error = %v", err)
+	}
+	if err := overlay.Remove("nes"); err == nil {
+		t.Errorf("Overlay.Remove() of a directory not empty, want error")
+	}
+
+	want := []string{"nes/quarantine/images/Game.png", "snes/gamelist-old.xml"}
+	if got := walk(t, overlay); !reflect.DeepEqual(got, want) {
+		t.Errorf("fs.WalkDir(Overlay) = %v, want %v", got, want)
+	}
+	if data, _ := overlay.ReadFile("snes/gamelist-old.xml"); string(data) != "snes/gamelist.xml" {
+		t.Errorf("Overlay.ReadFile() of a moved file = %q, want its content", data)
+	}
+	if _, err := overlay.Stat("nes/media"); !errors.Is(err, fs.ErrNotExist) {
+		t.Errorf("Overlay.Stat() of a moved directory error = %v, want fs.ErrNotExist", err)
+	}
+	if want := []string{"nes/gamelist.xml", "nes/media", "nes/media/images", "nes/media/images/Game.png", "snes/gamelist.xml"}; !reflect.DeepEqual(overlay.Removed(), want) {
+		t.Errorf("Overlay.Removed() = %v, want %v", overlay.Removed(), want)
+	}
+	if got := walk(t, base); len(got) != 3 {
+		t.Errorf("Overlay changed the base files to %v", got)
+	}
+
+	// a removed file written again is back
+	if err := overlay.WriteFile("nes/gamelist.xml", []byte("new")); err != nil {
+		t.Fatal(err)
+	}
+	if data, err := overlay.ReadFile("nes/gamelist.xml"); err != nil || string(data) != "new" {
+		t.Errorf("Overlay.ReadFile() of a file written again = %q, %v, want new", data, err)
+	}
+	if removed := overlay.Removed(); len(removed) != 4 {
+		t.Errorf("Overlay.Removed() = %v, want the file written again dropped", removed)
+	}
+}
+
+func TestOverlay_OS(t *testing.T) {
+	dir := t.TempDir()
+	gamelist := filepath.Join(dir, "gamelist.xml")
+	if err := os.WriteFile(gamelist, []byte("<gameList/>"), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	overlay := NewOverlay(OS{})
+	if err := overlay.WriteFile(gamelist, []byte("<gameList></gameList>")); err != nil {
+		t.Fatal(err)
+	}
+
+	// the mode of the base file is kept
+	if info, err := overlay.Stat(gamelist); err != nil || info.Mode().Perm() != 0600 {
+		t.Errorf("Overlay.Stat() = %v, %v, want mode 0600", info, err)
+	}
+	entries, err := overlay.ReadDir(dir)
+	if err != nil || len(entries) != 1 || entries[0].Name() != "gamelist.xml" {
+		t.Errorf("Overlay.ReadDir() = %v, %v, want the gamelist once", entries, err)
+	}
+	if data, _ := os.ReadFile(gamelist); string(data) != "<gameList/>" {
+		t.Errorf("Overlay.WriteFile() changed the OS file to %q", data)
+	}
+}
+
+func TestReadJson(t *testing.T) {
+	mem := NewMem()
+	if err := WriteJson(mem, "nes/gamelist-backup.json", map[string]int{"games": 2}, true); err != nil {
+		t.Fatal(err)
+	}
+
+	var got map[string]int
+	if err := ReadJson(mem, "nes/gamelist-backup.json", &got); err != nil || got["games"] != 2 {
+		t.Errorf("ReadJson() = %v, %v, want 2 games", got, err)
+	}
+	if err := ReadJson(mem, "snes/gamelist-backup.json", &got); !errors.Is(err, &i18n.Error{Key: i18n.FileNotExist}) {
+		t.Errorf("ReadJson() missing file error = %v, want FileNotExist", err)
+	}
+}
@@ -0,0 +1,169 @@
+package xml
+
+import (
+	"bytes"
+	"regexp"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/antchfx/xmlquery"
+	"github.com/jymannob/recaltools/i18n"
+	"golang.org/x/text/encoding"
+	"golang.org/x/text/encoding/htmlindex"
+)
+
+// Encoding describes how a gamelist is stored on disk
+type Encoding struct {
+	Charset string // charset name as declared in the file (utf-8, ISO-8859-1, utf-16le ...)
+	BOM     bool   // file starts with a byte order mark
+}
+
+// UTF8 is the encoding used by EmulationStation and by `--normalize-utf8`
+var UTF8 = Encoding{Charset: "UTF-8"}
+
+var boms = []struct {
+	charset string
+	mark    []byte
+}{
+	{"UTF-8", []byte{0xEF, 0xBB, 0xBF}},
+	{"UTF-16LE", []byte{0xFF, 0xFE}},
+	{"UTF-16BE", []byte{0xFE, 0xFF}},
+}
+
+// match `encoding="..."` in the xml declaration
+var declEncodingRegexp = regexp.MustCompile(`^(\s*<\?xml[^>]*?encoding=)["']([^"']*)["']`)
+
+// IsUTF8 reports whether the encoding is utf-8 without BOM
+func (e Encoding) IsUTF8() bool {
+	return isUTF8(e.Charset) && !e.BOM
+}
+
+func isUTF8(charset string) bool {
+	c := strings.ToLower(charset)
+	return c == "" || c == "utf-8" || c == "utf8"
+}
+
+// DetectEncoding guesses the encoding of a xml file from its BOM, its declaration or its content.
+// Files declaring nothing or utf-8 but containing invalid utf-8, as older scrapers write them,
+// are read as windows-1252 (superset of ISO-8859-1).
+func DetectEncoding(data []byte) Encoding {
+	for _, b := range boms {
+		if bytes.HasPrefix(data, b.mark) {
+			return Encoding{Charset: b.charset, BOM: true}
+		}
+	}
+
+	declared := declaredEncoding(data)
+	if declared != "" && !isUTF8(declared) {
+		return Encoding{Charset: declared}
+	}
+
+	if !utf8.Valid(data) {
+		return Encoding{Charset: "windows-1252"}
+	}
+
+	return UTF8
+}
+
+// declaredEncoding returns the `encoding` attribute of the xml declaration, "" if none
+func declaredEncoding(data []byte) string {
+	if m := declEncodingRegexp.FindSubmatch(data); m != nil {
+		return string(m[2])
+	}
+	return ""
+}
+
+// decodeXml converts data to utf-8 without BOM
+func decodeXml(data []byte, enc Encoding) ([]byte, error) {
+	for _, b := range boms {
+		if enc.BOM && strings.EqualFold(b.charset, enc.Charset) {
+			data = bytes.TrimPrefix(data, b.mark)
+		}
+	}
+
+	if !isUTF8(enc.Charset) {
+		e, err := htmlindex.Get(enc.Charset)
+		if err != nil {
+			return nil, i18n.NewError(i18n.CharsetUnsupported, err, enc.Charset)
+		}
+		data, err = e.NewDecoder().Bytes(data)
+		if err != nil {
+			return nil, i18n.NewError(i18n.CharsetDecode, err, enc.Charset)
+		}
+	}
+
+	return data, nil
+}
+
+// declareUTF8 rewrites the xml declaration of utf-8 data so xmlquery does not decode it twice
+func declareUTF8(data []byte) []byte {
+	return declEncodingRegexp.ReplaceAll(data, []byte(`${1}"UTF-8"`))
+}
+
+// EncodeXml serializes the document in the given encoding, indented with indent if not empty.
+// The xml declaration is kept as read, unless the document is converted from or to utf-8.
+// Characters the encoding can not represent are written as numeric character references.
+func EncodeXml(data *xmlquery.Node, enc Encoding, indent string) ([]byte, error) {
+	if isUTF8(enc.Charset) != isUTF8(getDeclaredEncoding(data)) {
+		setDeclaredEncoding(data, enc.Charset)
+	}
+
+	var out []byte
+	if indent != "" {
+		out = []byte(OutputIndentXML(data, indent))
+	} else {
+		out = []byte(data.OutputXML(true))
+	}
+
+	if !isUTF8(enc.Charset) {
+		e, err := htmlindex.Get(enc.Charset)
+		if err != nil {
+			return nil, i18n.NewError(i18n.CharsetUnsupported, err, enc.Charset)
+		}
+		out, err = encoding.HTMLEscapeUnsupported(e.NewEncoder()).Bytes(out)
+		if err != nil {
+			return nil, i18n.NewError(i18n.CharsetEncode, err, enc.Charset)
+		}
+	}
+
+	if enc.BOM {
+		for _, b := range boms {
+			if strings.EqualFold(b.charset, enc.Charset) {
+				out = append(append([]byte{}, b.mark...), out...)
+			}
+		}
+	}
+
+	return out, nil
+}
+
+// declaration returns the xml declaration node of the document, nil if none
+func declaration(doc *xmlquery.Node) *xmlquery.Node {
+	for n := doc.FirstChild; n != nil; n = n.NextSibling {
+		if n.Type == xmlquery.DeclarationNode && n.Data == "xml" {
+			return n
+		}
+	}
+	return nil
+}
+
+// getDeclaredEncoding returns the `encoding` attribute of the document xml declaration, "" if none
+func getDeclaredEncoding(doc *xmlquery.Node) string {
+	if decl := declaration(doc); decl != nil {
+		return decl.SelectAttr("encoding")
+	}
+	return ""
+}
+
+// setDeclaredEncoding updates the `encoding` attribute of the document xml declaration when there is one
+func setDeclaredEncoding(doc *xmlquery.Node, charset string) {
+	decl := declaration(doc)
+	if decl == nil {
+		return
+	}
+	for i, attr := range decl.Attr {
+		if attr.Name.Local == "encoding" {
+			decl.Attr[i].Value = charset
+		}
+	}
+}
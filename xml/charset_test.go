@@ -0,0 +1,146 @@
+package xml
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+const latin1Xml = "<?xml version=\"1.0\" encoding=\"ISO-8859-1\"?><gameList><game><path>Pok\xe9mon.gb</path><name>Pok\xe9mon</name></game></gameList>"
+
+func TestDetectEncoding(t *testing.T) {
+	tests := []struct {
+		name string
+		data []byte
+		want Encoding
+	}{
+		{"utf-8 without declaration", []byte(`<?xml version="1.0"?><gameList/>`), UTF8},
+		{"utf-8 BOM", []byte("\xef\xbb\xbf<?xml version=\"1.0\"?><gameList/>"), Encoding{"UTF-8", true}},
+		{"utf-16le BOM", []byte("\xff\xfe<\x00?\x00"), Encoding{"UTF-16LE", true}},
+		{"utf-16be BOM", []byte("\xfe\xff\x00<\x00?"), Encoding{"UTF-16BE", true}},
+		{"declared ISO-8859-1", []byte(latin1Xml), Encoding{Charset: "ISO-8859-1"}},
+		{"undeclared latin-1", []byte("<?xml version=\"1.0\"?><name>Pok\xe9mon</name>"), Encoding{Charset: "windows-1252"}},
+		{"latin-1 declared utf-8", []byte("<?xml version=\"1.0\" encoding=\"UTF-8\"?><name>Pok\xe9mon</name>"), Encoding{Charset: "windows-1252"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := DetectEncoding(tt.data); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("DetectEncoding() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestOpenXmlWithEncoding(t *testing.T) {
+	dir := t.TempDir()
+
+	utf16 := []byte{0xFF, 0xFE}
+	for _, r := range `<?xml version="1.0" encoding="UTF-16"?><gameList><game><path>Pokémon.gb</path><name>Pokémon</name></game></gameList>` {
+		utf16 = append(utf16, byte(r), byte(r>>8))
+	}
+
+	tests := []struct {
+		name string
+		data []byte
+		enc  Encoding
+	}{
+		{"declared ISO-8859-1", []byte(latin1Xml), Encoding{Charset: "ISO-8859-1"}},
+		{"undeclared latin-1", []byte("<?xml version=\"1.0\"?><gameList><game><path>Pok\xe9mon.gb</path><name>Pok\xe9mon</name></game></gameList>"), Encoding{Charset: "windows-1252"}},
+		{"utf-8 BOM", []byte("\xef\xbb\xbf<?xml version=\"1.0\"?><gameList><game><path>Pokémon.gb</path><name>Pokémon</name></game></gameList>"), Encoding{"UTF-8", true}},
+		{"utf-16le BOM", utf16, Encoding{"UTF-16LE", true}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			file := filepath.Join(dir, "gamelist.xml")
+			if err := os.WriteFile(file, tt.data, 0664); err != nil {
+				t.Fatal(err)
+			}
+
+			doc, enc, err := OpenXmlWithEncoding(file)
+			if err != nil {
+				t.Fatalf("OpenXmlWithEncoding() error = %v", err)
+			}
+			if !reflect.DeepEqual(enc, tt.enc) {
+				t.Errorf("OpenXmlWithEncoding() encoding = %v, want %v", enc, tt.enc)
+			}
+			if name := doc.SelectElement("//name").InnerText(); name != "Pokémon" {
+				t.Errorf("OpenXmlWithEncoding() name = %q, want %q", name, "Pokémon")
+			}
+
+			// write back in the original encoding : file is unchanged
+			if _, err := WriteXmlWithEncoding(file, doc, enc); err != nil {
+				t.Fatalf("WriteXmlWithEncoding() error = %v", err)
+			}
+			got, _ := os.ReadFile(file)
+			if !bytes.Equal(got, tt.data) {
+				t.Errorf("WriteXmlWithEncoding() = %q, want %q", got, tt.data)
+			}
+
+			// normalize to utf-8
+			if _, err := WriteXml(file, doc); err != nil {
+				t.Fatalf("WriteXml() error = %v", err)
+			}
+			got, _ = os.ReadFile(file)
+			if enc := DetectEncoding(got); !reflect.DeepEqual(enc, UTF8) {
+				t.Errorf("WriteXml() encoding = %v, want %v", enc, UTF8)
+			}
+			if !bytes.Contains(got, []byte("Pokémon")) {
+				t.Errorf("WriteXml() = %q, want utf-8 content", got)
+			}
+		})
+	}
+}
+
+func TestOpenXmlWithEncoding_latin1DeclaredUTF8(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "gamelist.xml")
+	data := "<?xml version=\"1.0\" encoding=\"UTF-8\"?><gameList><game><name>Pok\xe9mon</name></game></gameList>"
+	if err := os.WriteFile(file, []byte(data), 0664); err != nil {
+		t.Fatal(err)
+	}
+
+	doc, enc, err := OpenXmlWithEncoding(file)
+	if err != nil {
+		t.Fatalf("OpenXmlWithEncoding() error = %v", err)
+	}
+	if name := doc.SelectElement("//name").InnerText(); name != "Pokémon" {
+		t.Errorf("OpenXmlWithEncoding() name = %q, want %q", name, "Pokémon")
+	}
+
+	// written back in latin-1, the declaration follows
+	if _, err := WriteXmlWithEncoding(file, doc, enc); err != nil {
+		t.Fatalf("WriteXmlWithEncoding() error = %v", err)
+	}
+	got, _ := os.ReadFile(file)
+	want := "<?xml version=\"1.0\" encoding=\"windows-1252\"?><gameList><game><name>Pok\xe9mon</name></game></gameList>"
+	if string(got) != want {
+		t.Errorf("WriteXmlWithEncoding() = %q, want %q", got, want)
+	}
+}
+
+func TestEncodeXml_unsupported(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "gamelist.xml")
+	if err := os.WriteFile(file, []byte(latin1Xml), 0664); err != nil {
+		t.Fatal(err)
+	}
+	doc, enc, err := OpenXmlWithEncoding(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	SetText(doc.SelectElement("//name"), "ポケモン")
+
+	out, err := EncodeXml(doc, enc, "")
+	if err != nil {
+		t.Fatalf("EncodeXml() error = %v", err)
+	}
+	if !bytes.Contains(out, []byte("<name>&#12509;&#12465;&#12514;&#12531;</name>")) {
+		t.Errorf("EncodeXml() = %q, want numeric character references", out)
+	}
+	if err := os.WriteFile(file, out, 0664); err != nil {
+		t.Fatal(err)
+	}
+	if doc, _, err = OpenXmlWithEncoding(file); err != nil || doc.SelectElement("//name").InnerText() != "ポケモン" {
+		t.Errorf("EncodeXml() = %q, can not be read back", out)
+	}
+}
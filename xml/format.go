@@ -0,0 +1,96 @@
+package xml
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+
+	"github.com/antchfx/xmlquery"
+)
+
+// only the characters xml requires are escaped, so quotes and apostrophes of names stay as scraped
+var (
+	textEscaper = strings.NewReplacer("&", "&amp;", "<", "&lt;", ">", "&gt;")
+	attrEscaper = strings.NewReplacer("&", "&amp;", "<", "&lt;", ">", "&gt;", `"`, "&quot;")
+)
+
+// OutputIndentXML returns the XML of the document with one element per line, children indented with indent.
+// Elements containing only text stay on one line and whitespace between elements is dropped.
+func OutputIndentXML(doc *xmlquery.Node, indent string) string {
+	var buf bytes.Buffer
+
+	if doc.Type == xmlquery.DocumentNode {
+		for n := doc.FirstChild; n != nil; n = n.NextSibling {
+			outputIndentXML(&buf, n, indent, 0)
+		}
+	} else {
+		outputIndentXML(&buf, doc, indent, 0)
+	}
+
+	return buf.String()
+}
+
+func outputIndentXML(buf *bytes.Buffer, n *xmlquery.Node, indent string, depth int) {
+	prefix := strings.Repeat(indent, depth)
+
+	switch n.Type {
+	case xmlquery.TextNode:
+		if text := strings.TrimSpace(n.Data); text != "" {
+			buf.WriteString(prefix + textEscaper.Replace(text) + "\n")
+		}
+		return
+	case xmlquery.CharDataNode:
+		buf.WriteString(prefix + "<![CDATA[" + n.Data + "]]>\n")
+		return
+	case xmlquery.CommentNode:
+		buf.WriteString(prefix + "<!--" + n.Data + "-->\n")
+		return
+	case xmlquery.DeclarationNode:
+		buf.WriteString(prefix + "<?" + n.Data)
+		writeAttrs(buf, n)
+		buf.WriteString("?>\n")
+		return
+	}
+
+	name := n.Data
+	if n.Prefix != "" {
+		name = n.Prefix + ":" + n.Data
+	}
+
+	buf.WriteString(prefix + "<" + name)
+	writeAttrs(buf, n)
+	buf.WriteString(">")
+
+	if !hasElementChild(n) {
+		buf.WriteString(textEscaper.Replace(strings.TrimSpace(n.InnerText())))
+		buf.WriteString("</" + name + ">\n")
+		return
+	}
+
+	buf.WriteString("\n")
+	for child := n.FirstChild; child != nil; child = child.NextSibling {
+		outputIndentXML(buf, child, indent, depth+1)
+	}
+	buf.WriteString(prefix + "</" + name + ">\n")
+}
+
+func writeAttrs(buf *bytes.Buffer, n *xmlquery.Node) {
+	for _, attr := range n.Attr {
+		if attr.Name.Space != "" {
+			buf.WriteString(fmt.Sprintf(` %s:%s=`, attr.Name.Space, attr.Name.Local))
+		} else {
+			buf.WriteString(fmt.Sprintf(` %s=`, attr.Name.Local))
+		}
+		buf.WriteString(`"` + attrEscaper.Replace(attr.Value) + `"`)
+	}
+}
+
+// hasElementChild reports whether the node has at least one child which is not plain text
+func hasElementChild(n *xmlquery.Node) bool {
+	for child := n.FirstChild; child != nil; child = child.NextSibling {
+		if child.Type != xmlquery.TextNode {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,62 @@
+package xml
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/antchfx/xmlquery"
+)
+
+func TestOutputIndentXML(t *testing.T) {
+	tests := []struct {
+		name string
+		xml  string
+		want string
+	}{
+		{
+			"Indent gamelist",
+			`<?xml version="1.0"?><gameList>  <game source="Recalbox" timestamp="0"><path>Shoot&#39;em.zip</path>
+			<name> Shoot&#39;em </name><video></video></game></gameList>`,
+			"<?xml version=\"1.0\"?>\n" +
+				"<gameList>\n" +
+				"  <game source=\"Recalbox\" timestamp=\"0\">\n" +
+				"    <path>Shoot'em.zip</path>\n" +
+				"    <name>Shoot'em</name>\n" +
+				"    <video></video>\n" +
+				"  </game>\n" +
+				"</gameList>\n",
+		},
+		{
+			"Escape only what xml requires",
+			`<gameList><game name="&quot;Mario&quot; &amp; Luigi's"><name>"Mario" &amp; Luigi's &lt;3&gt;</name></game></gameList>`,
+			"<?xml?>\n" +
+				"<gameList>\n" +
+				"  <game name=\"&quot;Mario&quot; &amp; Luigi's\">\n" +
+				"    <name>\"Mario\" &amp; Luigi's &lt;3&gt;</name>\n" +
+				"  </game>\n" +
+				"</gameList>\n",
+		},
+		{
+			"Keep comments",
+			`<gameList><!-- comment --><folder><path>Homebrew</path></folder></gameList>`,
+			"<?xml?>\n" +
+				"<gameList>\n" +
+				"  <!-- comment -->\n" +
+				"  <folder>\n" +
+				"    <path>Homebrew</path>\n" +
+				"  </folder>\n" +
+				"</gameList>\n",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			doc, err := xmlquery.Parse(strings.NewReader(tt.xml))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := OutputIndentXML(doc, "  "); got != tt.want {
+				t.Errorf("OutputIndentXML() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,104 @@
+package xml
+
+import (
+	"strings"
+
+	"github.com/antchfx/xmlquery"
+)
+
+// Index gives direct access to the `game` nodes of a gamelist by `path` or `hash`.
+// It is built once per document and avoids an XPath scan of the whole document for each lookup.
+type Index struct {
+	byPath  map[string]*xmlquery.Node
+	byHash  map[string]*xmlquery.Node
+	resolve func(path string) string // applied to paths before they are compared, may be nil
+}
+
+// NewIndex walks the document once and indexes every `game` node
+func NewIndex(doc *xmlquery.Node) *Index {
+	return NewResolvedIndex(doc, nil)
+}
+
+// NewResolvedIndex is NewIndex comparing paths resolved by resolve,
+// so a relative and an absolute path of the same rom match
+func NewResolvedIndex(doc *xmlquery.Node, resolve func(path string) string) *Index {
+	idx := &Index{
+		byPath:  make(map[string]*xmlquery.Node),
+		byHash:  make(map[string]*xmlquery.Node),
+		resolve: resolve,
+	}
+
+	if doc == nil {
+		return idx
+	}
+
+	idx.walk(doc)
+
+	return idx
+}
+
+// walk indexes `game` nodes without XPath, `game` nodes are never nested
+func (idx *Index) walk(node *xmlquery.Node) {
+	for child := node.FirstChild; child != nil; child = child.NextSibling {
+		if child.Type != xmlquery.ElementNode {
+			continue
+		}
+		if child.Data == "game" {
+			idx.Add(child)
+			continue
+		}
+		idx.walk(child)
+	}
+}
+
+// Add indexes a `game` node by its `path` and `hash` child nodes.
+// When several nodes share the same key, the first one added is kept (like xmlquery.Query).
+func (idx *Index) Add(node *xmlquery.Node) {
+	for child := node.FirstChild; child != nil; child = child.NextSibling {
+		if child.Type != xmlquery.ElementNode {
+			continue
+		}
+
+		switch child.Data {
+		case "path":
+			key := idx.pathKey(child.InnerText())
+			if _, ok := idx.byPath[key]; !ok && key != "" {
+				idx.byPath[key] = node
+			}
+		case "hash":
+			key := strings.ToUpper(strings.TrimSpace(child.InnerText()))
+			if _, ok := idx.byHash[key]; !ok && key != "" {
+				idx.byHash[key] = node
+			}
+		}
+	}
+}
+
+// ByPath returns the `game` node whose `path` matches, nil if not found
+func (idx *Index) ByPath(path string) *xmlquery.Node {
+	return idx.byPath[idx.pathKey(path)]
+}
+
+// pathKey returns the key of a path in byPath
+func (idx *Index) pathKey(path string) string {
+	key := normalizePath(path)
+	if idx.resolve == nil || key == "" {
+		return key
+	}
+	return idx.resolve(key)
+}
+
+// ByHash returns the `game` node whose `hash` matches (case insensitive), nil if not found
+func (idx *Index) ByHash(hash string) *xmlquery.Node {
+	return idx.byHash[strings.ToUpper(strings.TrimSpace(hash))]
+}
+
+// Len returns the number of indexed paths
+func (idx *Index) Len() int {
+	return len(idx.byPath)
+}
+
+// normalizePath trims spaces and the leading "./" ES adds to relative rom paths
+func normalizePath(path string) string {
+	return strings.TrimPrefix(strings.TrimSpace(path), "./")
+}
@@ -0,0 +1,129 @@
+package xml
+
+import (
+	"fmt"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/antchfx/xmlquery"
+)
+
+func TestNewIndex(t *testing.T) {
+	s := `<?xml version="1.0"?><gameList>` +
+		`<folder><path>Homebrew</path><name>Homebrew</name></folder>` +
+		`<game><path>./2048 (tsone).nes</path><hash>73e0d658</hash><name>2048</name></game>` +
+		`<game><path>Homebrew/Kubo 3.nes</path><name>Kubo 3</name></game>` +
+		`<game><path>Homebrew/Kubo 3.nes</path><name>Kubo 3 duplicate</name></game>` +
+		`</gameList>`
+	doc, err := xmlquery.Parse(strings.NewReader(s))
+	if err != nil {
+		t.Fatal(err)
+	}
+	idx := NewIndex(doc)
+
+	tests := []struct {
+		name     string
+		lookup   func() *xmlquery.Node
+		wantName string
+	}{
+		{"By path", func() *xmlquery.Node { return idx.ByPath("Homebrew/Kubo 3.nes") }, "Kubo 3"},
+		{"By path with ./ prefix", func() *xmlquery.Node { return idx.ByPath("./Homebrew/Kubo 3.nes") }, "Kubo 3"},
+		{"By path without ./ prefix", func() *xmlquery.Node { return idx.ByPath("2048 (tsone).nes") }, "2048"},
+		{"By hash case insensitive", func() *xmlquery.Node { return idx.ByHash("73E0D658") }, "2048"},
+		{"Folder not indexed", func() *xmlquery.Node { return idx.ByPath("Homebrew") }, ""},
+		{"Path not found", func() *xmlquery.Node { return idx.ByPath("notExist.nes") }, ""},
+		{"Hash not found", func() *xmlquery.Node { return idx.ByHash("00000000") }, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := tt.lookup()
+			if tt.wantName == "" {
+				if got != nil {
+					t.Errorf("lookup = %v, want nil", got.OutputXML(true))
+				}
+				return
+			}
+			if got == nil || got.SelectElement("name").InnerText() != tt.wantName {
+				t.Errorf("lookup = %v, want game %s", got, tt.wantName)
+			}
+		})
+	}
+
+	if idx.Len() != 2 {
+		t.Errorf("Len() = %d, want 2", idx.Len())
+	}
+
+	if NewIndex(nil).Len() != 0 {
+		t.Errorf("NewIndex(nil).Len() should be 0")
+	}
+}
+
+func TestNewResolvedIndex(t *testing.T) {
+	s := `<gameList><game><path>/roms/nes/2048 (tsone).nes</path><name>2048</name></game></gameList>`
+	doc, err := xmlquery.Parse(strings.NewReader(s))
+	if err != nil {
+		t.Fatal(err)
+	}
+	idx := NewResolvedIndex(doc, func(path string) string {
+		if filepath.IsAbs(path) {
+			return filepath.Clean(path)
+		}
+		return filepath.Join("/roms/nes", path)
+	})
+
+	for _, path := range []string{"./2048 (tsone).nes", "2048 (tsone).nes"} {
+		if idx.ByPath(path) == nil {
+			t.Errorf("ByPath(%s) = nil, want game 2048", path)
+		}
+	}
+}
+
+// generateGamelist builds a synthetic gamelist with n `game` nodes
+func generateGamelist(n int, b *testing.B) *xmlquery.Node {
+	var sb strings.Builder
+	sb.WriteString(`<?xml version="1.0"?><gameList>`)
+	for i := 0; i < n; i++ {
+		fmt.Fprintf(&sb, `<game source="Recalbox" timestamp="0"><path>Game %d (USA).zip</path><hash>%08X</hash><name>Game %d</name></game>`, i, i, i)
+	}
+	sb.WriteString(`</gameList>`)
+
+	doc, err := xmlquery.Parse(strings.NewReader(sb.String()))
+	if err != nil {
+		b.Fatal(err)
+	}
+	return doc
+}
+
+const benchGames = 50000
+
+func BenchmarkNewIndex(b *testing.B) {
+	doc := generateGamelist(benchGames, b)
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		NewIndex(doc)
+	}
+}
+
+func BenchmarkIndex_ByPath(b *testing.B) {
+	doc := generateGamelist(benchGames, b)
+	idx := NewIndex(doc)
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if idx.ByPath(fmt.Sprintf("Game %d (USA).zip", (i*7919)%benchGames)) == nil {
+			b.Fatal("game not found")
+		}
+	}
+}
+
+// BenchmarkXpathQuery is the previous lookup strategy (one document scan per game), kept for comparison
+func BenchmarkXpathQuery(b *testing.B) {
+	doc := generateGamelist(benchGames, b)
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		expr := fmt.Sprintf("//game[./path[contains(text(), \"Game %d (USA).zip\")]]", (i*7919)%benchGames)
+		if node, _ := xmlquery.Query(doc, expr); node == nil {
+			b.Fatal("game not found")
+		}
+	}
+}
@@ -1,43 +1,83 @@
 package xml
 
 import (
+	"bytes"
 	"fmt"
 	"os"
+	"strings"
 	"sync"
 
 	"github.com/antchfx/xmlquery"
+	"github.com/jymannob/recaltools/i18n"
+	"github.com/jymannob/recaltools/utils"
 )
 
 var mu sync.RWMutex
 
 // OpenXml open Xml file and return a xmlquery.Node
 func OpenXml(filePath string) (*xmlquery.Node, error) {
+	doc, _, err := OpenXmlWithEncoding(filePath)
+	return doc, err
+}
+
+// OpenXmlWithEncoding open Xml file whatever its encoding (BOM, declared charset or latin-1 content)
+// and return a xmlquery.Node with the Encoding needed to write it back
+func OpenXmlWithEncoding(filePath string) (*xmlquery.Node, Encoding, error) {
 
-	file, err := os.Open(filePath)
+	raw, err := os.ReadFile(filePath)
 	if err != nil {
-		return nil, fmt.Errorf("impossible d'ouvrir le fichier : %s | %v", filePath, err)
+		return nil, Encoding{}, i18n.NewError(i18n.FileOpen, err, filePath)
 	}
-	defer file.Close()
+
+	return ParseXml(raw, filePath)
+}
+
+// ParseXml parses the content of the Xml file filePath, see OpenXmlWithEncoding
+func ParseXml(raw []byte, filePath string) (*xmlquery.Node, Encoding, error) {
+
+	enc := DetectEncoding(raw)
+	data, err := decodeXml(raw, enc)
+	if err != nil {
+		return nil, Encoding{}, i18n.NewError(i18n.FileRead, err, filePath)
+	}
+	declared := declaredEncoding(data)
 
 	mu.RLock()
 	defer mu.RUnlock()
-	doc, err := xmlquery.Parse(file)
+	doc, err := xmlquery.Parse(bytes.NewReader(declareUTF8(data)))
 	if err != nil {
-		return nil, fmt.Errorf("impossible de parser le xml : %s | %v", filePath, err)
+		return nil, Encoding{}, i18n.NewError(i18n.XmlParse, err, filePath)
+	}
+
+	// keep the declaration as it was in the file
+	if declared != "" {
+		setDeclaredEncoding(doc, declared)
 	}
 
-	return doc, nil
+	return doc, enc, nil
 }
 
-// WriteXml opens a file and writes the XML data to it
+// WriteXml opens a file and writes the XML data to it in utf-8
 func WriteXml(filePath string, data *xmlquery.Node) (int, error) {
-	f, err := os.OpenFile(filePath, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0664)
+	return WriteXmlWithEncoding(filePath, data, UTF8)
+}
+
+// WriteXmlWithEncoding opens a file and writes the XML data to it in the given encoding
+func WriteXmlWithEncoding(filePath string, data *xmlquery.Node, enc Encoding) (int, error) {
+	return WriteIndentXml(filePath, data, enc, "")
+}
+
+// WriteIndentXml opens a file and writes the XML data to it in the given encoding, one element per line
+func WriteIndentXml(filePath string, data *xmlquery.Node, enc Encoding, indent string) (int, error) {
+	out, err := EncodeXml(data, enc, indent)
 	if err != nil {
-		return 0, fmt.Errorf("impossible d'écrire dans le fichier : %s | %v", filePath, err)
+		return 0, i18n.NewError(i18n.FileWrite, err, filePath)
 	}
-	defer f.Close()
 
-	return f.WriteString(data.OutputXML(true))
+	if err := utils.WriteFileAtomic(filePath, out); err != nil {
+		return 0, err
+	}
+	return len(out), nil
 }
 
 // It creates a new XML node with the given name and text
@@ -60,3 +100,58 @@ func ReplaceChildNode(from *xmlquery.Node, replace *xmlquery.Node) {
 
 	xmlquery.AddChild(from, replace)
 }
+
+// SetText replaces the content of a node by a text
+func SetText(node *xmlquery.Node, text string) {
+	for child := node.FirstChild; child != nil; child = node.FirstChild {
+		xmlquery.RemoveFromTree(child)
+	}
+	xmlquery.AddChild(node, &xmlquery.Node{Type: xmlquery.TextNode, Data: text})
+}
+
+// SetAttr sets the value of a node attribute, the attribute is added if missing
+func SetAttr(node *xmlquery.Node, key, value string) {
+	for i, attr := range node.Attr {
+		if attr.Name.Local == key && attr.Name.Space == "" {
+			node.Attr[i].Value = value
+			return
+		}
+	}
+	xmlquery.AddAttr(node, key, value)
+}
+
+// RemoveChildNodes removes the child elements of node named names (and the indentation before them),
+// it returns the number of removed elements
+func RemoveChildNodes(node *xmlquery.Node, names ...string) int {
+	removed := 0
+
+	for child := node.FirstChild; child != nil; {
+		next := child.NextSibling
+
+		if child.Type == xmlquery.ElementNode && contains(names, child.Data) {
+			RemoveNode(child)
+			removed++
+		}
+
+		child = next
+	}
+
+	return removed
+}
+
+// RemoveNode removes a node and the indentation before it from the Xml tree
+func RemoveNode(node *xmlquery.Node) {
+	if prev := node.PrevSibling; prev != nil && prev.Type == xmlquery.TextNode && strings.TrimSpace(prev.Data) == "" {
+		xmlquery.RemoveFromTree(prev)
+	}
+	xmlquery.RemoveFromTree(node)
+}
+
+func contains(list []string, s string) bool {
+	for _, v := range list {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
@@ -188,3 +188,72 @@ func generateTempFile(dir string, t *testing.T) (f *os.File) {
 
 	return tempfile
 }
+
+func TestSetText(t *testing.T) {
+	t1Data := NewNode("playcount", "1")
+	t1Want := NewNode("playcount", "2")
+
+	t2Data := &xmlquery.Node{Type: xmlquery.ElementNode, Data: "desc"}
+	t2Want := NewNode("desc", "text")
+
+	type args struct {
+		node *xmlquery.Node
+		text string
+	}
+	tests := []struct {
+		name string
+		args args
+		want *xmlquery.Node
+	}{
+		{"Replace text", args{t1Data, "2"}, t1Want},
+		{"Set text on empty node", args{t2Data, "text"}, t2Want},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			SetText(tt.args.node, tt.args.text)
+			if !reflect.DeepEqual(tt.args.node, tt.want) {
+				t.Errorf("SetText() = %+v, want %+v", tt.args.node, tt.want)
+			}
+		})
+	}
+}
+
+func TestSetAttr(t *testing.T) {
+	node := &xmlquery.Node{Type: xmlquery.ElementNode, Data: "game"}
+	xmlquery.AddAttr(node, "source", "Recalbox")
+
+	SetAttr(node, "timestamp", "0")
+	SetAttr(node, "source", "ScreenScraper")
+
+	if got := node.SelectAttr("source"); got != "ScreenScraper" {
+		t.Errorf("SetAttr() source = %v, want %v", got, "ScreenScraper")
+	}
+	if got := node.SelectAttr("timestamp"); got != "0" {
+		t.Errorf("SetAttr() timestamp = %v, want %v", got, "0")
+	}
+	if len(node.Attr) != 2 {
+		t.Errorf("SetAttr() attributes = %v, want 2", node.Attr)
+	}
+}
+
+func TestRemoveChildNodes(t *testing.T) {
+	s := "<game>\n  <path>a.zip</path>\n  <desc>text</desc>\n  <image>a.png</image>\n  <favorite>true</favorite>\n</game>"
+	doc, err := xmlquery.Parse(strings.NewReader(s))
+	if err != nil {
+		t.Fatal(err)
+	}
+	game := doc.SelectElement("game")
+
+	if got := RemoveChildNodes(game, "desc", "image", "video"); got != 2 {
+		t.Errorf("RemoveChildNodes() = %v, want 2", got)
+	}
+	var got []string
+	for child := game.FirstChild; child != nil; child = child.NextSibling {
+		got = append(got, child.Data)
+	}
+	// indentation of removed nodes is removed too
+	want := []string{"\n  ", "path", "\n  ", "favorite", "\n"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("RemoveChildNodes() childs = %q, want %q", got, want)
+	}
+}